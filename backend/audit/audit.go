@@ -0,0 +1,183 @@
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"reflect"
+
+	"digital-signage-backend/database"
+
+	"github.com/google/uuid"
+)
+
+// Actions recorded in audit_log, named "<entity>.<verb>"
+const (
+	ActionAdCreated     = "ad.created"
+	ActionAdUpdated     = "ad.updated"
+	ActionAdDeleted     = "ad.deleted"
+	ActionAdsReordered  = "ads.reordered"
+	ActionMediaUploaded = "media.uploaded"
+	ActionMediaDeleted  = "media.deleted"
+	ActionAdSubmitted   = "ad.submitted"
+	ActionAdApproved    = "ad.approved"
+	ActionAdRejected    = "ad.rejected"
+	ActionAdArchived    = "ad.archived"
+	ActionAdRestored    = "ad.restored"
+
+	ActionDeviceClaimed           = "device.claimed"
+	ActionDeviceUpdated           = "device.updated"
+	ActionDeviceDeleted           = "device.deleted"
+	ActionDeviceCredentialRevoked = "device.credential_revoked"
+	ActionDeviceReloaded          = "device.reloaded"
+	ActionDeviceCommandSent       = "device.command_sent"
+
+	ActionDeviceGroupCreated        = "device_group.created"
+	ActionDeviceGroupUpdated        = "device_group.updated"
+	ActionDeviceGroupDeleted        = "device_group.deleted"
+	ActionDeviceGroupDevicesUpdated = "device_group.devices_updated"
+
+	ActionPlaylistCreated      = "playlist.created"
+	ActionPlaylistUpdated      = "playlist.updated"
+	ActionPlaylistDeleted      = "playlist.deleted"
+	ActionPlaylistItemsUpdated = "playlist.items_updated"
+	ActionPlaylistAssigned     = "playlist.assigned"
+	ActionPlaylistUnassigned   = "playlist.unassigned"
+
+	ActionUserInvited     = "user.invited"
+	ActionInviteRevoked   = "user.invite_revoked"
+	ActionUserUpdated     = "user.updated"
+	ActionUserRoleChanged = "user.role_changed"
+	ActionUserDisabled    = "user.disabled"
+	ActionUserEnabled     = "user.enabled"
+	ActionUserDeleted     = "user.deleted"
+	ActionTwoFactorReset  = "user.two_factor_reset"
+	ActionAccountUnlocked = "user.unlocked"
+
+	ActionAPIKeyCreated = "api_key.created"
+	ActionAPIKeyRevoked = "api_key.revoked"
+
+	ActionOrganizationCreated = "organization.created"
+	ActionOrganizationUpdated = "organization.updated"
+	ActionOrganizationDeleted = "organization.deleted"
+
+	ActionRegistered             = "auth.registered"
+	ActionInviteAccepted         = "auth.invite_accepted"
+	ActionLogin                  = "auth.login"
+	ActionLogout                 = "auth.logout"
+	ActionLogoutAll              = "auth.logout_all"
+	ActionSessionRevoked         = "auth.session_revoked"
+	ActionPasswordResetRequested = "auth.password_reset_requested"
+	ActionPasswordReset          = "auth.password_reset"
+	ActionTwoFactorEnabled       = "auth.two_factor_enabled"
+	ActionTwoFactorDisabled      = "auth.two_factor_disabled"
+	ActionRecoveryCodesRenewed   = "auth.recovery_codes_renewed"
+	ActionLockedOut              = "auth.locked_out"
+)
+
+// ignoredFields change on every write and would only add noise to a diff.
+var ignoredFields = map[string]bool{
+	"updated_at": true,
+}
+
+// Entry is one audit_log row. ActorID is empty for actions the system takes
+// on its own, such as a lockout. Before and After are snapshots of the
+// entity, nil when it didn't exist; the field-level diff is derived from
+// them. OrgID is the organization the entry is filed under; when the
+// snapshots carry an org_id that one is used instead, so a super admin's
+// changes are filed under the organization they touched.
+type Entry struct {
+	OrgID      string
+	ActorID    string
+	ActorEmail string
+	APIKeyID   string
+	Action     string
+	TargetType string
+	TargetID   string
+	IPAddress  string
+	Before     interface{}
+	After      interface{}
+	Details    map[string]interface{}
+}
+
+// Change is the old and new value of one field.
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// Record writes e to audit_log. Failures are logged rather than returned:
+// the action being audited has already happened by the time it's recorded.
+func Record(e Entry) {
+	before, beforeMap := snapshot(e.Action, e.Before)
+	after, afterMap := snapshot(e.Action, e.After)
+	var changes []byte
+	if beforeMap != nil && afterMap != nil {
+		changes = encode(e.Action, Diff(beforeMap, afterMap))
+	}
+	var details []byte
+	if len(e.Details) > 0 {
+		details = encode(e.Action, e.Details)
+	}
+	orgID := e.OrgID
+	for _, fields := range []map[string]interface{}{afterMap, beforeMap} {
+		if id, ok := fields["org_id"].(string); ok && id != "" {
+			orgID = id
+			break
+		}
+	}
+
+	_, err := database.DB.Exec(`
+		INSERT INTO audit_log (id, org_id, actor_id, actor_email, api_key_id, action, target_type, target_id,
+		                       ip_address, before_data, after_data, changes, details)
+		VALUES (?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?)
+	`, uuid.New().String(), orgID, e.ActorID, e.ActorEmail, e.APIKeyID, e.Action, e.TargetType, e.TargetID,
+		e.IPAddress, before, after, changes, details)
+	if err != nil {
+		log.Printf("audit: failed to record %s on %s %s: %v", e.Action, e.TargetType, e.TargetID, err)
+	}
+}
+
+// Diff returns the top-level fields that differ between before and after.
+func Diff(before, after map[string]interface{}) map[string]Change {
+	changes := map[string]Change{}
+	for key, to := range after {
+		if ignoredFields[key] {
+			continue
+		}
+		if from, ok := before[key]; !ok || !reflect.DeepEqual(from, to) {
+			changes[key] = Change{From: before[key], To: to}
+		}
+	}
+	for key, from := range before {
+		if _, ok := after[key]; !ok && !ignoredFields[key] {
+			changes[key] = Change{From: from, To: nil}
+		}
+	}
+	return changes
+}
+
+// snapshot encodes v as JSON and, when it is an object, also decodes it
+// into a map for diffing.
+func snapshot(action string, v interface{}) ([]byte, map[string]interface{}) {
+	if v == nil {
+		return nil, nil
+	}
+	data := encode(action, v)
+	if data == nil {
+		return nil, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return data, nil
+	}
+	return data, fields
+}
+
+func encode(action string, v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("audit: failed to encode %s data: %v", action, err)
+		return nil
+	}
+	return data
+}
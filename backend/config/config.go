@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 )
 
 type Config struct {
@@ -14,15 +15,73 @@ type Config struct {
 	DBName     string
 
 	// JWT
-	JWTSecret string
+	JWTSecret             string
+	AccessTokenTTLMinutes int64
+	RefreshTokenTTLDays   int64
 
 	// Server
 	Port    string
 	GinMode string
+	// Proxies whose X-Forwarded-For is believed; nil trusts none
+	TrustedProxies []string
 
 	// Upload
 	UploadPath      string
 	MaxUploadSizeMB int64
+
+	// Resumable uploads
+	UploadSessionPath            string
+	UploadSessionTTLHours        int64
+	UploadCleanupIntervalSeconds int64
+
+	// Image renditions, as the longest side in pixels; 0 turns one off
+	ThumbnailSize int64
+	PreviewSize   int64
+
+	// Media storage
+	StorageDriver     string
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3PathStyle       bool
+	S3PublicURL       string
+
+	// Scheduling
+	DefaultTimezone string
+
+	// Users
+	AppBaseURL              string
+	InviteTTLHours          int64
+	PasswordResetTTLMinutes int64
+
+	// Two-factor authentication
+	TOTPIssuer               string
+	TwoFactorTokenTTLMinutes int64
+
+	// Login throttling
+	LoginMaxFailures      int64
+	LoginMaxFailuresPerIP int64
+	LoginLockoutMinutes   int64
+	LoginBackoffSeconds   int64
+
+	// Mail
+	MailDriver   string
+	MailFrom     string
+	MailDir      string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+
+	// Devices
+	PairingCodeTTLMinutes         int64
+	PairingMaxRequestsPerIP       int64
+	PairingRateWindowMinutes      int64
+	DeviceOfflineThresholdSeconds int64
+	DeviceSweepIntervalSeconds    int64
+	ViewsRolloverIntervalSeconds  int64
 }
 
 func Load() *Config {
@@ -35,15 +94,72 @@ func Load() *Config {
 		DBName:     getEnv("DB_NAME", "digital_signage"),
 
 		// JWT
-		JWTSecret: getEnv("JWT_SECRET", "your-secret-key-change-this"),
+		JWTSecret:             getEnv("JWT_SECRET", "your-secret-key-change-this"),
+		AccessTokenTTLMinutes: getEnvAsInt("ACCESS_TOKEN_TTL_MINUTES", 15),
+		RefreshTokenTTLDays:   getEnvAsInt("REFRESH_TOKEN_TTL_DAYS", 30),
 
 		// Server
-		Port:    getEnv("PORT", "8080"),
-		GinMode: getEnv("GIN_MODE", "debug"),
+		Port:           getEnv("PORT", "8080"),
+		GinMode:        getEnv("GIN_MODE", "debug"),
+		TrustedProxies: getEnvAsList("TRUSTED_PROXIES"),
 
 		// Upload
 		UploadPath:      getEnv("UPLOAD_PATH", "./uploads"),
 		MaxUploadSizeMB: getEnvAsInt("MAX_UPLOAD_SIZE", 100),
+
+		// Resumable uploads
+		UploadSessionPath:            getEnv("UPLOAD_SESSION_PATH", "./upload-sessions"),
+		UploadSessionTTLHours:        getEnvAsInt("UPLOAD_SESSION_TTL_HOURS", 24),
+		UploadCleanupIntervalSeconds: getEnvAsInt("UPLOAD_CLEANUP_INTERVAL", 600),
+
+		// Image renditions
+		ThumbnailSize: getEnvAsInt("THUMBNAIL_SIZE", 320),
+		PreviewSize:   getEnvAsInt("PREVIEW_SIZE", 1920),
+
+		// Media storage
+		StorageDriver:     getEnv("STORAGE_DRIVER", "local"),
+		S3Endpoint:        getEnv("S3_ENDPOINT", ""),
+		S3Region:          getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:          getEnv("S3_BUCKET", ""),
+		S3AccessKeyID:     getEnv("S3_ACCESS_KEY_ID", ""),
+		S3SecretAccessKey: getEnv("S3_SECRET_ACCESS_KEY", ""),
+		S3PathStyle:       getEnv("S3_PATH_STYLE", "false") == "true",
+		S3PublicURL:       getEnv("S3_PUBLIC_URL", ""),
+
+		// Scheduling
+		DefaultTimezone: getEnv("DEFAULT_TIMEZONE", "UTC"),
+
+		// Users
+		AppBaseURL:              getEnv("APP_BASE_URL", "http://localhost:3000"),
+		InviteTTLHours:          getEnvAsInt("INVITE_TTL_HOURS", 72),
+		PasswordResetTTLMinutes: getEnvAsInt("PASSWORD_RESET_TTL_MINUTES", 60),
+
+		// Two-factor authentication
+		TOTPIssuer:               getEnv("TOTP_ISSUER", "Digital Signage"),
+		TwoFactorTokenTTLMinutes: getEnvAsInt("TWO_FACTOR_TOKEN_TTL_MINUTES", 5),
+
+		// Login throttling
+		LoginMaxFailures:      getEnvAsInt("LOGIN_MAX_FAILURES", 5),
+		LoginMaxFailuresPerIP: getEnvAsInt("LOGIN_MAX_FAILURES_PER_IP", 20),
+		LoginLockoutMinutes:   getEnvAsInt("LOGIN_LOCKOUT_MINUTES", 15),
+		LoginBackoffSeconds:   getEnvAsInt("LOGIN_BACKOFF_SECONDS", 1),
+
+		// Mail
+		MailDriver:   getEnv("MAIL_DRIVER", "log"),
+		MailFrom:     getEnv("MAIL_FROM", "Digital Signage <no-reply@localhost>"),
+		MailDir:      getEnv("MAIL_DIR", "./mail"),
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+
+		// Devices
+		PairingCodeTTLMinutes:         getEnvAsInt("PAIRING_CODE_TTL_MINUTES", 10),
+		PairingMaxRequestsPerIP:       getEnvAsInt("PAIRING_MAX_REQUESTS_PER_IP", 60),
+		PairingRateWindowMinutes:      getEnvAsInt("PAIRING_RATE_WINDOW_MINUTES", 10),
+		DeviceOfflineThresholdSeconds: getEnvAsInt("DEVICE_OFFLINE_THRESHOLD", 120),
+		DeviceSweepIntervalSeconds:    getEnvAsInt("DEVICE_SWEEP_INTERVAL", 30),
+		ViewsRolloverIntervalSeconds:  getEnvAsInt("VIEWS_ROLLOVER_INTERVAL", 60),
 	}
 }
 
@@ -61,3 +177,15 @@ func getEnvAsInt(key string, defaultValue int64) int64 {
 	}
 	return defaultValue
 }
+
+// getEnvAsList splits a comma-separated variable, returning nil when it is
+// unset or empty.
+func getEnvAsList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, ""), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,125 @@
+package dailyviews
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"digital-signage-backend/config"
+	"digital-signage-backend/database"
+
+	"github.com/google/uuid"
+)
+
+const dateLayout = "2006-01-02"
+
+// RolloverDevice archives the device's today_views into device_daily_views
+// and resets the counter once the local date (in the device's timezone) has
+// moved past views_date. It is safe to call concurrently and repeatedly.
+func RolloverDevice(deviceRowID string, now time.Time) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var todayViews int
+	var viewsDate sql.NullTime
+	var timezone string
+	err = tx.QueryRow(`
+		SELECT today_views, views_date, timezone FROM devices WHERE id = ? FOR UPDATE
+	`, deviceRowID).Scan(&todayViews, &viewsDate, &timezone)
+	if err != nil {
+		return err
+	}
+
+	localToday := LocalDate(now, timezone)
+
+	switch {
+	case !viewsDate.Valid:
+		// Counter predates rollover tracking; start tracking from today
+		_, err = tx.Exec("UPDATE devices SET views_date = ? WHERE id = ?", localToday, deviceRowID)
+	case viewsDate.Time.Format(dateLayout) < localToday:
+		_, err = tx.Exec(`
+			INSERT INTO device_daily_views (id, device_id, date, views)
+			VALUES (?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE views = views + VALUES(views)
+		`, uuid.New().String(), deviceRowID, viewsDate.Time.Format(dateLayout), todayViews)
+		if err == nil {
+			_, err = tx.Exec(`
+				UPDATE devices SET today_views = 0, views_date = ? WHERE id = ?
+			`, localToday, deviceRowID)
+		}
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Rollover runs RolloverDevice for every device whose local day has ended.
+// A device that fails is logged and retried on the next run, without holding
+// up the others. It returns how many devices were rolled over.
+func Rollover(now time.Time) (int, error) {
+	rows, err := database.DB.Query("SELECT id, views_date, timezone FROM devices")
+	if err != nil {
+		return 0, err
+	}
+
+	due := []string{}
+	for rows.Next() {
+		var id, timezone string
+		var viewsDate sql.NullTime
+		if err := rows.Scan(&id, &viewsDate, &timezone); err != nil {
+			continue
+		}
+		if !viewsDate.Valid || viewsDate.Time.Format(dateLayout) < LocalDate(now, timezone) {
+			due = append(due, id)
+		}
+	}
+	rows.Close()
+
+	rolled := 0
+	for _, id := range due {
+		if err := RolloverDevice(id, now); err != nil {
+			log.Printf("Daily views rollover of device %s failed: %v", id, err)
+			continue
+		}
+		rolled++
+	}
+	return rolled, nil
+}
+
+// StartRollover runs Rollover in the background every
+// ViewsRolloverIntervalSeconds, so each device resets shortly after its
+// local midnight.
+func StartRollover(cfg *config.Config) {
+	interval := time.Duration(cfg.ViewsRolloverIntervalSeconds) * time.Second
+	if interval <= 0 {
+		log.Println("Daily views rollover disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			if _, err := Rollover(now); err != nil {
+				log.Printf("Daily views rollover failed: %v", err)
+			}
+		}
+	}()
+}
+
+// LocalDate formats now as YYYY-MM-DD in the named timezone, falling back to
+// UTC for unknown names.
+func LocalDate(now time.Time, timezone string) string {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return now.In(loc).Format(dateLayout)
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"digital-signage-backend/config"
+	"digital-signage-backend/models"
 
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -14,8 +15,10 @@ var DB *sql.DB
 
 func Initialize(cfg *config.Config) error {
 	// MySQL connection string format: user:password@tcp(host:port)/dbname?parseTime=true
+	// Times bound from Go are sent as UTC (loc), so the session runs in UTC
+	// too (time_zone) and NOW() in SQL agrees with time.Now() in Go
 	connStr := fmt.Sprintf(
-		"%s:%s@tcp(%s:%s)/%s?parseTime=true&charset=utf8mb4&collation=utf8mb4_unicode_ci",
+		"%s:%s@tcp(%s:%s)/%s?parseTime=true&loc=UTC&time_zone=%%27%%2B00%%3A00%%27&charset=utf8mb4&collation=utf8mb4_unicode_ci",
 		cfg.DBUser, cfg.DBPassword, cfg.DBHost, cfg.DBPort, cfg.DBName,
 	)
 
@@ -46,27 +49,52 @@ func Close() error {
 
 func runMigrations() error {
 	migrations := []string{
+		// Organizations table (tenants; everything else belongs to one)
+		`CREATE TABLE IF NOT EXISTS organizations (
+			id VARCHAR(36) PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			UNIQUE KEY unique_name (name)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Default organization, which owns rows from before organizations existed
+		`INSERT IGNORE INTO organizations (id, name) VALUES ('` + models.DefaultOrgID + `', 'Default')`,
+
 		// Users table
 		`CREATE TABLE IF NOT EXISTS users (
 			id VARCHAR(36) PRIMARY KEY,
+			org_id VARCHAR(36) NOT NULL,
 			email VARCHAR(255) UNIQUE NOT NULL,
 			password_hash VARCHAR(255) NOT NULL,
 			display_name VARCHAR(255) NOT NULL,
-			role VARCHAR(50) NOT NULL DEFAULT 'admin',
+			role VARCHAR(50) NOT NULL DEFAULT 'viewer',
+			company_name VARCHAR(255) NULL,
+			is_disabled BOOLEAN NOT NULL DEFAULT false,
+			disabled_at DATETIME NULL,
+			totp_secret VARCHAR(64) NULL,
+			totp_enabled BOOLEAN NOT NULL DEFAULT false,
+			totp_last_step BIGINT NULL,
 			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-			INDEX idx_email (email)
+			INDEX idx_email (email),
+			INDEX idx_org (org_id),
+			FOREIGN KEY (org_id) REFERENCES organizations(id)
 		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
 
 		// Ads table
 		`CREATE TABLE IF NOT EXISTS ads (
 			id VARCHAR(36) PRIMARY KEY,
+			org_id VARCHAR(36) NOT NULL,
 			title VARCHAR(255) NOT NULL,
 			media_url TEXT NOT NULL,
 			media_type VARCHAR(50) NOT NULL,
+			thumbnail_url TEXT NULL,
+			preview_url TEXT NULL,
 			duration_seconds INT NOT NULL DEFAULT 5,
 			order_index INT NOT NULL DEFAULT 0,
 			is_enabled BOOLEAN NOT NULL DEFAULT true,
+			status VARCHAR(20) NOT NULL DEFAULT 'draft',
 			target_locations JSON NOT NULL,
 			created_by VARCHAR(36) NOT NULL,
 			is_deleted BOOLEAN NOT NULL DEFAULT false,
@@ -76,28 +104,44 @@ func runMigrations() error {
 			website_url VARCHAR(500),
 			gallery_images JSON,
 			total_views INT NOT NULL DEFAULT 0,
+			start_at DATETIME NULL,
+			end_at DATETIME NULL,
+			schedule JSON,
+			targeting JSON,
 			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
 			INDEX idx_order (order_index),
 			INDEX idx_enabled (is_enabled),
+			INDEX idx_status (status),
 			INDEX idx_created_by (created_by),
 			INDEX idx_company (company_name),
+			INDEX idx_org (org_id),
+			FOREIGN KEY (org_id) REFERENCES organizations(id),
 			FOREIGN KEY (created_by) REFERENCES users(id)
 		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
 
 		// Devices table
 		`CREATE TABLE IF NOT EXISTS devices (
 			id VARCHAR(36) PRIMARY KEY,
+			org_id VARCHAR(36) NOT NULL,
 			device_id VARCHAR(255) UNIQUE NOT NULL,
 			location VARCHAR(255) NOT NULL,
+			timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
 			is_online BOOLEAN NOT NULL DEFAULT false,
 			last_active TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			today_views INT NOT NULL DEFAULT 0,
+			views_date DATE NULL,
 			settings JSON NOT NULL,
+			tags JSON,
+			token_hash VARCHAR(64) NULL,
+			token_issued_at DATETIME NULL,
 			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
 			INDEX idx_device_id (device_id),
-			INDEX idx_location (location)
+			INDEX idx_location (location),
+			UNIQUE KEY unique_token_hash (token_hash),
+			INDEX idx_org (org_id),
+			FOREIGN KEY (org_id) REFERENCES organizations(id)
 		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
 
 		// Impressions table
@@ -113,6 +157,21 @@ func runMigrations() error {
 			FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE
 		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
 
+		// Review history of ads
+		`CREATE TABLE IF NOT EXISTS ad_reviews (
+			id VARCHAR(36) PRIMARY KEY,
+			ad_id VARCHAR(36) NOT NULL,
+			from_status VARCHAR(20) NOT NULL,
+			to_status VARCHAR(20) NOT NULL,
+			comment TEXT,
+			actor_id VARCHAR(36) NULL,
+			actor_email VARCHAR(255) NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_ad_created (ad_id, created_at),
+			FOREIGN KEY (ad_id) REFERENCES ads(id) ON DELETE CASCADE,
+			FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
 		// Analytics table
 		`CREATE TABLE IF NOT EXISTS ad_analytics (
 			id VARCHAR(36) PRIMARY KEY,
@@ -126,6 +185,316 @@ func runMigrations() error {
 			INDEX idx_date (date),
 			FOREIGN KEY (ad_id) REFERENCES ads(id) ON DELETE CASCADE
 		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Playlists table
+		`CREATE TABLE IF NOT EXISTS playlists (
+			id VARCHAR(36) PRIMARY KEY,
+			org_id VARCHAR(36) NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			description TEXT,
+			created_by VARCHAR(36) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			INDEX idx_org (org_id),
+			FOREIGN KEY (org_id) REFERENCES organizations(id),
+			FOREIGN KEY (created_by) REFERENCES users(id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Playlist items table
+		`CREATE TABLE IF NOT EXISTS playlist_items (
+			id VARCHAR(36) PRIMARY KEY,
+			playlist_id VARCHAR(36) NOT NULL,
+			ad_id VARCHAR(36) NOT NULL,
+			position INT NOT NULL DEFAULT 0,
+			duration_seconds INT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_playlist_position (playlist_id, position),
+			FOREIGN KEY (playlist_id) REFERENCES playlists(id) ON DELETE CASCADE,
+			FOREIGN KEY (ad_id) REFERENCES ads(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Playlist assignments table (one playlist per device or location
+		// within an organization)
+		`CREATE TABLE IF NOT EXISTS playlist_assignments (
+			id VARCHAR(36) PRIMARY KEY,
+			org_id VARCHAR(36) NOT NULL,
+			playlist_id VARCHAR(36) NOT NULL,
+			target_type VARCHAR(20) NOT NULL,
+			target_value VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE KEY unique_org_target (org_id, target_type, target_value),
+			INDEX idx_playlist_id (playlist_id),
+			FOREIGN KEY (org_id) REFERENCES organizations(id),
+			FOREIGN KEY (playlist_id) REFERENCES playlists(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Device pairing table
+		`CREATE TABLE IF NOT EXISTS device_pairings (
+			id VARCHAR(36) PRIMARY KEY,
+			code VARCHAR(12) UNIQUE NOT NULL,
+			secret_hash VARCHAR(64) NOT NULL,
+			hardware_id VARCHAR(255) NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			device_id VARCHAR(36) NULL,
+			claimed_by VARCHAR(36) NULL,
+			expires_at DATETIME NOT NULL,
+			claimed_at DATETIME NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_expires_at (expires_at),
+			FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE,
+			FOREIGN KEY (claimed_by) REFERENCES users(id) ON DELETE SET NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Device commands table
+		`CREATE TABLE IF NOT EXISTS device_commands (
+			id VARCHAR(36) PRIMARY KEY,
+			device_id VARCHAR(36) NOT NULL,
+			command VARCHAR(50) NOT NULL,
+			payload JSON,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			result JSON,
+			error_message TEXT,
+			created_by VARCHAR(36) NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL,
+			delivered_at DATETIME NULL,
+			completed_at DATETIME NULL,
+			INDEX idx_device_status (device_id, status),
+			FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE,
+			FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Device status history table (online/offline changes)
+		`CREATE TABLE IF NOT EXISTS device_status_history (
+			id VARCHAR(36) PRIMARY KEY,
+			device_id VARCHAR(36) NOT NULL,
+			status VARCHAR(10) NOT NULL,
+			reason VARCHAR(50) NOT NULL,
+			changed_at DATETIME NOT NULL,
+			INDEX idx_device_changed (device_id, changed_at),
+			FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// User invites table
+		`CREATE TABLE IF NOT EXISTS user_invites (
+			id VARCHAR(36) PRIMARY KEY,
+			org_id VARCHAR(36) NOT NULL,
+			email VARCHAR(255) NOT NULL,
+			role VARCHAR(50) NOT NULL,
+			company_name VARCHAR(255) NULL,
+			token_hash VARCHAR(64) NOT NULL,
+			invited_by VARCHAR(36) NULL,
+			expires_at DATETIME NOT NULL,
+			accepted_at DATETIME NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE KEY unique_token_hash (token_hash),
+			INDEX idx_email (email),
+			INDEX idx_org (org_id),
+			FOREIGN KEY (org_id) REFERENCES organizations(id) ON DELETE CASCADE,
+			FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE SET NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// User sessions table (one row per login, refresh token rotates)
+		`CREATE TABLE IF NOT EXISTS user_sessions (
+			id VARCHAR(36) PRIMARY KEY,
+			user_id VARCHAR(36) NOT NULL,
+			refresh_token_hash VARCHAR(64) NOT NULL,
+			previous_token_hash VARCHAR(64) NULL,
+			user_agent VARCHAR(255) NULL,
+			ip_address VARCHAR(45) NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_used_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			revoked_at DATETIME NULL,
+			revoked_reason VARCHAR(50) NULL,
+			UNIQUE KEY unique_refresh_token_hash (refresh_token_hash),
+			INDEX idx_previous_token_hash (previous_token_hash),
+			INDEX idx_user (user_id),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Two-factor recovery codes table
+		`CREATE TABLE IF NOT EXISTS user_recovery_codes (
+			id VARCHAR(36) PRIMARY KEY,
+			user_id VARCHAR(36) NOT NULL,
+			code_hash VARCHAR(64) NOT NULL,
+			used_at DATETIME NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_user (user_id),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Failed login attempts table, keyed by account or IP address
+		`CREATE TABLE IF NOT EXISTS login_attempts (
+			scope VARCHAR(32) NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			failures INT NOT NULL DEFAULT 0,
+			last_failure_at DATETIME NOT NULL,
+			locked_until DATETIME NULL,
+			PRIMARY KEY (scope, subject)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Request counts per fixed window, e.g. pairing requests per IP
+		`CREATE TABLE IF NOT EXISTS rate_limits (
+			scope VARCHAR(32) NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			window_start DATETIME NOT NULL,
+			hits INT NOT NULL DEFAULT 0,
+			PRIMARY KEY (scope, subject),
+			INDEX idx_window_start (scope, window_start)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Audit log table
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id VARCHAR(36) PRIMARY KEY,
+			org_id VARCHAR(36) NULL,
+			actor_id VARCHAR(36) NULL,
+			actor_email VARCHAR(255) NULL,
+			api_key_id VARCHAR(36) NULL,
+			action VARCHAR(100) NOT NULL,
+			target_type VARCHAR(50) NOT NULL,
+			target_id VARCHAR(255) NOT NULL,
+			ip_address VARCHAR(45) NULL,
+			before_data JSON NULL,
+			after_data JSON NULL,
+			changes JSON NULL,
+			details JSON NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_actor (actor_id),
+			INDEX idx_action (action),
+			INDEX idx_target (target_type, target_id),
+			INDEX idx_created (created_at),
+			INDEX idx_org (org_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// API keys table
+		`CREATE TABLE IF NOT EXISTS api_keys (
+			id VARCHAR(36) PRIMARY KEY,
+			org_id VARCHAR(36) NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			prefix VARCHAR(16) NOT NULL,
+			key_hash VARCHAR(64) NOT NULL,
+			scopes JSON NOT NULL,
+			created_by VARCHAR(36) NOT NULL,
+			expires_at DATETIME NULL,
+			last_used_at DATETIME NULL,
+			last_used_ip VARCHAR(45) NULL,
+			revoked_at DATETIME NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE KEY unique_key_hash (key_hash),
+			INDEX idx_org (org_id),
+			FOREIGN KEY (org_id) REFERENCES organizations(id),
+			FOREIGN KEY (created_by) REFERENCES users(id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Password reset tokens table
+		`CREATE TABLE IF NOT EXISTS password_reset_tokens (
+			id VARCHAR(36) PRIMARY KEY,
+			user_id VARCHAR(36) NOT NULL,
+			token_hash VARCHAR(64) NOT NULL,
+			expires_at DATETIME NOT NULL,
+			used_at DATETIME NULL,
+			requested_ip VARCHAR(45) NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE KEY unique_token_hash (token_hash),
+			INDEX idx_user (user_id),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Device groups table
+		`CREATE TABLE IF NOT EXISTS device_groups (
+			id VARCHAR(36) PRIMARY KEY,
+			org_id VARCHAR(36) NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			description TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			UNIQUE KEY unique_org_name (org_id, name),
+			FOREIGN KEY (org_id) REFERENCES organizations(id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Device group members table
+		`CREATE TABLE IF NOT EXISTS device_group_members (
+			group_id VARCHAR(36) NOT NULL,
+			device_id VARCHAR(36) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (group_id, device_id),
+			INDEX idx_device (device_id),
+			FOREIGN KEY (group_id) REFERENCES device_groups(id) ON DELETE CASCADE,
+			FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Device daily views table (archived today_views per local day)
+		`CREATE TABLE IF NOT EXISTS device_daily_views (
+			id VARCHAR(36) PRIMARY KEY,
+			device_id VARCHAR(36) NOT NULL,
+			date DATE NOT NULL,
+			views INT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE KEY unique_device_date (device_id, date),
+			FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Resumable uploads; the chunks themselves are staged on disk
+		`CREATE TABLE IF NOT EXISTS upload_sessions (
+			id VARCHAR(36) PRIMARY KEY,
+			org_id VARCHAR(36) NOT NULL,
+			user_id VARCHAR(36) NULL,
+			api_key_id VARCHAR(36) NULL,
+			filename VARCHAR(255) NOT NULL,
+			content_type VARCHAR(255) NULL,
+			size_bytes BIGINT NOT NULL,
+			received_bytes BIGINT NOT NULL DEFAULT 0,
+			sha256 VARCHAR(64) NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'uploading',
+			storage_key VARCHAR(255) NULL,
+			url TEXT NULL,
+			expires_at DATETIME NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			INDEX idx_expires (expires_at),
+			FOREIGN KEY (org_id) REFERENCES organizations(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (api_key_id) REFERENCES api_keys(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Uploaded files, with the type and size sniffed from their content
+		`CREATE TABLE IF NOT EXISTS media_assets (
+			id VARCHAR(36) PRIMARY KEY,
+			org_id VARCHAR(36) NOT NULL,
+			storage_key VARCHAR(255) NOT NULL,
+			url TEXT NOT NULL,
+			original_name VARCHAR(255) NOT NULL,
+			mime_type VARCHAR(100) NOT NULL,
+			media_type VARCHAR(20) NOT NULL,
+			size_bytes BIGINT NOT NULL,
+			sha256 VARCHAR(64) NULL,
+			width INT NULL,
+			height INT NULL,
+			duration_seconds DOUBLE NULL,
+			thumbnail_url TEXT NULL,
+			preview_url TEXT NULL,
+			created_by VARCHAR(36) NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_uploaded_at TIMESTAMP NULL,
+			UNIQUE KEY uniq_storage_key (storage_key),
+			UNIQUE KEY uniq_org_sha256 (org_id, sha256),
+			INDEX idx_org (org_id),
+			FOREIGN KEY (org_id) REFERENCES organizations(id) ON DELETE CASCADE,
+			FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+		// Everyone who uploaded an asset's file, including uploads that
+		// found it already stored
+		`CREATE TABLE IF NOT EXISTS media_asset_uploaders (
+			asset_id VARCHAR(36) NOT NULL,
+			user_id VARCHAR(36) NOT NULL,
+			uploaded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (asset_id, user_id),
+			INDEX idx_user (user_id),
+			FOREIGN KEY (asset_id) REFERENCES media_assets(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
 	}
 
 	for _, migration := range migrations {
@@ -143,7 +512,66 @@ func runMigrations() error {
 		"ALTER TABLE ads ADD COLUMN IF NOT EXISTS gallery_images JSON",
 		"ALTER TABLE ads ADD COLUMN IF NOT EXISTS total_views INT DEFAULT 0",
 		"ALTER TABLE ads ADD INDEX IF NOT EXISTS idx_company (company_name)",
+		"ALTER TABLE ads ADD COLUMN IF NOT EXISTS start_at DATETIME NULL",
+		"ALTER TABLE ads ADD COLUMN IF NOT EXISTS end_at DATETIME NULL",
+		"ALTER TABLE ads ADD COLUMN IF NOT EXISTS schedule JSON",
+		"ALTER TABLE devices ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC'",
+		"ALTER TABLE devices ADD COLUMN IF NOT EXISTS token_hash VARCHAR(64) NULL",
+		"ALTER TABLE devices ADD COLUMN IF NOT EXISTS token_issued_at DATETIME NULL",
+		"ALTER TABLE devices ADD UNIQUE INDEX IF NOT EXISTS unique_token_hash (token_hash)",
+		"ALTER TABLE devices ADD COLUMN IF NOT EXISTS views_date DATE NULL",
+		"ALTER TABLE devices ADD COLUMN IF NOT EXISTS tags JSON",
+		"ALTER TABLE ads ADD COLUMN IF NOT EXISTS targeting JSON",
+		"ALTER TABLE users ADD COLUMN IF NOT EXISTS company_name VARCHAR(255) NULL",
+		"ALTER TABLE users ADD COLUMN IF NOT EXISTS is_disabled BOOLEAN NOT NULL DEFAULT false",
+		"ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at DATETIME NULL",
+		"ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret VARCHAR(64) NULL",
+		"ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT false",
+		"ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NULL",
+		"ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS actor_email VARCHAR(255) NULL",
+		"ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS api_key_id VARCHAR(36) NULL",
+		"ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS before_data JSON NULL",
+		"ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS after_data JSON NULL",
+		"ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS changes JSON NULL",
+		"ALTER TABLE audit_log ADD INDEX IF NOT EXISTS idx_actor (actor_id)",
+		"ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS org_id VARCHAR(36) NULL",
+		"ALTER TABLE audit_log ADD INDEX IF NOT EXISTS idx_org (org_id)",
+		"ALTER TABLE device_groups ADD UNIQUE INDEX IF NOT EXISTS unique_org_name (org_id, name)",
+		"ALTER TABLE device_groups DROP INDEX IF EXISTS unique_name",
+		"ALTER TABLE playlist_assignments ADD UNIQUE INDEX IF NOT EXISTS unique_org_target (org_id, target_type, target_value)",
+		"ALTER TABLE playlist_assignments DROP INDEX IF EXISTS unique_target",
+		// Ads that were already on screen stay approved; new ones start as drafts
+		"ALTER TABLE ads ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'approved' AFTER is_enabled",
+		"ALTER TABLE ads ALTER COLUMN status SET DEFAULT 'draft'",
+		"ALTER TABLE ads ADD INDEX IF NOT EXISTS idx_status (status)",
+		"ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS sha256 VARCHAR(64) NULL AFTER size_bytes",
+		"ALTER TABLE media_assets ADD UNIQUE INDEX IF NOT EXISTS uniq_org_sha256 (org_id, sha256)",
+		// Media library references look ads up by their exact media_url
+		"ALTER TABLE ads ADD INDEX IF NOT EXISTS idx_org_media_url (org_id, media_url(255))",
+		"ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS thumbnail_url TEXT NULL AFTER duration_seconds",
+		"ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS preview_url TEXT NULL AFTER thumbnail_url",
+		"ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS last_uploaded_at TIMESTAMP NULL AFTER created_at",
+		"ALTER TABLE ads ADD COLUMN IF NOT EXISTS thumbnail_url TEXT NULL AFTER media_type",
+		"ALTER TABLE ads ADD COLUMN IF NOT EXISTS preview_url TEXT NULL AFTER thumbnail_url",
+	}
+
+	// Existing rows move into the default organization. The default is
+	// dropped again so an insert that forgets org_id fails instead of
+	// landing there.
+	orgTables := []string{
+		"users", "ads", "devices", "playlists", "playlist_assignments",
+		"device_groups", "user_invites", "api_keys",
+	}
+	orgStatements := []string{}
+	for _, table := range orgTables {
+		orgStatements = append(orgStatements,
+			"ALTER TABLE "+table+" ADD COLUMN IF NOT EXISTS org_id VARCHAR(36) NOT NULL DEFAULT '"+models.DefaultOrgID+"' AFTER id",
+			"ALTER TABLE "+table+" ALTER COLUMN org_id DROP DEFAULT",
+			"ALTER TABLE "+table+" ADD INDEX IF NOT EXISTS idx_org (org_id)",
+		)
 	}
+	// These run first since the organization-wide unique keys need the column
+	alterStatements = append(orgStatements, alterStatements...)
 
 	for _, stmt := range alterStatements {
 		DB.Exec(stmt) // Ignore errors
@@ -0,0 +1,159 @@
+// Package dbtest replaces database.DB with a scripted stand-in, so code
+// that runs SQL can be tested without a MySQL server.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"digital-signage-backend/database"
+)
+
+// Result is the answer to one statement: Columns and Rows for queries,
+// RowsAffected for everything else. Err fails the statement.
+type Result struct {
+	Columns      []string
+	Rows         [][]driver.Value
+	RowsAffected int64
+	Err          error
+}
+
+// Func answers a statement. query has its whitespace collapsed, so it can
+// be matched with strings.Contains regardless of indentation.
+type Func func(query string, args []driver.Value) Result
+
+// Statement is a statement that was run, as passed to Func.
+type Statement struct {
+	Query string
+	Args  []driver.Value
+}
+
+// DB records the statements run through it.
+type DB struct {
+	mu         sync.Mutex
+	fn         Func
+	statements []Statement
+}
+
+// Use points database.DB at a stand-in answering with fn until the test
+// ends.
+func Use(t testing.TB, fn Func) *DB {
+	t.Helper()
+	db := &DB{fn: fn}
+	previous := database.DB
+	database.DB = sql.OpenDB(connector{db})
+	t.Cleanup(func() {
+		database.DB.Close()
+		database.DB = previous
+	})
+	return db
+}
+
+// Statements returns the statements run so far whose query contains
+// substr, in order.
+func (db *DB) Statements(substr string) []Statement {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	matched := []Statement{}
+	for _, s := range db.statements {
+		if strings.Contains(s.Query, substr) {
+			matched = append(matched, s)
+		}
+	}
+	return matched
+}
+
+func (db *DB) run(query string, args []driver.NamedValue) Result {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	query = strings.Join(strings.Fields(query), " ")
+
+	db.mu.Lock()
+	db.statements = append(db.statements, Statement{Query: query, Args: values})
+	db.mu.Unlock()
+	return db.fn(query, values)
+}
+
+type connector struct{ db *DB }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return conn(c), nil }
+func (c connector) Driver() driver.Driver                        { return dsnDriver{c.db} }
+
+type dsnDriver struct{ db *DB }
+
+func (d dsnDriver) Open(string) (driver.Conn, error) { return conn(d), nil }
+
+type conn struct{ db *DB }
+
+func (c conn) Prepare(query string) (driver.Stmt, error) { return stmt{c.db, query}, nil }
+func (c conn) Close() error                              { return nil }
+func (c conn) Begin() (driver.Tx, error)                 { return tx{}, nil }
+
+func (c conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r := c.db.run(query, args)
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	return driver.RowsAffected(r.RowsAffected), nil
+}
+
+func (c conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	r := c.db.run(query, args)
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	return &rows{columns: r.Columns, values: r.Rows}, nil
+}
+
+type stmt struct {
+	db    *DB
+	query string
+}
+
+func (s stmt) Close() error  { return nil }
+func (s stmt) NumInput() int { return -1 }
+
+func (s stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return conn{s.db}.ExecContext(context.Background(), s.query, named(args))
+}
+
+func (s stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return conn{s.db}.QueryContext(context.Background(), s.query, named(args))
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	values := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		values[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return values
+}
+
+type tx struct{}
+
+func (tx) Commit() error   { return nil }
+func (tx) Rollback() error { return nil }
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *rows) Columns() []string { return r.columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -3,11 +3,13 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
-	"io"
+	"errors"
+	"fmt"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strings"
+	"time"
 
+	"digital-signage-backend/audit"
 	"digital-signage-backend/config"
 	"digital-signage-backend/database"
 	"digital-signage-backend/models"
@@ -24,91 +26,338 @@ func NewAdHandler(cfg *config.Config) *AdHandler {
 	return &AdHandler{cfg: cfg}
 }
 
+// adColumns is the column list scanned by adScanDest.
+const adColumns = `id, org_id, title, media_url, media_type, duration_seconds, order_index,
+		       is_enabled, status, target_locations, created_by, is_deleted,
+		       description, company_name, contact_info, website_url,
+		       COALESCE(gallery_images, '[]'), COALESCE(total_views, 0),
+		       created_at, updated_at, start_at, end_at, COALESCE(schedule, '[]'),
+		       COALESCE(targeting, '{}'), thumbnail_url, preview_url`
+
+func adScanDest(ad *models.Ad) []interface{} {
+	return []interface{}{
+		&ad.ID, &ad.OrgID, &ad.Title, &ad.MediaURL, &ad.MediaType, &ad.DurationSeconds,
+		&ad.OrderIndex, &ad.IsEnabled, &ad.Status, &ad.TargetLocations, &ad.CreatedBy,
+		&ad.IsDeleted, &ad.Description, &ad.CompanyName, &ad.ContactInfo,
+		&ad.WebsiteURL, &ad.GalleryImages, &ad.TotalViews, &ad.CreatedAt, &ad.UpdatedAt,
+		&ad.StartAt, &ad.EndAt, &ad.Schedule, &ad.Targeting, &ad.ThumbnailURL, &ad.PreviewURL,
+	}
+}
+
+// seesUnreviewed reports whether the caller may see ads that aren't
+// approved. Anonymous callers and devices only ever get approved ads.
+func seesUnreviewed(c *gin.Context) bool {
+	return c.GetString("org_id") != ""
+}
+
 func (h *AdHandler) GetAds(c *gin.Context) {
 	location := c.Query("location")
 	activeOnly := c.Query("active") == "true"
+	status := c.Query("status")
+	if !seesUnreviewed(c) {
+		status = models.AdStatusApproved
+	}
+
+	// A device may identify itself so its own location, timezone and
+	// assigned playlist are used
+	tz := c.Query("timezone")
+	var device *models.Device
+	if deviceID := c.Query("device_id"); deviceID != "" {
+		d, err := findDevice(deviceID)
+		// Signed-in callers only see the devices of their own organization
+		if err == nil && c.GetString("user_id") != "" && !inOrg(c, d.OrgID) {
+			err = sql.ErrNoRows
+		}
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		device = &d
+		if location == "" {
+			location = d.Location
+		}
+		if tz == "" {
+			tz = d.Timezone
+		}
+	}
+
+	loc, err := h.resolveTimezone(tz)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+		return
+	}
+
+	// Targeting is only applied when the caller says who is watching
+	var subject *models.TargetSubject
+	if device != nil {
+		s, err := deviceSubject(*device)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		s.Location = location
+		subject = &s
+	} else if location != "" {
+		subject = &models.TargetSubject{Location: location}
+	}
+
+	// A device always gets the ads of its own organization
+	orgID := orgScope(c)
+	if device != nil {
+		orgID = device.OrgID
+	}
+
+	var ads []models.Ad
+	fromPlaylist := false
+	if device != nil {
+		playlist, _, err := resolvePlaylist(*device)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve playlist"})
+			return
+		}
+		if playlist != nil {
+			fromPlaylist = true
+			ads, err = deviceAds(*device, playlist)
+		}
+	}
+	if !fromPlaylist {
+		ads, err = loadAds(orgID, activeOnly)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ads", "details": err.Error()})
+		return
+	}
+
+	company, restricted := advertiserCompany(c)
+
+	now := time.Now()
+	filtered := []models.Ad{}
+	for _, ad := range ads {
+		if restricted && (company == "" || ad.CompanyName != company) {
+			continue
+		}
+		if status != "" && ad.Status != status {
+			continue
+		}
+		// A playlist is already targeted at this device
+		if !fromPlaylist && subject != nil && !ad.Targets(*subject) {
+			continue
+		}
+		if activeOnly && !ad.IsLiveAt(now, loc) {
+			continue
+		}
+		filtered = append(filtered, ad)
+	}
+
+	c.JSON(http.StatusOK, filtered)
+}
+
+// PreviewAds shows which ads would be live at an arbitrary instant, for a
+// timezone and audience chosen by the admin. The audience is either an
+// existing device (device_id) or any mix of location, groups and tags.
+func (h *AdHandler) PreviewAds(c *gin.Context) {
+	at := time.Now()
+	if atParam := c.Query("at"); atParam != "" {
+		t, err := time.Parse(time.RFC3339, atParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'at', expected RFC3339 timestamp"})
+			return
+		}
+		at = t
+	}
+
+	subject := models.TargetSubject{
+		Location: c.Query("location"),
+		Groups:   splitList(c.Query("groups")),
+		Tags:     splitList(c.Query("tags")),
+	}
+	tz := c.Query("timezone")
+	orgID := orgScope(c)
+	if deviceID := c.Query("device_id"); deviceID != "" {
+		device, err := findOrgDevice(c, deviceID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if subject, err = deviceSubject(device); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if tz == "" {
+			tz = device.Timezone
+		}
+		orgID = device.OrgID
+	}
+	targeted := subject.Location != "" || len(subject.Groups) > 0 || len(subject.Tags) > 0
+
+	loc, err := h.resolveTimezone(tz)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+		return
+	}
+
+	ads, err := loadAds(orgID, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ads"})
+		return
+	}
+
+	company, restricted := advertiserCompany(c)
+
+	live := []models.Ad{}
+	for _, ad := range ads {
+		if restricted && (company == "" || ad.CompanyName != company) {
+			continue
+		}
+		if targeted && !ad.Targets(subject) {
+			continue
+		}
+		if ad.IsLiveAt(at, loc) {
+			live = append(live, ad)
+		}
+	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"at":       at.In(loc).Format(time.RFC3339),
+		"timezone": loc.String(),
+		"location": subject.Location,
+		"groups":   subject.Groups,
+		"tags":     subject.Tags,
+		"ads":      live,
+	})
+}
+
+// loadAds returns the non-deleted ads of an organization in playback order.
+// An empty orgID returns the ads of every organization. liveOnly leaves out
+// ads that are disabled or not approved.
+func loadAds(orgID string, liveOnly bool) ([]models.Ad, error) {
 	query := `
-		SELECT id, title, media_url, media_type, duration_seconds, order_index,
-		       is_enabled, target_locations, created_by, is_deleted, 
-		       description, company_name, contact_info, website_url,
-		       COALESCE(gallery_images, '[]'), COALESCE(total_views, 0),
-		       created_at, updated_at
+		SELECT ` + adColumns + `
 		FROM ads
 		WHERE is_deleted = false
 	`
 	args := []interface{}{}
-
-	if activeOnly {
-		query += " AND is_enabled = true"
+	if orgID != "" {
+		query += " AND org_id = ?"
+		args = append(args, orgID)
+	}
+	if liveOnly {
+		query += " AND is_enabled = true AND status = '" + models.AdStatusApproved + "'"
 	}
-
 	query += " ORDER BY order_index ASC"
 
 	rows, err := database.DB.Query(query, args...)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ads", "details": err.Error()})
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
 	ads := []models.Ad{}
 	for rows.Next() {
 		var ad models.Ad
-		err := rows.Scan(
-			&ad.ID, &ad.Title, &ad.MediaURL, &ad.MediaType, &ad.DurationSeconds,
-			&ad.OrderIndex, &ad.IsEnabled, &ad.TargetLocations, &ad.CreatedBy,
-			&ad.IsDeleted, &ad.Description, &ad.CompanyName, &ad.ContactInfo,
-			&ad.WebsiteURL, &ad.GalleryImages, &ad.TotalViews, &ad.CreatedAt, &ad.UpdatedAt,
-		)
-		if err != nil {
+		if err := rows.Scan(adScanDest(&ad)...); err != nil {
 			continue
 		}
+		ads = append(ads, ad)
+	}
+	return ads, rows.Err()
+}
+
+// splitList parses a comma separated query parameter.
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
 
-		// Filter by location if specified
-		if location != "" {
-			hasLocation := false
-			for _, loc := range ad.TargetLocations {
-				if loc == "all" || loc == location {
-					hasLocation = true
-					break
-				}
-			}
-			if !hasLocation {
-				continue
-			}
+// validateTargeting checks the rules and that every referenced group exists
+// in the ad's organization.
+func validateTargeting(orgID string, targeting models.AdTargeting) error {
+	if err := targeting.Validate(); err != nil {
+		return err
+	}
+	groups := append(append([]string{}, targeting.Include.Groups...), targeting.Exclude.Groups...)
+	for _, id := range groups {
+		var exists bool
+		err := database.DB.QueryRow(
+			"SELECT EXISTS(SELECT 1 FROM device_groups WHERE id = ? AND org_id = ?)", id, orgID,
+		).Scan(&exists)
+		if err != nil {
+			return err
 		}
+		if !exists {
+			return fmt.Errorf("targeting: device group %q not found", id)
+		}
+	}
+	return nil
+}
 
-		ads = append(ads, ad)
+// resolveTimezone falls back to the configured default when name is empty.
+func (h *AdHandler) resolveTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		name = h.cfg.DefaultTimezone
 	}
+	return time.LoadLocation(name)
+}
 
-	// Check for errors from iteration
-	if err := rows.Err(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading ads", "details": err.Error()})
-		return
+// authorizeAdAccess keeps advertisers to the ads of their own company. It
+// writes the error response and returns false when access is denied; other
+// roles always pass.
+func authorizeAdAccess(c *gin.Context, adID string) bool {
+	company, restricted := advertiserCompany(c)
+	if !restricted {
+		return true
+	}
+
+	var adCompany string
+	err := database.DB.QueryRow(
+		"SELECT COALESCE(company_name, '') FROM ads WHERE id = ? AND is_deleted = false", adID,
+	).Scan(&adCompany)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	// Someone else's ad is reported as missing rather than forbidden
+	if err == sql.ErrNoRows || company == "" || adCompany != company {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return false
 	}
+	return true
+}
 
-	c.JSON(http.StatusOK, ads)
+// validateAdWindow checks the campaign window and dayparting rules.
+func validateAdWindow(startAt, endAt *time.Time, schedule models.AdSchedule) error {
+	if startAt != nil && endAt != nil && !endAt.After(*startAt) {
+		return errors.New("end_at must be after start_at")
+	}
+	return schedule.Validate()
 }
 
 func (h *AdHandler) GetAdByID(c *gin.Context) {
 	id := c.Param("id")
+	if !authorizeAdAccess(c, id) {
+		return
+	}
 
 	var ad models.Ad
 	err := database.DB.QueryRow(`
-		SELECT id, title, media_url, media_type, duration_seconds, order_index,
-		       is_enabled, target_locations, created_by, is_deleted,
-		       description, company_name, contact_info, website_url,
-		       COALESCE(gallery_images, '[]'), COALESCE(total_views, 0),
-		       created_at, updated_at
+		SELECT `+adColumns+`
 		FROM ads WHERE id = ? AND is_deleted = false
-	`, id).Scan(
-		&ad.ID, &ad.Title, &ad.MediaURL, &ad.MediaType, &ad.DurationSeconds,
-		&ad.OrderIndex, &ad.IsEnabled, &ad.TargetLocations, &ad.CreatedBy,
-		&ad.IsDeleted, &ad.Description, &ad.CompanyName, &ad.ContactInfo,
-		&ad.WebsiteURL, &ad.GalleryImages, &ad.TotalViews, &ad.CreatedAt, &ad.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
+	`, id).Scan(adScanDest(&ad)...)
+	if err == sql.ErrNoRows || (err == nil && !inOrg(c, ad.OrgID)) ||
+		(err == nil && ad.Status != models.AdStatusApproved && !seesUnreviewed(c)) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
 		return
 	}
@@ -120,6 +369,25 @@ func (h *AdHandler) GetAdByID(c *gin.Context) {
 	c.JSON(http.StatusOK, ad)
 }
 
+// loadAd loads an ad by ID, including soft-deleted ones.
+func loadAd(id string) (models.Ad, error) {
+	var ad models.Ad
+	err := database.DB.QueryRow(`
+		SELECT `+adColumns+`
+		FROM ads WHERE id = ?
+	`, id).Scan(adScanDest(&ad)...)
+	return ad, err
+}
+
+// loadOrgAd is loadAd limited to the caller's organization.
+func loadOrgAd(c *gin.Context, id string) (models.Ad, error) {
+	ad, err := loadAd(id)
+	if err == nil && !inOrg(c, ad.OrgID) {
+		return ad, sql.ErrNoRows
+	}
+	return ad, err
+}
+
 func (h *AdHandler) CreateAd(c *gin.Context) {
 	var req models.CreateAdRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -127,18 +395,50 @@ func (h *AdHandler) CreateAd(c *gin.Context) {
 		return
 	}
 
+	if err := validateAdWindow(req.StartAt, req.EndAt, req.Schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkMediaType(c, req.MediaURL, req.MediaType, req.GalleryImages) {
+		return
+	}
+
+	orgID, ok := targetOrg(c)
+	if !ok {
+		return
+	}
+
+	// Advertisers always create ads for their own company
+	if company, restricted := advertiserCompany(c); restricted {
+		if company == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No company is assigned to your account"})
+			return
+		}
+		req.CompanyName = company
+	}
+
+	targeting := models.AdTargeting{}
+	if req.Targeting != nil {
+		targeting = req.Targeting.Normalized()
+		if err := validateTargeting(orgID, targeting); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	userID, _ := c.Get("user_id")
 
-	// Get max order index
+	// Get max order index; each organization has its own playback order
 	var maxOrder int
-	err := database.DB.QueryRow("SELECT COALESCE(MAX(order_index), -1) FROM ads").Scan(&maxOrder)
+	err := database.DB.QueryRow("SELECT COALESCE(MAX(order_index), -1) FROM ads WHERE org_id = ?", orgID).Scan(&maxOrder)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
 	// Convert target locations to JSON
-	targetLocationsJSON, err := json.Marshal(req.TargetLocations)
+	targetLocationsJSON, err := models.StringArray(req.TargetLocations).Value()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target locations"})
 		return
@@ -151,40 +451,58 @@ func (h *AdHandler) CreateAd(c *gin.Context) {
 		return
 	}
 
+	thumbnailURL, previewURL := mediaRenditions(req.MediaURL)
+
+	// New ads stay off screen until they are approved
+	status := models.AdStatusDraft
+	if req.Submit {
+		status = models.AdStatusSubmitted
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
 	// Insert ad
 	adID := uuid.New().String()
-	_, err = database.DB.Exec(`
-		INSERT INTO ads (id, title, media_url, media_type, duration_seconds, order_index,
-		                 is_enabled, target_locations, created_by, description,
-		                 company_name, contact_info, website_url, gallery_images, total_views)
-		VALUES (?, ?, ?, ?, ?, ?, true, ?, ?, ?, ?, ?, ?, ?, 0)
-	`, adID, req.Title, req.MediaURL, req.MediaType, req.DurationSeconds, maxOrder+1,
-		targetLocationsJSON, userID, req.Description, req.CompanyName, req.ContactInfo, req.WebsiteURL, galleryImagesJSON)
+	_, err = tx.Exec(`
+		INSERT INTO ads (id, org_id, title, media_url, media_type, thumbnail_url, preview_url,
+		                 duration_seconds, order_index, is_enabled, status, target_locations, created_by,
+		                 description, company_name, contact_info, website_url, gallery_images, total_views,
+		                 start_at, end_at, schedule, targeting)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, true, ?, ?, ?, ?, ?, ?, ?, ?, 0, ?, ?, ?, ?)
+	`, adID, orgID, req.Title, req.MediaURL, req.MediaType, thumbnailURL, previewURL, req.DurationSeconds,
+		maxOrder+1, status, targetLocationsJSON, userID, req.Description, req.CompanyName, req.ContactInfo,
+		req.WebsiteURL, galleryImagesJSON, req.StartAt, req.EndAt, req.Schedule, targeting)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ad", "details": err.Error()})
 		return
 	}
+	if req.Submit {
+		if err := insertAdReview(c, tx, adID, models.AdStatusDraft, status, ""); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ad"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
 
 	// Get created ad
-	var ad models.Ad
-	err = database.DB.QueryRow(`
-		SELECT id, title, media_url, media_type, duration_seconds, order_index,
-		       is_enabled, target_locations, created_by, is_deleted,
-		       description, company_name, contact_info, website_url,
-		       COALESCE(gallery_images, '[]'), COALESCE(total_views, 0),
-		       created_at, updated_at
-		FROM ads WHERE id = ?
-	`, adID).Scan(
-		&ad.ID, &ad.Title, &ad.MediaURL, &ad.MediaType, &ad.DurationSeconds,
-		&ad.OrderIndex, &ad.IsEnabled, &ad.TargetLocations, &ad.CreatedBy,
-		&ad.IsDeleted, &ad.Description, &ad.CompanyName, &ad.ContactInfo,
-		&ad.WebsiteURL, &ad.GalleryImages, &ad.TotalViews, &ad.CreatedAt, &ad.UpdatedAt,
-	)
+	ad, err := loadAd(adID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve created ad"})
 		return
 	}
 
+	recordAudit(c, audit.ActionAdCreated, "ad", ad.ID, nil, ad)
+	notifyContentChanged(ad.OrgID)
+
 	c.JSON(http.StatusCreated, ad)
 }
 
@@ -197,6 +515,40 @@ func (h *AdHandler) UpdateAd(c *gin.Context) {
 		return
 	}
 
+	if !authorizeAdAccess(c, id) {
+		return
+	}
+	if company, restricted := advertiserCompany(c); restricted && req.CompanyName != nil && *req.CompanyName != company {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Advertisers cannot move ads to another company"})
+		return
+	}
+
+	before, err := loadOrgAd(c, id)
+	if err == sql.ErrNoRows || (err == nil && before.IsDeleted) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// The media has to match the type the ad ends up with, whichever of the
+	// two fields changed
+	mediaURL, mediaType := before.MediaURL, before.MediaType
+	if req.MediaURL != nil {
+		mediaURL = *req.MediaURL
+	}
+	if req.MediaType != nil {
+		mediaType = *req.MediaType
+	}
+	if req.MediaURL == nil && req.MediaType == nil {
+		mediaURL = "" // unchanged, nothing to check
+	}
+	if !checkMediaType(c, mediaURL, mediaType, req.GalleryImages) {
+		return
+	}
+
 	// Build dynamic update query for MySQL
 	updates := []string{}
 	args := []interface{}{}
@@ -206,8 +558,9 @@ func (h *AdHandler) UpdateAd(c *gin.Context) {
 		args = append(args, *req.Title)
 	}
 	if req.MediaURL != nil {
-		updates = append(updates, "media_url = ?")
-		args = append(args, *req.MediaURL)
+		thumbnailURL, previewURL := mediaRenditions(*req.MediaURL)
+		updates = append(updates, "media_url = ?", "thumbnail_url = ?", "preview_url = ?")
+		args = append(args, *req.MediaURL, thumbnailURL, previewURL)
 	}
 	if req.MediaType != nil {
 		updates = append(updates, "media_type = ?")
@@ -251,12 +604,66 @@ func (h *AdHandler) UpdateAd(c *gin.Context) {
 		updates = append(updates, "gallery_images = ?")
 		args = append(args, galleryImagesJSON)
 	}
+	if req.StartAt != nil || req.EndAt != nil || req.Schedule != nil {
+		// Validate against the stored window so a single bound can be moved
+		startAt, endAt := before.StartAt, before.EndAt
+		if req.StartAt != nil {
+			startAt = req.StartAt
+		}
+		if req.EndAt != nil {
+			endAt = req.EndAt
+		}
+		if req.ClearStartAt {
+			startAt = nil
+		}
+		if req.ClearEndAt {
+			endAt = nil
+		}
+		if err := validateAdWindow(startAt, endAt, req.Schedule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.StartAt != nil && !req.ClearStartAt {
+		updates = append(updates, "start_at = ?")
+		args = append(args, *req.StartAt)
+	}
+	if req.ClearStartAt {
+		updates = append(updates, "start_at = NULL")
+	}
+	if req.EndAt != nil && !req.ClearEndAt {
+		updates = append(updates, "end_at = ?")
+		args = append(args, *req.EndAt)
+	}
+	if req.ClearEndAt {
+		updates = append(updates, "end_at = NULL")
+	}
+	if req.Schedule != nil {
+		updates = append(updates, "schedule = ?")
+		args = append(args, req.Schedule)
+	}
+	if req.Targeting != nil {
+		targeting := req.Targeting.Normalized()
+		if err := validateTargeting(before.OrgID, targeting); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates = append(updates, "targeting = ?")
+		args = append(args, targeting)
+	}
 
 	if len(updates) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
 		return
 	}
 
+	// New media has to be reviewed again before it goes back on screen
+	resubmit := before.Status == models.AdStatusApproved && mediaChanged(before, req)
+	if resubmit {
+		updates = append(updates, "status = ?")
+		args = append(args, models.AdStatusSubmitted)
+	}
+
 	// Add id to args
 	args = append(args, id)
 
@@ -265,28 +672,41 @@ func (h *AdHandler) UpdateAd(c *gin.Context) {
 		query += ", " + updates[i]
 	}
 	query += " WHERE id = ?"
+	if resubmit {
+		// Only resubmit if nobody reviewed the ad since it was loaded
+		query += " AND status = ?"
+		args = append(args, before.Status)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
 
-	_, err := database.DB.Exec(query, args...)
+	result, err := tx.Exec(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ad"})
 		return
 	}
+	if n, _ := result.RowsAffected(); resubmit && n == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "The ad was changed in the meantime, please reload it"})
+		return
+	}
+	if resubmit {
+		if err := insertAdReview(c, tx, id, models.AdStatusApproved, models.AdStatusSubmitted, "Media changed"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ad"})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
 
 	// Get updated ad
-	var ad models.Ad
-	err = database.DB.QueryRow(`
-		SELECT id, title, media_url, media_type, duration_seconds, order_index,
-		       is_enabled, target_locations, created_by, is_deleted,
-		       description, company_name, contact_info, website_url,
-		       COALESCE(gallery_images, '[]'), COALESCE(total_views, 0),
-		       created_at, updated_at
-		FROM ads WHERE id = ?
-	`, id).Scan(
-		&ad.ID, &ad.Title, &ad.MediaURL, &ad.MediaType, &ad.DurationSeconds,
-		&ad.OrderIndex, &ad.IsEnabled, &ad.TargetLocations, &ad.CreatedBy,
-		&ad.IsDeleted, &ad.Description, &ad.CompanyName, &ad.ContactInfo,
-		&ad.WebsiteURL, &ad.GalleryImages, &ad.TotalViews, &ad.CreatedAt, &ad.UpdatedAt,
-	)
+	ad, err := loadAd(id)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
 		return
@@ -296,11 +716,26 @@ func (h *AdHandler) UpdateAd(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, audit.ActionAdUpdated, "ad", ad.ID, before, ad)
+	notifyContentChanged(ad.OrgID)
+
 	c.JSON(http.StatusOK, ad)
 }
 
 func (h *AdHandler) DeleteAd(c *gin.Context) {
 	id := c.Param("id")
+	if !authorizeAdAccess(c, id) {
+		return
+	}
+	before, err := loadOrgAd(c, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
 
 	result, err := database.DB.Exec(`
 		UPDATE ads SET is_deleted = true
@@ -317,6 +752,9 @@ func (h *AdHandler) DeleteAd(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, audit.ActionAdDeleted, "ad", id, before, nil)
+	notifyContentChanged(before.OrgID)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Ad deleted successfully"})
 }
 
@@ -334,11 +772,6 @@ func (h *AdHandler) UploadMedia(c *gin.Context) {
 		return
 	}
 
-	// Generate unique filename
-	ext := filepath.Ext(file.Filename)
-	filename := uuid.New().String() + ext
-	filepath := filepath.Join(h.cfg.UploadPath, filename)
-
 	// Open uploaded file
 	src, err := file.Open()
 	if err != nil {
@@ -347,26 +780,16 @@ func (h *AdHandler) UploadMedia(c *gin.Context) {
 	}
 	defer src.Close()
 
-	// Create destination file
-	dst, err := os.Create(filepath)
+	asset, err := h.saveMedia(c, file.Filename, src, file.Size)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
-		return
-	}
-	defer dst.Close()
-
-	// Copy file
-	if _, err = io.Copy(dst, src); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		mediaUploadError(c, err)
 		return
 	}
 
-	// Return URL (adjust based on your server configuration)
-	url := "/uploads/" + filename
-
 	c.JSON(http.StatusOK, gin.H{
-		"url":      url,
-		"filename": filename,
+		"url":      asset.URL,
+		"filename": asset.StorageKey,
+		"asset":    asset,
 	})
 }
 
@@ -390,8 +813,24 @@ func (h *AdHandler) ReorderAds(c *gin.Context) {
 	}
 	defer tx.Rollback()
 
+	// Order indexes keyed by ad ID, so the audit diff shows which ads moved
+	before := map[string]int{}
+	after := map[string]int{}
 	for _, item := range req.Orders {
-		_, err := tx.Exec(`
+		var current int
+		var orgID string
+		err := tx.QueryRow("SELECT order_index, org_id FROM ads WHERE id = ? FOR UPDATE", item.ID).Scan(&current, &orgID)
+		if err == sql.ErrNoRows || (err == nil && !inOrg(c, orgID)) {
+			// Unknown ads and those of other organizations are skipped
+			continue
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder ads"})
+			return
+		}
+		before[item.ID] = current
+
+		_, err = tx.Exec(`
 			UPDATE ads SET order_index = ?
 			WHERE id = ?
 		`, item.Order, item.ID)
@@ -399,6 +838,7 @@ func (h *AdHandler) ReorderAds(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder ads"})
 			return
 		}
+		after[item.ID] = item.Order
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -406,18 +846,22 @@ func (h *AdHandler) ReorderAds(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, audit.ActionAdsReordered, "ad", "", before, after)
+	notifyContentChanged(orgScope(c))
+
 	c.JSON(http.StatusOK, gin.H{"message": "Ads reordered successfully"})
 }
+
 // TrackAdView - mencatat view count untuk setiap ad
 func (h *AdHandler) TrackAdView(c *gin.Context) {
 	id := c.Param("id")
 
-	// Increment view count
+	// Increment view count; devices only count ads of their organization
 	_, err := database.DB.Exec(`
 		UPDATE ads SET total_views = total_views + 1
-		WHERE id = ? AND is_deleted = false
-	`, id)
-	
+		WHERE id = ? AND org_id = ? AND is_deleted = false
+	`, id, c.GetString("device_org_id"))
+
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to track view"})
 		return
@@ -434,17 +878,14 @@ func (h *AdHandler) GetAdsByCompany(c *gin.Context) {
 		return
 	}
 
+	orgSQL, args := orgFilter(c, "org_id")
 	rows, err := database.DB.Query(`
-		SELECT id, title, media_url, media_type, duration_seconds, order_index,
-		       is_enabled, target_locations, created_by, is_deleted,
-		       description, company_name, contact_info, website_url,
-		       COALESCE(gallery_images, '[]'), COALESCE(total_views, 0),
-		       created_at, updated_at
+		SELECT `+adColumns+`
 		FROM ads
-		WHERE company_name = ? AND is_deleted = false
+		WHERE company_name = ? AND is_deleted = false AND status = ? AND `+orgSQL+`
 		ORDER BY order_index ASC
-	`, companyName)
-	
+	`, append([]interface{}{companyName, models.AdStatusApproved}, args...)...)
+
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ads"})
 		return
@@ -456,12 +897,7 @@ func (h *AdHandler) GetAdsByCompany(c *gin.Context) {
 
 	for rows.Next() {
 		var ad models.Ad
-		err := rows.Scan(
-			&ad.ID, &ad.Title, &ad.MediaURL, &ad.MediaType, &ad.DurationSeconds,
-			&ad.OrderIndex, &ad.IsEnabled, &ad.TargetLocations, &ad.CreatedBy,
-			&ad.IsDeleted, &ad.Description, &ad.CompanyName, &ad.ContactInfo,
-			&ad.WebsiteURL, &ad.GalleryImages, &ad.TotalViews, &ad.CreatedAt, &ad.UpdatedAt,
-		)
+		err := rows.Scan(adScanDest(&ad)...)
 		if err != nil {
 			continue
 		}
@@ -488,10 +924,11 @@ func (h *AdHandler) CheckCompanyUploadLimit(c *gin.Context) {
 	const MAX_ADS_PER_COMPANY = 2
 
 	var count int
+	orgSQL, args := orgFilter(c, "org_id")
 	err := database.DB.QueryRow(`
 		SELECT COUNT(*) FROM ads 
-		WHERE company_name = ? AND is_deleted = false
-	`, companyName).Scan(&count)
+		WHERE company_name = ? AND is_deleted = false AND `+orgSQL,
+		append([]interface{}{companyName}, args...)...).Scan(&count)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check limit"})
@@ -506,10 +943,10 @@ func (h *AdHandler) CheckCompanyUploadLimit(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"company":           companyName,
-		"current_ads":       count,
-		"max_ads":           MAX_ADS_PER_COMPANY,
-		"can_upload":        canUpload,
-		"remaining_quota":   remaining,
+		"company":         companyName,
+		"current_ads":     count,
+		"max_ads":         MAX_ADS_PER_COMPANY,
+		"can_upload":      canUpload,
+		"remaining_quota": remaining,
 	})
-}
\ No newline at end of file
+}
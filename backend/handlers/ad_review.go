@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"digital-signage-backend/audit"
+	"digital-signage-backend/database"
+	"digital-signage-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SubmitAd sends a draft or rejected ad to review.
+func (h *AdHandler) SubmitAd(c *gin.Context) {
+	if req, ok := bindAdStatusRequest(c); ok {
+		transitionAd(c, models.AdStatusSubmitted, req.Comment, audit.ActionAdSubmitted)
+	}
+}
+
+// ArchiveAd takes an ad out of rotation and out of the review queue.
+func (h *AdHandler) ArchiveAd(c *gin.Context) {
+	if req, ok := bindAdStatusRequest(c); ok {
+		transitionAd(c, models.AdStatusArchived, req.Comment, audit.ActionAdArchived)
+	}
+}
+
+// RestoreAd turns an archived ad back into a draft. It has to be submitted
+// and approved again before it is shown.
+func (h *AdHandler) RestoreAd(c *gin.Context) {
+	if req, ok := bindAdStatusRequest(c); ok {
+		transitionAd(c, models.AdStatusDraft, req.Comment, audit.ActionAdRestored)
+	}
+}
+
+// ReviewAd approves or rejects a submitted ad. A rejection needs a comment
+// telling the author what to change.
+func (h *AdHandler) ReviewAd(c *gin.Context) {
+	var req models.AdReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	comment := strings.TrimSpace(req.Comment)
+
+	if req.Decision == "reject" {
+		if comment == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A comment is required when rejecting an ad"})
+			return
+		}
+		transitionAd(c, models.AdStatusRejected, comment, audit.ActionAdRejected)
+		return
+	}
+	transitionAd(c, models.AdStatusApproved, comment, audit.ActionAdApproved)
+}
+
+// GetAdReviews lists the review history of an ad, newest first.
+func (h *AdHandler) GetAdReviews(c *gin.Context) {
+	id := c.Param("id")
+	if !authorizeAdAccess(c, id) {
+		return
+	}
+	ad, err := loadOrgAd(c, id)
+	if err == sql.ErrNoRows || (err == nil && ad.IsDeleted) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT id, ad_id, from_status, to_status, COALESCE(comment, ''), actor_id, COALESCE(actor_email, ''), created_at
+		FROM ad_reviews
+		WHERE ad_id = ?
+		ORDER BY created_at DESC, id
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+		return
+	}
+	defer rows.Close()
+
+	reviews := []models.AdReview{}
+	for rows.Next() {
+		var r models.AdReview
+		if err := rows.Scan(&r.ID, &r.AdID, &r.FromStatus, &r.ToStatus, &r.Comment, &r.ActorID, &r.ActorEmail, &r.CreatedAt); err != nil {
+			continue
+		}
+		reviews = append(reviews, r)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ad_id":   id,
+		"status":  ad.Status,
+		"reviews": reviews,
+	})
+}
+
+// bindAdStatusRequest reads the optional body of the submit, archive and
+// restore endpoints. It writes the error response and returns false when
+// the body is invalid.
+func bindAdStatusRequest(c *gin.Context) (models.AdStatusRequest, bool) {
+	var req models.AdStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return req, false
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+	return req, true
+}
+
+// transitionAd moves the ad named by the :id parameter to status to,
+// recording the step in its review history and the audit log.
+func transitionAd(c *gin.Context, to, comment, action string) {
+	id := c.Param("id")
+	if !authorizeAdAccess(c, id) {
+		return
+	}
+
+	before, err := loadOrgAd(c, id)
+	if err == sql.ErrNoRows || (err == nil && before.IsDeleted) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !models.CanTransitionAd(before.Status, to) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Cannot move a %s ad to %s", before.Status, to)})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Only move the ad if nobody else moved it since it was loaded
+	result, err := tx.Exec("UPDATE ads SET status = ? WHERE id = ? AND status = ?", to, id, before.Status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ad"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "The ad was changed in the meantime, please reload it"})
+		return
+	}
+	if err := insertAdReview(c, tx, id, before.Status, to, comment); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ad"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	ad, err := loadAd(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get updated ad"})
+		return
+	}
+
+	entry := auditEntry(c, action, "ad", id, before, ad)
+	if comment != "" {
+		entry.Details = map[string]interface{}{"comment": comment}
+	}
+	audit.Record(entry)
+	// Screens only care when an ad starts or stops being approved
+	if before.Status == models.AdStatusApproved || to == models.AdStatusApproved {
+		notifyContentChanged(ad.OrgID)
+	}
+
+	c.JSON(http.StatusOK, ad)
+}
+
+// insertAdReview adds a step to the review history of an ad, attributed to
+// the caller.
+func insertAdReview(c *gin.Context, tx *sql.Tx, adID, from, to, comment string) error {
+	_, err := tx.Exec(`
+		INSERT INTO ad_reviews (id, ad_id, from_status, to_status, comment, actor_id, actor_email)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''))
+	`, uuid.New().String(), adID, from, to, comment, c.GetString("user_id"), c.GetString("user_email"))
+	return err
+}
+
+// mediaChanged reports whether an update replaces what the ad shows.
+func mediaChanged(ad models.Ad, req models.UpdateAdRequest) bool {
+	if req.MediaURL != nil && *req.MediaURL != ad.MediaURL {
+		return true
+	}
+	if req.MediaType != nil && *req.MediaType != ad.MediaType {
+		return true
+	}
+	if req.GalleryImages == nil {
+		return false
+	}
+	if len(req.GalleryImages) != len(ad.GalleryImages) {
+		return true
+	}
+	for i, image := range req.GalleryImages {
+		if image != ad.GalleryImages[i] {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"database/sql"
 	"net/http"
 	"time"
 
@@ -27,12 +28,30 @@ func (h *AnalyticsHandler) CreateImpression(c *gin.Context) {
 		return
 	}
 
+	// Devices may only record impressions for themselves
+	if !authorizeDevice(c, req.DeviceID) {
+		return
+	}
+	// ...and for ads of their own organization
+	var adExists bool
+	err := database.DB.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM ads WHERE id = ? AND org_id = ?)", req.AdID, c.GetString("device_org_id"),
+	).Scan(&adExists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !adExists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+
 	// Insert impression
 	impressionID := uuid.New().String()
-	_, err := database.DB.Exec(`
+	_, err = database.DB.Exec(`
 		INSERT INTO impressions (id, ad_id, device_id)
 		VALUES (?, ?, ?)
-	`, impressionID, req.AdID, req.DeviceID)
+	`, impressionID, req.AdID, c.GetString("device_row_id"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create impression"})
 		return
@@ -88,12 +107,13 @@ func (h *AnalyticsHandler) GetAnalytics(c *gin.Context) {
 		}
 	}
 
+	orgSQL, orgArgs := orgFilter(c, "ad.org_id")
 	sqlQuery := `
 		SELECT a.id, a.ad_id, a.date, a.impressions, a.unique_devices, a.created_at, a.updated_at
 		FROM ad_analytics a
-		WHERE a.date BETWEEN ? AND ?
-	`
-	args := []interface{}{startDate.Format("2006-01-02"), endDate.Format("2006-01-02")}
+		JOIN ads ad ON ad.id = a.ad_id
+		WHERE a.date BETWEEN ? AND ? AND ` + orgSQL
+	args := append([]interface{}{startDate.Format("2006-01-02"), endDate.Format("2006-01-02")}, orgArgs...)
 
 	if query.AdID != "" {
 		sqlQuery += " AND a.ad_id = ?"
@@ -127,18 +147,20 @@ func (h *AnalyticsHandler) GetAnalytics(c *gin.Context) {
 
 func (h *AnalyticsHandler) GetDashboardStats(c *gin.Context) {
 	stats := gin.H{}
+	orgSQL, orgArgs := orgFilter(c, "org_id")
+	adOrgSQL, _ := orgFilter(c, "ad.org_id")
 
 	// Total ads
 	var totalAds, activeAds int
-	database.DB.QueryRow("SELECT COUNT(*) FROM ads WHERE is_deleted = false").Scan(&totalAds)
-	database.DB.QueryRow("SELECT COUNT(*) FROM ads WHERE is_deleted = false AND is_enabled = true").Scan(&activeAds)
+	database.DB.QueryRow("SELECT COUNT(*) FROM ads WHERE is_deleted = false AND "+orgSQL, orgArgs...).Scan(&totalAds)
+	database.DB.QueryRow("SELECT COUNT(*) FROM ads WHERE is_deleted = false AND is_enabled = true AND status = 'approved' AND "+orgSQL, orgArgs...).Scan(&activeAds)
 	stats["total_ads"] = totalAds
 	stats["active_ads"] = activeAds
 
 	// Total devices
 	var totalDevices, onlineDevices int
-	database.DB.QueryRow("SELECT COUNT(*) FROM devices").Scan(&totalDevices)
-	database.DB.QueryRow("SELECT COUNT(*) FROM devices WHERE is_online = true").Scan(&onlineDevices)
+	database.DB.QueryRow("SELECT COUNT(*) FROM devices WHERE "+orgSQL, orgArgs...).Scan(&totalDevices)
+	database.DB.QueryRow("SELECT COUNT(*) FROM devices WHERE is_online = true AND "+orgSQL, orgArgs...).Scan(&onlineDevices)
 	stats["total_devices"] = totalDevices
 	stats["online_devices"] = onlineDevices
 
@@ -146,16 +168,20 @@ func (h *AnalyticsHandler) GetDashboardStats(c *gin.Context) {
 	var todayImpressions int
 	today := time.Now().Format("2006-01-02")
 	database.DB.QueryRow(`
-		SELECT COALESCE(SUM(impressions), 0) FROM ad_analytics WHERE date = ?
-	`, today).Scan(&todayImpressions)
+		SELECT COALESCE(SUM(a.impressions), 0) FROM ad_analytics a
+		JOIN ads ad ON ad.id = a.ad_id
+		WHERE a.date = ? AND `+adOrgSQL,
+		append([]interface{}{today}, orgArgs...)...).Scan(&todayImpressions)
 	stats["today_impressions"] = todayImpressions
 
 	// Total impressions (last 30 days)
 	var totalImpressions int
 	thirtyDaysAgo := time.Now().AddDate(0, 0, -30).Format("2006-01-02")
 	database.DB.QueryRow(`
-		SELECT COALESCE(SUM(impressions), 0) FROM ad_analytics WHERE date >= ?
-	`, thirtyDaysAgo).Scan(&totalImpressions)
+		SELECT COALESCE(SUM(a.impressions), 0) FROM ad_analytics a
+		JOIN ads ad ON ad.id = a.ad_id
+		WHERE a.date >= ? AND `+adOrgSQL,
+		append([]interface{}{thirtyDaysAgo}, orgArgs...)...).Scan(&totalImpressions)
 	stats["total_impressions_30d"] = totalImpressions
 
 	// Top performing ads (last 7 days)
@@ -164,11 +190,11 @@ func (h *AnalyticsHandler) GetDashboardStats(c *gin.Context) {
 		SELECT a.ad_id, ad.title, SUM(a.impressions) as total
 		FROM ad_analytics a
 		JOIN ads ad ON a.ad_id = ad.id
-		WHERE a.date >= ?
+		WHERE a.date >= ? AND `+adOrgSQL+`
 		GROUP BY a.ad_id, ad.title
 		ORDER BY total DESC
 		LIMIT 5
-	`, sevenDaysAgo)
+	`, append([]interface{}{sevenDaysAgo}, orgArgs...)...)
 	if err == nil {
 		topAds := []gin.H{}
 		for rows.Next() {
@@ -191,6 +217,13 @@ func (h *AnalyticsHandler) GetDashboardStats(c *gin.Context) {
 
 func (h *AnalyticsHandler) GetAdPerformance(c *gin.Context) {
 	adID := c.Param("id")
+	if _, err := loadOrgAd(c, adID); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
 	days := 30
 
 	if daysParam := c.Query("days"); daysParam != "" {
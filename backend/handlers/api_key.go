@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"digital-signage-backend/audit"
+	"digital-signage-backend/config"
+	"digital-signage-backend/database"
+	"digital-signage-backend/models"
+	"digital-signage-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// apiKeyPrefixLength is how much of a key is kept in clear to recognise it.
+const apiKeyPrefixLength = 12
+
+// apiKeyColumns is the column list scanned by apiKeyScanDest.
+const apiKeyColumns = `id, org_id, name, prefix, scopes, created_by, expires_at, last_used_at,
+		       COALESCE(last_used_ip, ''), revoked_at, created_at`
+
+func apiKeyScanDest(key *models.APIKey) []interface{} {
+	return []interface{}{
+		&key.ID, &key.OrgID, &key.Name, &key.Prefix, &key.Scopes, &key.CreatedBy, &key.ExpiresAt,
+		&key.LastUsedAt, &key.LastUsedIP, &key.RevokedAt, &key.CreatedAt,
+	}
+}
+
+type APIKeyHandler struct {
+	cfg *config.Config
+}
+
+func NewAPIKeyHandler(cfg *config.Config) *APIKeyHandler {
+	return &APIKeyHandler{cfg: cfg}
+}
+
+func (h *APIKeyHandler) GetAPIKeys(c *gin.Context) {
+	orgSQL, args := orgFilter(c, "org_id")
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys WHERE ` + orgSQL
+	if c.Query("include_revoked") != "true" {
+		query += " AND revoked_at IS NULL"
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		if err := rows.Scan(apiKeyScanDest(&key)...); err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateAPIKey issues a key. Its scopes must be permissions the caller holds
+// themselves, and the key is shown only in this response. Like its owner,
+// the key is bound to the caller's organization.
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name must not be empty"})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	role := c.GetString("user_role")
+	scopes := models.Scopes{}
+	seen := map[string]bool{}
+	for _, scope := range req.Scopes {
+		if seen[scope] {
+			continue
+		}
+		seen[scope] = true
+		if !models.IsGrantableScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown or ungrantable scope %q", scope)})
+			return
+		}
+		if !models.HasPermission(role, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("You cannot grant a scope you don't have: %s", scope)})
+			return
+		}
+		scopes = append(scopes, scope)
+	}
+
+	key, err := utils.GenerateSecureToken(models.APIKeyPrefix, 32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	keyID := uuid.New().String()
+	_, err = database.DB.Exec(`
+		INSERT INTO api_keys (id, org_id, name, prefix, key_hash, scopes, created_by, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, keyID, c.GetString("org_id"), req.Name, key[:apiKeyPrefixLength], utils.HashToken(key), scopes, c.GetString("user_id"), req.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	apiKey, err := loadAPIKey(keyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve created API key"})
+		return
+	}
+
+	recordAudit(c, audit.ActionAPIKeyCreated, "api_key", apiKey.ID, nil, apiKey)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": apiKey,
+		"key":     key,
+	})
+}
+
+// RevokeAPIKey disables a key for good. The row is kept so its history
+// stays visible.
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	orgSQL, args := orgFilter(c, "org_id")
+	result, err := database.DB.Exec(`
+		UPDATE api_keys SET revoked_at = NOW()
+		WHERE id = ? AND revoked_at IS NULL AND `+orgSQL,
+		append([]interface{}{c.Param("id")}, args...)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	recordAudit(c, audit.ActionAPIKeyRevoked, "api_key", c.Param("id"), nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
+
+func loadAPIKey(id string) (models.APIKey, error) {
+	var key models.APIKey
+	err := database.DB.QueryRow(`
+		SELECT `+apiKeyColumns+`
+		FROM api_keys WHERE id = ?
+	`, id).Scan(apiKeyScanDest(&key)...)
+	return key, err
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"digital-signage-backend/audit"
+	"digital-signage-backend/config"
+	"digital-signage-backend/database"
+	"digital-signage-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditColumns is the column list scanned by auditScanDest.
+const auditColumns = `id, org_id, actor_id, COALESCE(actor_email, ''), api_key_id, action, target_type, target_id,
+		       COALESCE(ip_address, ''), before_data, after_data, changes, details, created_at`
+
+// The JSON columns are scanned as *[]byte, which unlike *json.RawMessage
+// accepts NULL.
+func auditScanDest(e *models.AuditLogEntry) []interface{} {
+	return []interface{}{
+		&e.ID, &e.OrgID, &e.ActorID, &e.ActorEmail, &e.APIKeyID, &e.Action, &e.TargetType, &e.TargetID,
+		&e.IPAddress, (*[]byte)(&e.Before), (*[]byte)(&e.After), (*[]byte)(&e.Changes), (*[]byte)(&e.Details),
+		&e.CreatedAt,
+	}
+}
+
+// recordAudit logs a change made by the caller of the request. before and
+// after are the entity as it was and as it is now; either is nil when the
+// entity was created or deleted.
+func recordAudit(c *gin.Context, action, targetType, targetID string, before, after interface{}) {
+	audit.Record(auditEntry(c, action, targetType, targetID, before, after))
+}
+
+func auditEntry(c *gin.Context, action, targetType, targetID string, before, after interface{}) audit.Entry {
+	orgID := c.GetString("org_id")
+	if orgID == "" {
+		orgID = c.GetString("device_org_id")
+	}
+	return audit.Entry{
+		OrgID:      orgID,
+		ActorID:    c.GetString("user_id"),
+		ActorEmail: c.GetString("user_email"),
+		APIKeyID:   c.GetString("api_key_id"),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IPAddress:  c.ClientIP(),
+		Before:     before,
+		After:      after,
+	}
+}
+
+// selfAuditEntry is an entry for something users do to their own account
+// before the request is authenticated, like logging in.
+func selfAuditEntry(c *gin.Context, action, userID, email, orgID string) audit.Entry {
+	entry := auditEntry(c, action, "user", userID, nil, nil)
+	entry.OrgID, entry.ActorID, entry.ActorEmail = orgID, userID, email
+	return entry
+}
+
+// recordLogin logs a session started by method: password or two_factor.
+func recordLogin(c *gin.Context, user models.User, method string) {
+	entry := selfAuditEntry(c, audit.ActionLogin, user.ID, user.Email, user.OrgID)
+	entry.Details = map[string]interface{}{"method": method}
+	audit.Record(entry)
+}
+
+type AuditHandler struct {
+	cfg *config.Config
+}
+
+func NewAuditHandler(cfg *config.Config) *AuditHandler {
+	return &AuditHandler{cfg: cfg}
+}
+
+// GetAuditLog lists audit entries of the caller's organization, newest
+// first. Optional filters: actor_id, action (a trailing "*" matches a
+// prefix, e.g. "ad.*"), target_type, target_id, from and to (RFC3339).
+func (h *AuditHandler) GetAuditLog(c *gin.Context) {
+	whereSQL, args, err := auditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, limit := pagination(c)
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM audit_log WHERE "+whereSQL, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT `+auditColumns+`
+		FROM audit_log WHERE `+whereSQL+`
+		ORDER BY created_at DESC, id
+		LIMIT ? OFFSET ?
+	`, append(args, limit, (page-1)*limit)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.AuditLogEntry{}
+	for rows.Next() {
+		var entry models.AuditLogEntry
+		if err := rows.Scan(auditScanDest(&entry)...); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// ExportAuditLog streams the entries matching the same filters as
+// GetAuditLog as CSV. The full snapshots are left out; changes has the diff.
+func (h *AuditHandler) ExportAuditLog(c *gin.Context) {
+	whereSQL, args, err := auditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT `+auditColumns+`
+		FROM audit_log WHERE `+whereSQL+`
+		ORDER BY created_at DESC, id
+	`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("audit-log-%s.csv", time.Now().Format("20060102-150405"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{
+		"created_at", "org_id", "actor_id", "actor_email", "api_key_id", "action",
+		"target_type", "target_id", "ip_address", "changes", "details",
+	})
+	for rows.Next() {
+		var e models.AuditLogEntry
+		if err := rows.Scan(auditScanDest(&e)...); err != nil {
+			continue
+		}
+		w.Write([]string{
+			e.CreatedAt.UTC().Format(time.RFC3339), stringValue(e.OrgID), stringValue(e.ActorID), e.ActorEmail, stringValue(e.APIKeyID),
+			e.Action, e.TargetType, e.TargetID, e.IPAddress, string(e.Changes), string(e.Details),
+		})
+	}
+	w.Flush()
+}
+
+// auditFilter builds the WHERE clause shared by the list and the export.
+func auditFilter(c *gin.Context) (string, []interface{}, error) {
+	orgSQL, args := orgFilter(c, "org_id")
+	where := []string{orgSQL}
+	for _, column := range []string{"actor_id", "target_type", "target_id"} {
+		if value := c.Query(column); value != "" {
+			where = append(where, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	if action := c.Query("action"); action != "" {
+		if strings.HasSuffix(action, "*") {
+			where = append(where, "action LIKE ?")
+			args = append(args, strings.TrimSuffix(action, "*")+"%")
+		} else {
+			where = append(where, "action = ?")
+			args = append(args, action)
+		}
+	}
+	for _, bound := range []struct{ param, op string }{{"from", ">="}, {"to", "<"}} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s must be an RFC3339 time", bound.param)
+		}
+		where = append(where, "created_at "+bound.op+" ?")
+		args = append(args, t)
+	}
+	return strings.Join(where, " AND "), args, nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -3,9 +3,14 @@ package handlers
 import (
 	"database/sql"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
+	"digital-signage-backend/audit"
 	"digital-signage-backend/config"
 	"digital-signage-backend/database"
+	"digital-signage-backend/mailer"
 	"digital-signage-backend/models"
 	"digital-signage-backend/utils"
 
@@ -48,41 +53,65 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// Create user
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Registration only bootstraps the install: the very first account
+	// becomes super admin, everyone after that joins by invite. Locking the
+	// default organization makes concurrent registrations take turns, so
+	// only one of them can see an empty users table.
+	var orgID string
+	if err := tx.QueryRow("SELECT id FROM organizations WHERE id = ? FOR UPDATE", models.DefaultOrgID).Scan(&orgID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var hasUsers bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users)").Scan(&hasUsers); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if hasUsers {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Registration is closed, ask an admin for an invite"})
+		return
+	}
+
 	userID := uuid.New().String()
-	var user models.User
-	err = database.DB.QueryRow(`
-		INSERT INTO users (id, email, password_hash, display_name, role)
-		VALUES (?, ?, ?, ?, 'admin')
-	`, userID, req.Email, hashedPassword, req.DisplayName).Err()
+	_, err = tx.Exec(`
+		INSERT INTO users (id, org_id, email, password_hash, display_name, role)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, userID, orgID, req.Email, hashedPassword, req.DisplayName, models.RoleSuperAdmin)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
 
 	// Get created user
-	err = database.DB.QueryRow(`
-		SELECT id, email, display_name, role, created_at, updated_at
-		FROM users WHERE id = ?
-	`, userID).Scan(
-		&user.ID, &user.Email, &user.DisplayName, &user.Role, &user.CreatedAt, &user.UpdatedAt,
-	)
+	user, err := loadUser(userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
-	// Generate token
-	token, err := utils.GenerateToken(user.ID, user.Email, user.Role, h.cfg.JWTSecret)
+	// Start a session
+	response, err := h.issueSession(c, user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, models.AuthResponse{
-		Token: token,
-		User:  user,
-	})
+	entry := selfAuditEntry(c, audit.ActionRegistered, user.ID, user.Email, user.OrgID)
+	entry.After = user
+	audit.Record(entry)
+
+	c.JSON(http.StatusCreated, response)
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -92,60 +121,75 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	keys := loginKeys(c, req.Email)
+	if h.throttled(c, keys...) {
+		return
+	}
+
 	// Get user
 	var user models.User
 	err := database.DB.QueryRow(`
-		SELECT id, email, password_hash, display_name, role, created_at, updated_at
+		SELECT password_hash, `+userColumns+`
 		FROM users WHERE email = ?
-	`, req.Email).Scan(
-		&user.ID, &user.Email, &user.PasswordHash, &user.DisplayName, &user.Role, &user.CreatedAt, &user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
+	`, req.Email).Scan(append([]interface{}{&user.PasswordHash}, userScanDest(&user)...)...)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Check password. Unknown emails count as failures too so they look
+	// the same from outside
+	if err == sql.ErrNoRows || !utils.CheckPassword(req.Password, user.PasswordHash) {
+		if err := h.recordFailures(c, keys...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	// The IP keeps its count so one good account can't cover guessing others
+	clearFailures(keys[0])
+
+	if user.IsDisabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
 		return
 	}
 
-	// Check password
-	if !utils.CheckPassword(req.Password, user.PasswordHash) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+	// With 2FA the password only earns a token for /auth/login/2fa
+	if user.TwoFactorEnabled {
+		challenge, err := h.twoFactorChallenge(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, challenge)
 		return
 	}
 
-	// Generate token
-	token, err := utils.GenerateToken(user.ID, user.Email, user.Role, h.cfg.JWTSecret)
+	// Start a session
+	response, err := h.issueSession(c, user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
+	recordLogin(c, user, "password")
 
-	c.JSON(http.StatusOK, models.AuthResponse{
-		Token: token,
-		User:  user,
-	})
+	c.JSON(http.StatusOK, response)
 }
 
 func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-
-	var user models.User
-	err := database.DB.QueryRow(`
-		SELECT id, email, display_name, role, created_at, updated_at
-		FROM users WHERE id = ?
-	`, userID).Scan(
-		&user.ID, &user.Email, &user.DisplayName, &user.Role, &user.CreatedAt, &user.UpdatedAt,
-	)
+	user, err := loadUser(c.GetString("user_id"))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
+	user.Permissions = models.RolePermissions[user.Role]
 
 	c.JSON(http.StatusOK, user)
 }
 
+// ResetPassword emails a one-time reset link. The response is the same
+// whether or not the email belongs to an account.
 func (h *AuthHandler) ResetPassword(c *gin.Context) {
 	var req models.ResetPasswordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -153,41 +197,123 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	// Check if user exists
-	var exists bool
-	err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = ?)", req.Email).Scan(&exists)
-	if err != nil {
+	// Every request counts, whether or not the email exists
+	keys := resetKeys(c, req.Email)
+	if h.throttled(c, keys...) {
+		return
+	}
+	if err := h.recordFailures(c, keys...); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
-	if !exists {
+	response := gin.H{"message": "If the email exists, a reset link will be sent"}
+
+	var userID, orgID, displayName string
+	var disabled bool
+	err := database.DB.QueryRow(
+		"SELECT id, org_id, display_name, is_disabled FROM users WHERE email = ?", req.Email,
+	).Scan(&userID, &orgID, &displayName, &disabled)
+	if err == sql.ErrNoRows || (err == nil && disabled) {
 		// Don't reveal if email exists or not for security
-		c.JSON(http.StatusOK, gin.H{"message": "If the email exists, a reset link will be sent"})
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
-	// Generate temporary password (in production, send email with reset link)
-	tempPassword := uuid.New().String()[:8]
-	hashedPassword, err := utils.HashPassword(tempPassword)
+	token, err := utils.GenerateSecureToken("rst_", 32)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate password"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset token"})
 		return
 	}
 
+	// Only the newest link works
+	if _, err := database.DB.Exec("DELETE FROM password_reset_tokens WHERE user_id = ? AND used_at IS NULL", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset token"})
+		return
+	}
+
+	ttl := time.Duration(h.cfg.PasswordResetTTLMinutes) * time.Minute
 	_, err = database.DB.Exec(`
-		UPDATE users SET password_hash = ?, updated_at = NOW()
-		WHERE email = ?
-	`, hashedPassword, req.Email)
+		INSERT INTO password_reset_tokens (id, user_id, token_hash, expires_at, requested_ip)
+		VALUES (?, ?, ?, ?, ?)
+	`, uuid.New().String(), userID, utils.HashToken(token), time.Now().Add(ttl), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset token"})
+		return
+	}
+	audit.Record(selfAuditEntry(c, audit.ActionPasswordResetRequested, userID, req.Email, orgID))
+
+	link := strings.TrimRight(h.cfg.AppBaseURL, "/") + "/reset-password?token=" + url.QueryEscape(token)
+	mailer.SendAsync(mailer.PasswordResetMessage(req.Email, displayName, h.cfg.PasswordResetTTLMinutes, link))
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ConfirmResetPassword sets a new password using a reset token. The token
+// is spent even if it is presented again concurrently.
+func (h *AuthHandler) ConfirmResetPassword(c *gin.Context) {
+	var req models.ConfirmResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var tokenID, userID, orgID string
+	var expiresAt time.Time
+	var usedAt *time.Time
+	err = tx.QueryRow(`
+		SELECT t.id, t.user_id, u.org_id, t.expires_at, t.used_at
+		FROM password_reset_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ?
+		FOR UPDATE
+	`, utils.HashToken(req.Token)).Scan(&tokenID, &userID, &orgID, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows || (err == nil && (usedAt != nil || time.Now().After(expiresAt))) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE password_reset_tokens SET used_at = NOW() WHERE id = ?", tokenID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
 		return
 	}
+	if _, err := tx.Exec("UPDATE users SET password_hash = ?, updated_at = NOW() WHERE id = ?", hashedPassword, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	// Whoever knew the old password is logged out everywhere
+	if _, err := revokeUserSessions(tx, userID, models.SessionRevokedPasswordReset); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	audit.Record(selfAuditEntry(c, audit.ActionPasswordReset, userID, "", orgID))
 
-	// In production, send this via email instead
-	c.JSON(http.StatusOK, gin.H{
-		"message":          "Password reset successful",
-		"temporary_password": tempPassword,
-		"note":             "In production, this would be sent via email",
-	})
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
 }
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"digital-signage-backend/audit"
+	"digital-signage-backend/config"
+	"digital-signage-backend/database"
+	"digital-signage-backend/models"
+	"digital-signage-backend/realtime"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const defaultCommandTTL = time.Hour
+
+const commandColumns = `id, device_id, command, COALESCE(payload, JSON_OBJECT()), status,
+		       COALESCE(result, JSON_OBJECT()), COALESCE(error_message, ''), created_by,
+		       created_at, expires_at, delivered_at, completed_at`
+
+func commandScanDest(cmd *models.DeviceCommand) []interface{} {
+	return []interface{}{
+		&cmd.ID, &cmd.DeviceID, &cmd.Command, &cmd.Payload, &cmd.Status,
+		&cmd.Result, &cmd.ErrorMessage, &cmd.CreatedBy,
+		&cmd.CreatedAt, &cmd.ExpiresAt, &cmd.DeliveredAt, &cmd.CompletedAt,
+	}
+}
+
+type CommandHandler struct {
+	cfg *config.Config
+}
+
+func NewCommandHandler(cfg *config.Config) *CommandHandler {
+	return &CommandHandler{cfg: cfg}
+}
+
+// CreateCommand queues a command for a device. Devices with an open push
+// channel are told right away; others pick it up with their next heartbeat.
+func (h *CommandHandler) CreateCommand(c *gin.Context) {
+	var req models.CreateCommandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	device, err := findOrgDevice(c, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if len(req.Payload) == 0 || string(req.Payload) == "null" {
+		req.Payload = json.RawMessage("{}")
+	}
+	if req.Command == models.CommandSetVolume {
+		var payload models.SetVolumePayload
+		if err := json.Unmarshal(req.Payload, &payload); err != nil || payload.Volume == nil ||
+			*payload.Volume < 0 || *payload.Volume > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "set_volume requires payload.volume between 0 and 100"})
+			return
+		}
+	}
+
+	ttl := defaultCommandTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+
+	userID, _ := c.Get("user_id")
+	commandID := uuid.New().String()
+	_, err = database.DB.Exec(`
+		INSERT INTO device_commands (id, device_id, command, payload, status, created_by, expires_at)
+		VALUES (?, ?, ?, ?, 'pending', ?, ?)
+	`, commandID, device.ID, req.Command, []byte(req.Payload), userID, time.Now().Add(ttl))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue command"})
+		return
+	}
+
+	cmd, err := loadCommand(commandID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve command"})
+		return
+	}
+
+	realtime.Default.Publish(device.ID, realtime.Event{Type: realtime.EventCommand, Data: cmd})
+	entry := auditEntry(c, audit.ActionDeviceCommandSent, "device", device.ID, nil, cmd)
+	entry.OrgID = device.OrgID
+	audit.Record(entry)
+
+	c.JSON(http.StatusCreated, cmd)
+}
+
+func (h *CommandHandler) GetCommands(c *gin.Context) {
+	device, err := findOrgDevice(c, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	expireCommands(device.ID)
+
+	query := `
+		SELECT ` + commandColumns + `
+		FROM device_commands
+		WHERE device_id = ?
+	`
+	args := []interface{}{device.ID}
+	if status := c.Query("status"); status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY created_at DESC LIMIT 100"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch commands"})
+		return
+	}
+	defer rows.Close()
+
+	commands := []models.DeviceCommand{}
+	for rows.Next() {
+		var cmd models.DeviceCommand
+		if err := rows.Scan(commandScanDest(&cmd)...); err != nil {
+			continue
+		}
+		commands = append(commands, cmd)
+	}
+
+	c.JSON(http.StatusOK, commands)
+}
+
+// ReportCommandResult is called by the device once it has run a command.
+func (h *CommandHandler) ReportCommandResult(c *gin.Context) {
+	if !authorizeDevice(c, c.Param("id")) {
+		return
+	}
+
+	var req models.CommandResultRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Result) == 0 {
+		req.Result = json.RawMessage("{}")
+	}
+
+	deviceRowID := c.GetString("device_row_id")
+	expireCommands(deviceRowID)
+
+	result, err := database.DB.Exec(`
+		UPDATE device_commands
+		SET status = ?, result = ?, error_message = ?, completed_at = NOW(),
+		    delivered_at = COALESCE(delivered_at, NOW())
+		WHERE id = ? AND device_id = ? AND status IN ('pending', 'delivered')
+	`, req.Status, []byte(req.Result), req.Error, c.Param("commandId"), deviceRowID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record result"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Command not found, already completed or expired"})
+		return
+	}
+
+	cmd, err := loadCommand(c.Param("commandId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve command"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cmd)
+}
+
+// collectPendingCommands returns the device's unexpired pending commands and
+// marks them delivered.
+func collectPendingCommands(deviceRowID string) ([]models.DeviceCommand, error) {
+	expireCommands(deviceRowID)
+
+	rows, err := database.DB.Query(`
+		SELECT `+commandColumns+`
+		FROM device_commands
+		WHERE device_id = ? AND status = 'pending'
+		ORDER BY created_at ASC
+	`, deviceRowID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	commands := []models.DeviceCommand{}
+	for rows.Next() {
+		var cmd models.DeviceCommand
+		if err := rows.Scan(commandScanDest(&cmd)...); err != nil {
+			continue
+		}
+		commands = append(commands, cmd)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i := range commands {
+		_, err := database.DB.Exec(`
+			UPDATE device_commands SET status = 'delivered', delivered_at = ?
+			WHERE id = ? AND status = 'pending'
+		`, now, commands[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		commands[i].Status = models.CommandStatusDelivered
+		commands[i].DeliveredAt = &now
+	}
+	return commands, nil
+}
+
+// expireCommands fails the device's commands whose expiry has passed.
+// expires_at is written from Go, so it is compared with Go's clock.
+func expireCommands(deviceRowID string) {
+	now := time.Now()
+	database.DB.Exec(`
+		UPDATE device_commands
+		SET status = 'failed', error_message = 'expired', completed_at = ?
+		WHERE device_id = ? AND status IN ('pending', 'delivered') AND expires_at < ?
+	`, now, deviceRowID, now)
+}
+
+func loadCommand(id string) (*models.DeviceCommand, error) {
+	var cmd models.DeviceCommand
+	err := database.DB.QueryRow(`
+		SELECT `+commandColumns+`
+		FROM device_commands WHERE id = ?
+	`, id).Scan(commandScanDest(&cmd)...)
+	if err != nil {
+		return nil, err
+	}
+	return &cmd, nil
+}
@@ -3,13 +3,17 @@ package handlers
 import (
 	"database/sql"
 	"net/http"
+	"time"
 
+	"digital-signage-backend/audit"
 	"digital-signage-backend/config"
+	"digital-signage-backend/dailyviews"
 	"digital-signage-backend/database"
 	"digital-signage-backend/models"
+	"digital-signage-backend/presence"
+	"digital-signage-backend/realtime"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
 type DeviceHandler struct {
@@ -20,12 +24,25 @@ func NewDeviceHandler(cfg *config.Config) *DeviceHandler {
 	return &DeviceHandler{cfg: cfg}
 }
 
+// deviceColumns is the column list scanned by deviceScanDest.
+const deviceColumns = `id, org_id, device_id, location, timezone, is_online, last_active, today_views, settings,
+		       COALESCE(tags, '[]'), token_hash IS NOT NULL, created_at, updated_at`
+
+func deviceScanDest(device *models.Device) []interface{} {
+	return []interface{}{
+		&device.ID, &device.OrgID, &device.DeviceID, &device.Location, &device.Timezone, &device.IsOnline,
+		&device.LastActive, &device.TodayViews, &device.Settings, &device.Tags,
+		&device.IsPaired, &device.CreatedAt, &device.UpdatedAt,
+	}
+}
+
 func (h *DeviceHandler) GetDevices(c *gin.Context) {
+	orgSQL, args := orgFilter(c, "org_id")
 	rows, err := database.DB.Query(`
-		SELECT id, device_id, location, is_online, last_active, today_views, settings, created_at, updated_at
-		FROM devices
+		SELECT `+deviceColumns+`
+		FROM devices WHERE `+orgSQL+`
 		ORDER BY location, device_id
-	`)
+	`, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch devices"})
 		return
@@ -35,14 +52,11 @@ func (h *DeviceHandler) GetDevices(c *gin.Context) {
 	devices := []models.Device{}
 	for rows.Next() {
 		var device models.Device
-		err := rows.Scan(
-			&device.ID, &device.DeviceID, &device.Location, &device.IsOnline,
-			&device.LastActive, &device.TodayViews, &device.Settings,
-			&device.CreatedAt, &device.UpdatedAt,
-		)
+		err := rows.Scan(deviceScanDest(&device)...)
 		if err != nil {
 			continue
 		}
+		withPresence(&device)
 		devices = append(devices, device)
 	}
 
@@ -54,14 +68,10 @@ func (h *DeviceHandler) GetDeviceByID(c *gin.Context) {
 
 	var device models.Device
 	err := database.DB.QueryRow(`
-		SELECT id, device_id, location, is_online, last_active, today_views, settings, created_at, updated_at
+		SELECT ` + deviceColumns + `
 		FROM devices WHERE id = ?
-	`, id).Scan(
-		&device.ID, &device.DeviceID, &device.Location, &device.IsOnline,
-		&device.LastActive, &device.TodayViews, &device.Settings,
-		&device.CreatedAt, &device.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
+	`, id).Scan(deviceScanDest(&device)...)
+	if err == sql.ErrNoRows || (err == nil && !inOrg(c, device.OrgID)) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
 		return
 	}
@@ -70,9 +80,12 @@ func (h *DeviceHandler) GetDeviceByID(c *gin.Context) {
 		return
 	}
 
+	withPresence(&device)
 	c.JSON(http.StatusOK, device)
 }
 
+// RegisterDevice lets a paired device report its location and timezone
+// when it starts up. New devices are created through pairing.
 func (h *DeviceHandler) RegisterDevice(c *gin.Context) {
 	var req models.RegisterDeviceRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -80,73 +93,43 @@ func (h *DeviceHandler) RegisterDevice(c *gin.Context) {
 		return
 	}
 
-	// Auto-generate device_id if not provided
-	if req.DeviceID == "" {
-		req.DeviceID = uuid.New().String()
+	if req.DeviceID != "" && req.DeviceID != c.GetString("device_hardware_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Device credential does not match this device"})
+		return
 	}
 
-	// Check if device already exists
-	var existingID string
-	err := database.DB.QueryRow("SELECT id FROM devices WHERE device_id = ?", req.DeviceID).Scan(&existingID)
-	if err == nil {
-		// Device exists, update it
-		var device models.Device
-		_, err = database.DB.Exec(`
-			UPDATE devices SET location = ?, is_online = true, last_active = NOW()
-			WHERE device_id = ?
-		`, req.Location, req.DeviceID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device"})
-			return
-		}
-		err = database.DB.QueryRow(`
-			SELECT id, device_id, location, is_online, last_active, today_views, settings, created_at, updated_at
-			FROM devices WHERE device_id = ?
-		`, req.DeviceID).Scan(
-			&device.ID, &device.DeviceID, &device.Location, &device.IsOnline,
-			&device.LastActive, &device.TodayViews, &device.Settings,
-			&device.CreatedAt, &device.UpdatedAt,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device"})
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
 			return
 		}
-		c.JSON(http.StatusOK, device)
-		return
-	}
-
-	// Create new device
-	defaultSettings := models.DeviceSettings{
-		SlideshowInterval: 5,
-		VideoAutoplay:     true,
-		EnabledAds:        []string{},
 	}
 
-	deviceID := uuid.New().String()
-	_, err = database.DB.Exec(`
-		INSERT INTO devices (id, device_id, location, is_online, settings)
-		VALUES (?, ?, ?, true, ?)
-	`, deviceID, req.DeviceID, req.Location, defaultSettings)
+	deviceRowID := c.GetString("device_row_id")
+	_, err := database.DB.Exec(`
+		UPDATE devices SET location = ?, timezone = COALESCE(NULLIF(?, ''), timezone)
+		WHERE id = ?
+	`, req.Location, req.Timezone, deviceRowID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device"})
 		return
 	}
-	
+	if err := presence.MarkOnline(deviceRowID, presence.ReasonRegister); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device"})
+		return
+	}
+
 	var device models.Device
 	err = database.DB.QueryRow(`
-		SELECT id, device_id, location, is_online, last_active, today_views, settings, created_at, updated_at
+		SELECT ` + deviceColumns + `
 		FROM devices WHERE id = ?
-	`, deviceID).Scan(
-		&device.ID, &device.DeviceID, &device.Location, &device.IsOnline,
-		&device.LastActive, &device.TodayViews, &device.Settings,
-		&device.CreatedAt, &device.UpdatedAt,
-	)
+	`, deviceRowID).Scan(deviceScanDest(&device)...)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, device)
+	c.JSON(http.StatusOK, device)
 }
 
 func (h *DeviceHandler) UpdateDevice(c *gin.Context) {
@@ -166,12 +149,13 @@ func (h *DeviceHandler) UpdateDevice(c *gin.Context) {
 		updates = append(updates, "location = ?")
 		args = append(args, *req.Location)
 	}
-	if req.IsOnline != nil {
-		updates = append(updates, "is_online = ?")
-		args = append(args, *req.IsOnline)
-		if *req.IsOnline {
-			updates = append(updates, "last_active = NOW()")
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+			return
 		}
+		updates = append(updates, "timezone = ?")
+		args = append(args, *req.Timezone)
 	}
 	if req.TodayViews != nil {
 		updates = append(updates, "today_views = ?")
@@ -181,37 +165,62 @@ func (h *DeviceHandler) UpdateDevice(c *gin.Context) {
 		updates = append(updates, "settings = ?")
 		args = append(args, req.Settings)
 	}
+	if req.Tags != nil {
+		updates = append(updates, "tags = ?")
+		args = append(args, models.TagList(req.Tags))
+	}
 
-	if len(updates) == 0 {
+	if len(updates) == 0 && req.IsOnline == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
 		return
 	}
 
-	// Add id to args
-	args = append(args, id)
-
-	query := "UPDATE devices SET " + updates[0]
-	for i := 1; i < len(updates); i++ {
-		query += ", " + updates[i]
+	before, err := findOrgDevice(c, id)
+	if err == sql.ErrNoRows || (err == nil && before.ID != id) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
 	}
-	query += " WHERE id = ?"
-
-	_, err := database.DB.Exec(query, args...)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
+	if len(updates) > 0 {
+		// Add id to args
+		args = append(args, id)
+
+		query := "UPDATE devices SET " + updates[0]
+		for i := 1; i < len(updates); i++ {
+			query += ", " + updates[i]
+		}
+		query += " WHERE id = ?"
+
+		if _, err := database.DB.Exec(query, args...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device"})
+			return
+		}
+	}
+
+	// Online state goes through presence so the change is recorded
+	if req.IsOnline != nil {
+		var err error
+		if *req.IsOnline {
+			err = presence.MarkOnline(id, presence.ReasonAdmin)
+		} else {
+			err = presence.MarkOffline(id, presence.ReasonAdmin)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device"})
+			return
+		}
+	}
+
 	// Get updated device
 	var device models.Device
 	err = database.DB.QueryRow(`
-		SELECT id, device_id, location, is_online, last_active, today_views, settings, created_at, updated_at
+		SELECT ` + deviceColumns + `
 		FROM devices WHERE id = ?
-	`, id).Scan(
-		&device.ID, &device.DeviceID, &device.Location, &device.IsOnline,
-		&device.LastActive, &device.TodayViews, &device.Settings,
-		&device.CreatedAt, &device.UpdatedAt,
-	)
+	`, id).Scan(deviceScanDest(&device)...)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
 		return
@@ -221,12 +230,31 @@ func (h *DeviceHandler) UpdateDevice(c *gin.Context) {
 		return
 	}
 
+	withPresence(&device)
+	recordAudit(c, audit.ActionDeviceUpdated, "device", device.ID, before, device)
+
+	// Push the new settings to the screen right away
+	realtime.Default.Publish(device.ID, realtime.Event{Type: realtime.EventSettingsChanged, Data: device})
+	if req.Location != nil || req.Tags != nil {
+		realtime.Default.Publish(device.ID, realtime.Event{Type: realtime.EventContentChanged})
+	}
+
 	c.JSON(http.StatusOK, device)
 }
 
 func (h *DeviceHandler) DeleteDevice(c *gin.Context) {
 	id := c.Param("id")
 
+	before, err := findOrgDevice(c, id)
+	if err == sql.ErrNoRows || (err == nil && before.ID != id) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
 	result, err := database.DB.Exec("DELETE FROM devices WHERE id = ?", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete device"})
@@ -239,31 +267,47 @@ func (h *DeviceHandler) DeleteDevice(c *gin.Context) {
 		return
 	}
 
+	realtime.Default.Disconnect(id)
+	recordAudit(c, audit.ActionDeviceDeleted, "device", id, before, nil)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Device deleted successfully"})
 }
 
 func (h *DeviceHandler) Heartbeat(c *gin.Context) {
-	deviceID := c.Param("id")
+	if !authorizeDevice(c, c.Param("id")) {
+		return
+	}
 
-	_, err := database.DB.Exec(`
-		UPDATE devices SET is_online = true, last_active = NOW()
-		WHERE device_id = ?
-	`, deviceID)
-	if err != nil {
+	if err := presence.MarkOnline(c.GetString("device_row_id"), presence.ReasonHeartbeat); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update heartbeat"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Heartbeat received"})
+	commands, err := collectPendingCommands(c.GetString("device_row_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch commands"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Heartbeat received", "commands": commands})
 }
 
 func (h *DeviceHandler) IncrementViews(c *gin.Context) {
-	deviceID := c.Param("id")
+	if !authorizeDevice(c, c.Param("id")) {
+		return
+	}
+
+	// Close yesterday first if the rollover job hasn't reached this device yet
+	deviceRowID := c.GetString("device_row_id")
+	if err := dailyviews.RolloverDevice(deviceRowID, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to increment views"})
+		return
+	}
 
 	_, err := database.DB.Exec(`
 		UPDATE devices SET today_views = today_views + 1
-		WHERE device_id = ?
-	`, deviceID)
+		WHERE id = ?
+	`, deviceRowID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to increment views"})
 		return
@@ -271,3 +315,162 @@ func (h *DeviceHandler) IncrementViews(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Views incremented"})
 }
+
+// findDevice looks a device up by its row id or by its hardware device_id.
+func findDevice(idOrDeviceID string) (models.Device, error) {
+	var device models.Device
+	err := database.DB.QueryRow(`
+		SELECT `+deviceColumns+`
+		FROM devices WHERE id = ? OR device_id = ?
+		LIMIT 1
+	`, idOrDeviceID, idOrDeviceID).Scan(deviceScanDest(&device)...)
+	return device, err
+}
+
+// findOrgDevice is findDevice limited to the caller's organization.
+func findOrgDevice(c *gin.Context, idOrDeviceID string) (models.Device, error) {
+	device, err := findDevice(idOrDeviceID)
+	if err == nil && !inOrg(c, device.OrgID) {
+		return device, sql.ErrNoRows
+	}
+	return device, err
+}
+
+// authorizeDevice checks that idOrDeviceID names the device authenticated by
+// DeviceAuthMiddleware and writes a 403 response when it doesn't.
+func authorizeDevice(c *gin.Context, idOrDeviceID string) bool {
+	if idOrDeviceID == c.GetString("device_row_id") || idOrDeviceID == c.GetString("device_hardware_id") {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "Device credential does not match this device"})
+	return false
+}
+
+// GetStatusHistory lists a device's online/offline changes, newest first.
+func (h *DeviceHandler) GetStatusHistory(c *gin.Context) {
+	device, err := findOrgDevice(c, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT id, device_id, status, reason, changed_at
+		FROM device_status_history
+		WHERE device_id = ?
+		ORDER BY changed_at DESC
+		LIMIT 500
+	`, device.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch status history"})
+		return
+	}
+	defer rows.Close()
+
+	history := []models.DeviceStatusChange{}
+	for rows.Next() {
+		var change models.DeviceStatusChange
+		if err := rows.Scan(&change.ID, &change.DeviceID, &change.Status, &change.Reason, &change.ChangedAt); err != nil {
+			continue
+		}
+		history = append(history, change)
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// GetViewsHistory returns the device's daily view counts as a time series,
+// one point per local day with missing days as zero. The last point is the
+// live counter of the current day.
+func (h *DeviceHandler) GetViewsHistory(c *gin.Context) {
+	device, err := findOrgDevice(c, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	today, _ := time.Parse("2006-01-02", dailyviews.LocalDate(time.Now(), device.Timezone))
+	endDate := today
+	startDate := endDate.AddDate(0, 0, -30)
+	if v := c.Query("start_date"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date, expected YYYY-MM-DD"})
+			return
+		}
+		startDate = t
+	}
+	if v := c.Query("end_date"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date, expected YYYY-MM-DD"})
+			return
+		}
+		endDate = t
+	}
+	if endDate.Before(startDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_date must not be before start_date"})
+		return
+	}
+	if endDate.Sub(startDate) > 366*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Date range must not exceed one year"})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT date, views FROM device_daily_views
+		WHERE device_id = ? AND date BETWEEN ? AND ?
+	`, device.ID, startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch views history"})
+		return
+	}
+	defer rows.Close()
+
+	views := map[string]int{}
+	for rows.Next() {
+		var date time.Time
+		var count int
+		if err := rows.Scan(&date, &count); err != nil {
+			continue
+		}
+		views[date.Format("2006-01-02")] += count
+	}
+
+	// The current day is still counting in devices.today_views. Until the
+	// rollover runs after local midnight the counter still holds
+	// yesterday's views, which don't belong to today.
+	var todayViews int
+	var viewsDate sql.NullTime
+	err = database.DB.QueryRow(
+		"SELECT today_views, views_date FROM devices WHERE id = ?", device.ID,
+	).Scan(&todayViews, &viewsDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch views history"})
+		return
+	}
+	if viewsDate.Valid && viewsDate.Time.Format("2006-01-02") == today.Format("2006-01-02") &&
+		!today.Before(startDate) && !today.After(endDate) {
+		views[today.Format("2006-01-02")] += todayViews
+	}
+
+	series := []gin.H{}
+	for d := startDate; !d.After(endDate); d = d.AddDate(0, 0, 1) {
+		key := d.Format("2006-01-02")
+		series = append(series, gin.H{"date": key, "views": views[key]})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device_id": device.ID,
+		"timezone":  device.Timezone,
+		"series":    series,
+	})
+}
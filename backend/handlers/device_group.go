@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"digital-signage-backend/audit"
+	"digital-signage-backend/config"
+	"digital-signage-backend/database"
+	"digital-signage-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var errFailedToSaveMembers = errors.New("Failed to save group devices")
+
+type DeviceGroupHandler struct {
+	cfg *config.Config
+}
+
+func NewDeviceGroupHandler(cfg *config.Config) *DeviceGroupHandler {
+	return &DeviceGroupHandler{cfg: cfg}
+}
+
+func (h *DeviceGroupHandler) GetGroups(c *gin.Context) {
+	orgSQL, args := orgFilter(c, "g.org_id")
+	rows, err := database.DB.Query(`
+		SELECT g.id, g.org_id, g.name, COALESCE(g.description, ''), COUNT(m.device_id), g.created_at, g.updated_at
+		FROM device_groups g
+		LEFT JOIN device_group_members m ON m.group_id = g.id
+		WHERE `+orgSQL+`
+		GROUP BY g.id, g.org_id, g.name, g.description, g.created_at, g.updated_at
+		ORDER BY g.name
+	`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch device groups"})
+		return
+	}
+	defer rows.Close()
+
+	groups := []models.DeviceGroup{}
+	for rows.Next() {
+		var g models.DeviceGroup
+		if err := rows.Scan(&g.ID, &g.OrgID, &g.Name, &g.Description, &g.DeviceCount, &g.CreatedAt, &g.UpdatedAt); err != nil {
+			continue
+		}
+		groups = append(groups, g)
+	}
+
+	c.JSON(http.StatusOK, groups)
+}
+
+func (h *DeviceGroupHandler) GetGroupByID(c *gin.Context) {
+	group, err := loadOrgDeviceGroup(c, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device group not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+func (h *DeviceGroupHandler) CreateGroup(c *gin.Context) {
+	var req models.CreateDeviceGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	orgID, ok := targetOrg(c)
+	if !ok {
+		return
+	}
+
+	if taken, err := groupNameTaken(orgID, req.Name, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	} else if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "A device group with this name already exists"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	groupID := uuid.New().String()
+	_, err = tx.Exec(`
+		INSERT INTO device_groups (id, org_id, name, description)
+		VALUES (?, ?, ?, ?)
+	`, groupID, orgID, req.Name, req.Description)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create device group"})
+		return
+	}
+
+	if status, err := replaceGroupMembers(tx, orgID, groupID, req.DeviceIDs); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	group, err := loadDeviceGroup(groupID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve created device group"})
+		return
+	}
+
+	recordAudit(c, audit.ActionDeviceGroupCreated, "device_group", group.ID, nil, group)
+
+	if len(req.DeviceIDs) > 0 {
+		notifyContentChanged(group.OrgID)
+	}
+
+	c.JSON(http.StatusCreated, group)
+}
+
+func (h *DeviceGroupHandler) UpdateGroup(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.UpdateDeviceGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before, err := loadOrgDeviceGroup(c, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device group not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	updates := []string{}
+	args := []interface{}{}
+
+	if req.Name != nil {
+		if *req.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Name must not be empty"})
+			return
+		}
+		if taken, err := groupNameTaken(before.OrgID, *req.Name, id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		} else if taken {
+			c.JSON(http.StatusConflict, gin.H{"error": "A device group with this name already exists"})
+			return
+		}
+		updates = append(updates, "name = ?")
+		args = append(args, *req.Name)
+	}
+	if req.Description != nil {
+		updates = append(updates, "description = ?")
+		args = append(args, *req.Description)
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	args = append(args, id)
+
+	query := "UPDATE device_groups SET " + updates[0]
+	for i := 1; i < len(updates); i++ {
+		query += ", " + updates[i]
+	}
+	query += " WHERE id = ?"
+
+	if _, err := database.DB.Exec(query, args...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device group"})
+		return
+	}
+
+	group, err := loadDeviceGroup(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device group not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get updated device group"})
+		return
+	}
+
+	recordAudit(c, audit.ActionDeviceGroupUpdated, "device_group", id, before, group)
+
+	c.JSON(http.StatusOK, group)
+}
+
+// DeleteGroup removes the group and its memberships. Ads still referencing
+// the group in their targeting simply stop matching on it.
+func (h *DeviceGroupHandler) DeleteGroup(c *gin.Context) {
+	id := c.Param("id")
+	before, err := loadOrgDeviceGroup(c, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device group not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	result, err := database.DB.Exec("DELETE FROM device_groups WHERE id = ?", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete device group"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device group not found"})
+		return
+	}
+
+	recordAudit(c, audit.ActionDeviceGroupDeleted, "device_group", id, before, nil)
+	notifyContentChanged(before.OrgID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device group deleted successfully"})
+}
+
+// SetGroupDevices replaces the member list of a group.
+func (h *DeviceGroupHandler) SetGroupDevices(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.SetGroupDevicesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before, err := loadOrgDeviceGroup(c, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device group not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM device_groups WHERE id = ?)", id).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device group not found"})
+		return
+	}
+
+	if status, err := replaceGroupMembers(tx, before.OrgID, id, req.DeviceIDs); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	group, err := loadDeviceGroup(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get updated device group"})
+		return
+	}
+
+	recordAudit(c, audit.ActionDeviceGroupDevicesUpdated, "device_group", id, before, group)
+	notifyContentChanged(group.OrgID)
+
+	c.JSON(http.StatusOK, group)
+}
+
+// deviceSubject collects what ad targeting is evaluated against for device.
+func deviceSubject(device models.Device) (models.TargetSubject, error) {
+	subject := models.TargetSubject{
+		Location: device.Location,
+		Groups:   []string{},
+		Tags:     device.Tags,
+	}
+
+	rows, err := database.DB.Query("SELECT group_id FROM device_group_members WHERE device_id = ?", device.ID)
+	if err != nil {
+		return subject, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var groupID string
+		if err := rows.Scan(&groupID); err != nil {
+			return subject, err
+		}
+		subject.Groups = append(subject.Groups, groupID)
+	}
+	return subject, rows.Err()
+}
+
+func loadDeviceGroup(id string) (*models.DeviceGroup, error) {
+	var g models.DeviceGroup
+	err := database.DB.QueryRow(`
+		SELECT id, org_id, name, COALESCE(description, ''), created_at, updated_at
+		FROM device_groups WHERE id = ?
+	`, id).Scan(&g.ID, &g.OrgID, &g.Name, &g.Description, &g.CreatedAt, &g.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT device_id FROM device_group_members
+		WHERE group_id = ?
+		ORDER BY created_at
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	g.DeviceIDs = []string{}
+	for rows.Next() {
+		var deviceID string
+		if err := rows.Scan(&deviceID); err != nil {
+			continue
+		}
+		g.DeviceIDs = append(g.DeviceIDs, deviceID)
+	}
+	g.DeviceCount = len(g.DeviceIDs)
+	return &g, rows.Err()
+}
+
+// loadOrgDeviceGroup is loadDeviceGroup limited to the caller's organization.
+func loadOrgDeviceGroup(c *gin.Context, id string) (*models.DeviceGroup, error) {
+	g, err := loadDeviceGroup(id)
+	if err == nil && !inOrg(c, g.OrgID) {
+		return nil, sql.ErrNoRows
+	}
+	return g, err
+}
+
+// groupNameTaken reports whether the name is in use within an organization.
+func groupNameTaken(orgID, name, exceptID string) (bool, error) {
+	var taken bool
+	err := database.DB.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM device_groups WHERE org_id = ? AND name = ? AND id <> ?)", orgID, name, exceptID,
+	).Scan(&taken)
+	return taken, err
+}
+
+// replaceGroupMembers sets the members of a group. Devices may be given by
+// devices.id or by their hardware device_id and must belong to the group's
+// organization.
+func replaceGroupMembers(tx *sql.Tx, orgID, groupID string, deviceIDs []string) (int, error) {
+	if _, err := tx.Exec("DELETE FROM device_group_members WHERE group_id = ?", groupID); err != nil {
+		return http.StatusInternalServerError, errFailedToSaveMembers
+	}
+
+	for _, idOrDeviceID := range deviceIDs {
+		var rowID string
+		err := tx.QueryRow(
+			"SELECT id FROM devices WHERE (id = ? OR device_id = ?) AND org_id = ?", idOrDeviceID, idOrDeviceID, orgID,
+		).Scan(&rowID)
+		if err == sql.ErrNoRows {
+			return http.StatusBadRequest, fmt.Errorf("Device %s not found", idOrDeviceID)
+		}
+		if err != nil {
+			return http.StatusInternalServerError, errFailedToSaveMembers
+		}
+
+		_, err = tx.Exec(`
+			INSERT IGNORE INTO device_group_members (group_id, device_id)
+			VALUES (?, ?)
+		`, groupID, rowID)
+		if err != nil {
+			return http.StatusInternalServerError, errFailedToSaveMembers
+		}
+	}
+	return http.StatusOK, nil
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"digital-signage-backend/audit"
+	"digital-signage-backend/models"
+	"digital-signage-backend/presence"
+	"digital-signage-backend/realtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+// eventKeepAlive is how often an idle push channel gets a ping. It also
+// refreshes last_active, so connected devices don't need to heartbeat.
+const eventKeepAlive = 25 * time.Second
+
+// StreamEvents opens the device's Server-Sent Events push channel.
+func (h *DeviceHandler) StreamEvents(c *gin.Context) {
+	if !authorizeDevice(c, c.Param("id")) {
+		return
+	}
+	deviceRowID := c.GetString("device_row_id")
+
+	sub := realtime.Default.Subscribe(deviceRowID, c.GetString("device_org_id"))
+	defer realtime.Default.Unsubscribe(sub)
+
+	touchDevice(deviceRowID)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	c.SSEvent("connected", gin.H{"device_id": deviceRowID, "connected_at": sub.ConnectedAt})
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(eventKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case ev, ok := <-sub.Events:
+			if !ok {
+				// Disconnected by the server, e.g. credential revoked
+				return
+			}
+			c.SSEvent(ev.Type, ev)
+			c.Writer.Flush()
+		case <-ticker.C:
+			if _, err := c.Writer.WriteString(": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+			touchDevice(deviceRowID)
+		}
+	}
+}
+
+// ReloadDevice tells a connected device to reload itself.
+func (h *DeviceHandler) ReloadDevice(c *gin.Context) {
+	device, err := findOrgDevice(c, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	connected, _ := realtime.Default.Presence(device.ID)
+	realtime.Default.Publish(device.ID, realtime.Event{Type: realtime.EventReload})
+	entry := auditEntry(c, audit.ActionDeviceReloaded, "device", device.ID, nil, nil)
+	entry.OrgID = device.OrgID
+	audit.Record(entry)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reload sent", "delivered": connected})
+}
+
+// GetPresence lists devices of the caller's organization with an open push
+// channel.
+func (h *DeviceHandler) GetPresence(c *gin.Context) {
+	presence := []gin.H{}
+	for deviceID, since := range realtime.Default.Connected(orgScope(c)) {
+		presence = append(presence, gin.H{
+			"device_id":       deviceID,
+			"connected_since": since,
+		})
+	}
+
+	c.JSON(http.StatusOK, presence)
+}
+
+// touchDevice marks the device as seen now.
+func touchDevice(deviceRowID string) {
+	if err := presence.MarkOnline(deviceRowID, presence.ReasonPushChannel); err != nil {
+		log.Printf("Failed to update presence of device %s: %v", deviceRowID, err)
+	}
+}
+
+// withPresence fills the push channel fields of a device.
+func withPresence(device *models.Device) {
+	connected, since := realtime.Default.Presence(device.ID)
+	device.Connected = connected
+	if connected {
+		device.ConnectedSince = &since
+	}
+}
+
+// notifyContentChanged tells every connected device of an organization to
+// re-fetch its content.
+func notifyContentChanged(orgID string) {
+	realtime.Default.BroadcastOrg(orgID, realtime.Event{Type: realtime.EventContentChanged})
+}
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"digital-signage-backend/audit"
+	"digital-signage-backend/database"
+	"digital-signage-backend/mailer"
+	"digital-signage-backend/models"
+	"digital-signage-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// inviteColumns is the column list scanned by inviteScanDest.
+const inviteColumns = `id, org_id, email, role, COALESCE(company_name, ''), invited_by,
+		       expires_at, accepted_at, created_at`
+
+func inviteScanDest(invite *models.UserInvite) []interface{} {
+	return []interface{}{
+		&invite.ID, &invite.OrgID, &invite.Email, &invite.Role, &invite.CompanyName, &invite.InvitedBy,
+		&invite.ExpiresAt, &invite.AcceptedAt, &invite.CreatedAt,
+	}
+}
+
+// CreateInvite emails an invitation to join the caller's organization. The
+// signup link is also returned once, for sharing it by other means, and can
+// be used a single time before it expires. Inviting an address again
+// replaces its pending invite.
+func (h *UserHandler) CreateInvite(c *gin.Context) {
+	var req models.CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	orgID, ok := targetOrg(c)
+	if !ok {
+		return
+	}
+
+	if !authorizeRoleGrant(c, req.Role) {
+		return
+	}
+	req.CompanyName = strings.TrimSpace(req.CompanyName)
+	if req.Role == models.RoleAdvertiser && req.CompanyName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "company_name is required for advertisers"})
+		return
+	}
+
+	var exists bool
+	if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = ?)", req.Email).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+
+	token, err := utils.GenerateSecureToken("inv_", 32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// A new invite replaces this organization's pending one; invites from
+	// other organizations to the same address are left alone
+	_, err = tx.Exec(`
+		DELETE FROM user_invites
+		WHERE email = ? AND org_id = ? AND accepted_at IS NULL
+	`, req.Email, orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+
+	inviteID := uuid.New().String()
+	expiresAt := time.Now().Add(time.Duration(h.cfg.InviteTTLHours) * time.Hour)
+	_, err = tx.Exec(`
+		INSERT INTO user_invites (id, org_id, email, role, company_name, token_hash, invited_by, expires_at)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?)
+	`, inviteID, orgID, req.Email, req.Role, req.CompanyName, utils.HashToken(token), c.GetString("user_id"), expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	var invite models.UserInvite
+	err = database.DB.QueryRow(`
+		SELECT `+inviteColumns+`
+		FROM user_invites WHERE id = ?
+	`, inviteID).Scan(inviteScanDest(&invite)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve created invite"})
+		return
+	}
+
+	mailer.SendAsync(mailer.InviteMessage(invite.Email, invite.Role, invite.ExpiresAt, h.inviteURL(token)))
+
+	recordAudit(c, audit.ActionUserInvited, "invite", invite.ID, nil, invite)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"invite":     invite,
+		"token":      token,
+		"accept_url": h.inviteURL(token),
+	})
+}
+
+// GetInvites lists the invites of the caller's organization. status is
+// pending (default), accepted, expired or all.
+func (h *UserHandler) GetInvites(c *gin.Context) {
+	orgSQL, args := orgFilter(c, "org_id")
+	query := `
+		SELECT ` + inviteColumns + `
+		FROM user_invites WHERE ` + orgSQL
+	switch c.DefaultQuery("status", "pending") {
+	case "pending":
+		query += " AND accepted_at IS NULL AND expires_at > NOW()"
+	case "accepted":
+		query += " AND accepted_at IS NOT NULL"
+	case "expired":
+		query += " AND accepted_at IS NULL AND expires_at <= NOW()"
+	case "all":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, accepted, expired or all"})
+		return
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invites"})
+		return
+	}
+	defer rows.Close()
+
+	invites := []models.UserInvite{}
+	for rows.Next() {
+		var invite models.UserInvite
+		if err := rows.Scan(inviteScanDest(&invite)...); err != nil {
+			continue
+		}
+		invites = append(invites, invite)
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// RevokeInvite deletes an invite that has not been accepted yet.
+func (h *UserHandler) RevokeInvite(c *gin.Context) {
+	orgSQL, args := orgFilter(c, "org_id")
+	result, err := database.DB.Exec(`
+		DELETE FROM user_invites
+		WHERE id = ? AND accepted_at IS NULL AND `+orgSQL,
+		append([]interface{}{c.Param("inviteId")}, args...)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invite"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		return
+	}
+
+	recordAudit(c, audit.ActionInviteRevoked, "invite", c.Param("inviteId"), nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite revoked successfully"})
+}
+
+func (h *UserHandler) inviteURL(token string) string {
+	return strings.TrimRight(h.cfg.AppBaseURL, "/") + "/accept-invite?token=" + url.QueryEscape(token)
+}
+
+// AcceptInvite creates the invited account with the role chosen by the
+// admin and logs it in. The token stops working once used.
+func (h *AuthHandler) AcceptInvite(c *gin.Context) {
+	var req models.AcceptInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var invite models.UserInvite
+	err = tx.QueryRow(`
+		SELECT `+inviteColumns+`
+		FROM user_invites WHERE token_hash = ?
+		FOR UPDATE
+	`, utils.HashToken(req.Token)).Scan(inviteScanDest(&invite)...)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if invite.AcceptedAt != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "Invite has already been used"})
+		return
+	}
+	if time.Now().After(invite.ExpiresAt) {
+		c.JSON(http.StatusGone, gin.H{"error": "Invite has expired"})
+		return
+	}
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = ?)", invite.Email).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+
+	userID := uuid.New().String()
+	_, err = tx.Exec(`
+		INSERT INTO users (id, org_id, email, password_hash, display_name, role, company_name)
+		VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''))
+	`, userID, invite.OrgID, invite.Email, hashedPassword, req.DisplayName, invite.Role, invite.CompanyName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE user_invites SET accepted_at = NOW() WHERE id = ?", invite.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invite"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	user, err := loadUser(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	entry := selfAuditEntry(c, audit.ActionInviteAccepted, user.ID, user.Email, user.OrgID)
+	entry.After = user
+	entry.Details = map[string]interface{}{"invite_id": invite.ID, "invited_by": invite.InvitedBy}
+	audit.Record(entry)
+
+	// Start a session
+	response, err := h.issueSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"digital-signage-backend/audit"
+	"digital-signage-backend/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Throttle scopes. Login failures and password reset requests are counted
+// separately so that spamming reset emails can't lock anyone out of login.
+const (
+	throttleAccount      = "account"
+	throttleIP           = "ip"
+	throttleResetAccount = "reset_account"
+	throttleResetIP      = "reset_ip"
+)
+
+// attemptKey identifies one login_attempts row.
+type attemptKey struct {
+	scope   string
+	subject string
+}
+
+func loginKeys(c *gin.Context, email string) []attemptKey {
+	return []attemptKey{
+		{throttleAccount, normalizeEmail(email)},
+		{throttleIP, c.ClientIP()},
+	}
+}
+
+func resetKeys(c *gin.Context, email string) []attemptKey {
+	return []attemptKey{
+		{throttleResetAccount, normalizeEmail(email)},
+		{throttleResetIP, c.ClientIP()},
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// throttled answers 429 with Retry-After when any of keys is locked out or
+// still inside its backoff delay.
+func (h *AuthHandler) throttled(c *gin.Context, keys ...attemptKey) bool {
+	var wait time.Duration
+	for _, key := range keys {
+		w, err := h.retryAfter(key)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return true
+		}
+		if w > wait {
+			wait = w
+		}
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	seconds := int64((wait + time.Second - 1) / time.Second)
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many attempts, try again later",
+		"retry_after": seconds,
+	})
+	return true
+}
+
+func (h *AuthHandler) retryAfter(key attemptKey) (time.Duration, error) {
+	var failures int
+	var locked bool
+	var lockRemaining, sinceLast int64
+	// Times are compared in SQL so the app and database clocks can't disagree
+	err := database.DB.QueryRow(`
+		SELECT failures, locked_until IS NOT NULL,
+		       COALESCE(TIMESTAMPDIFF(SECOND, NOW(), locked_until), 0),
+		       TIMESTAMPDIFF(SECOND, last_failure_at, NOW())
+		FROM login_attempts WHERE scope = ? AND subject = ?
+	`, key.scope, key.subject).Scan(&failures, &locked, &lockRemaining, &sinceLast)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if lockRemaining > 0 {
+		return time.Duration(lockRemaining) * time.Second, nil
+	}
+	if h.attemptsExpired(locked, sinceLast) {
+		return 0, nil
+	}
+	return h.backoff(failures) - time.Duration(sinceLast)*time.Second, nil
+}
+
+// attemptsExpired reports whether earlier failures no longer count: the
+// lockout they caused is over, or none happened for a whole lockout period.
+func (h *AuthHandler) attemptsExpired(locked bool, sinceLast int64) bool {
+	return locked || time.Duration(sinceLast)*time.Second > h.lockoutDuration()
+}
+
+// backoff doubles the delay after each failure, starting at
+// LOGIN_BACKOFF_SECONDS and never exceeding the lockout duration.
+func (h *AuthHandler) backoff(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	delay := time.Duration(h.cfg.LoginBackoffSeconds) * time.Second
+	for i := 1; i < failures && delay < h.lockoutDuration(); i++ {
+		delay *= 2
+	}
+	if delay > h.lockoutDuration() {
+		delay = h.lockoutDuration()
+	}
+	return delay
+}
+
+func (h *AuthHandler) lockoutDuration() time.Duration {
+	return time.Duration(h.cfg.LoginLockoutMinutes) * time.Minute
+}
+
+// maxFailures is the number of failures that locks a key out.
+func (h *AuthHandler) maxFailures(scope string) int {
+	if scope == throttleIP || scope == throttleResetIP {
+		return int(h.cfg.LoginMaxFailuresPerIP)
+	}
+	return int(h.cfg.LoginMaxFailures)
+}
+
+// recordFailures counts a failed attempt against each key, locking out the
+// ones that reach their limit.
+func (h *AuthHandler) recordFailures(c *gin.Context, keys ...attemptKey) error {
+	if err := h.purgeExpiredAttempts(); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		locked, err := h.recordFailure(key)
+		if err != nil {
+			return err
+		}
+		if locked {
+			audit.Record(audit.Entry{
+				Action:     audit.ActionLockedOut,
+				TargetType: key.scope,
+				TargetID:   key.subject,
+				IPAddress:  c.ClientIP(),
+				Details: map[string]interface{}{
+					"failures":        h.maxFailures(key.scope),
+					"lockout_minutes": h.cfg.LoginLockoutMinutes,
+				},
+			})
+		}
+	}
+	return nil
+}
+
+func (h *AuthHandler) recordFailure(key attemptKey) (bool, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var failures int
+	var locked bool
+	var sinceLast int64
+	err = tx.QueryRow(`
+		SELECT failures, locked_until IS NOT NULL, TIMESTAMPDIFF(SECOND, last_failure_at, NOW())
+		FROM login_attempts WHERE scope = ? AND subject = ?
+		FOR UPDATE
+	`, key.scope, key.subject).Scan(&failures, &locked, &sinceLast)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	if err == nil && h.attemptsExpired(locked, sinceLast) {
+		failures = 0
+	}
+
+	failures++
+	lock := failures >= h.maxFailures(key.scope)
+	_, err = tx.Exec(`
+		INSERT INTO login_attempts (scope, subject, failures, last_failure_at, locked_until)
+		VALUES (?, ?, ?, NOW(), IF(?, NOW() + INTERVAL ? MINUTE, NULL))
+		ON DUPLICATE KEY UPDATE
+			failures = VALUES(failures),
+			last_failure_at = VALUES(last_failure_at),
+			locked_until = VALUES(locked_until)
+	`, key.scope, key.subject, failures, lock, h.cfg.LoginLockoutMinutes)
+	if err != nil {
+		return false, err
+	}
+
+	return lock, tx.Commit()
+}
+
+// purgeExpiredAttempts deletes the rows whose failures no longer count, so
+// the table doesn't keep one row for every address that ever failed.
+func (h *AuthHandler) purgeExpiredAttempts() error {
+	_, err := database.DB.Exec(`
+		DELETE FROM login_attempts
+		WHERE locked_until < NOW() OR last_failure_at < NOW() - INTERVAL ? MINUTE
+	`, h.cfg.LoginLockoutMinutes)
+	return err
+}
+
+// clearFailures forgets the failures of keys, e.g. after a good login.
+func clearFailures(keys ...attemptKey) error {
+	for _, key := range keys {
+		_, err := database.DB.Exec(
+			"DELETE FROM login_attempts WHERE scope = ? AND subject = ?", key.scope, key.subject,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnlockUser lifts a lockout of the user's account before it runs out.
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	user, ok := loadManagedUser(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	email := normalizeEmail(user.Email)
+	result, err := database.DB.Exec(`
+		DELETE FROM login_attempts
+		WHERE scope IN (?, ?) AND subject = ?
+	`, throttleAccount, throttleResetAccount, email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	entry := auditEntry(c, audit.ActionAccountUnlocked, "user", user.ID, nil, nil)
+	entry.OrgID = user.OrgID
+	entry.Details = map[string]interface{}{"cleared": rowsAffected > 0}
+	audit.Record(entry)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked", "cleared": rowsAffected > 0})
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"digital-signage-backend/database"
+	"digital-signage-backend/models"
+	"digital-signage-backend/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetManifest returns the ordered content the device should play together
+// with media checksums and sizes. The response carries a strong ETag and
+// answers 304 Not Modified when If-None-Match still matches.
+func (h *DeviceHandler) GetManifest(c *gin.Context) {
+	device, err := findDevice(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !authorizeDevice(c, device.ID) {
+		return
+	}
+
+	manifest, err := h.buildManifest(device, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build manifest"})
+		return
+	}
+
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build manifest"})
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+func (h *DeviceHandler) buildManifest(device models.Device, now time.Time) (*models.Manifest, error) {
+	loc, err := time.LoadLocation(device.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	playlist, source, err := resolvePlaylist(device)
+	if err != nil {
+		return nil, err
+	}
+
+	ads, err := deviceAds(device, playlist)
+	if err != nil {
+		return nil, err
+	}
+
+	// An empty EnabledAds list means every ad is allowed on this device
+	enabled := map[string]bool{}
+	for _, id := range device.Settings.EnabledAds {
+		enabled[id] = true
+	}
+
+	manifest := &models.Manifest{
+		DeviceID: device.ID,
+		Source:   source,
+		Settings: models.ManifestSettings{
+			SlideshowInterval: device.Settings.SlideshowInterval,
+			VideoAutoplay:     device.Settings.VideoAutoplay,
+		},
+		Items: []models.ManifestItem{},
+	}
+	if playlist != nil {
+		manifest.PlaylistID = playlist.ID
+	}
+
+	live := []models.Ad{}
+	urls := []string{}
+	for _, ad := range ads {
+		if len(enabled) > 0 && !enabled[ad.ID] {
+			continue
+		}
+		if !ad.IsLiveAt(now, loc) {
+			continue
+		}
+		live = append(live, ad)
+		urls = append(append(urls, ad.MediaURL), ad.GalleryImages...)
+	}
+
+	known, err := libraryChecksums(device.OrgID, urls)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ad := range live {
+
+		duration := ad.DurationSeconds
+		if duration <= 0 {
+			duration = device.Settings.SlideshowInterval
+		}
+
+		item := models.ManifestItem{
+			AdID:            ad.ID,
+			Title:           ad.Title,
+			MediaType:       ad.MediaType,
+			Media:           describeMedia(ad.MediaURL, known),
+			DurationSeconds: duration,
+			Position:        len(manifest.Items),
+			Description:     ad.Description,
+			CompanyName:     ad.CompanyName,
+			ContactInfo:     ad.ContactInfo,
+			WebsiteURL:      ad.WebsiteURL,
+			Gallery:         []models.ManifestMedia{},
+		}
+		manifest.TotalBytes += item.Media.SizeBytes
+		for _, url := range ad.GalleryImages {
+			media := describeMedia(url, known)
+			manifest.TotalBytes += media.SizeBytes
+			item.Gallery = append(item.Gallery, media)
+		}
+		manifest.Items = append(manifest.Items, item)
+	}
+
+	return manifest, nil
+}
+
+// libraryChecksums looks up the checksum and size the media library
+// recorded for the files urls point at, by storage key, in one query.
+func libraryChecksums(orgID string, urls []string) (map[string]checksumEntry, error) {
+	keys := []string{}
+	for _, url := range urls {
+		if key, ok := storage.Default.KeyForURL(url); ok {
+			keys = append(keys, key)
+		}
+	}
+	known := map[string]checksumEntry{}
+	if len(keys) == 0 {
+		return known, nil
+	}
+
+	inSQL, args := inList(keys)
+	rows, err := database.DB.Query(`
+		SELECT storage_key, sha256, size_bytes FROM media_assets
+		WHERE org_id = ? AND sha256 IS NOT NULL AND storage_key IN `+inSQL,
+		append([]interface{}{orgID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var entry checksumEntry
+		if err := rows.Scan(&key, &entry.sha256, &entry.size); err != nil {
+			continue
+		}
+		known[key] = entry
+	}
+	return known, rows.Err()
+}
+
+// describeMedia adds checksum and size for files kept in media storage,
+// taken from the media library when it knows the file. Only files uploaded
+// before the library recorded hashes are read and hashed.
+func describeMedia(url string, known map[string]checksumEntry) models.ManifestMedia {
+	media := models.ManifestMedia{URL: url}
+
+	key, ok := storage.Default.KeyForURL(url)
+	if !ok {
+		return media
+	}
+	if entry, ok := known[key]; ok {
+		media.SHA256 = entry.sha256
+		media.SizeBytes = entry.size
+		return media
+	}
+
+	checksum, size, err := mediaChecksums.get(key)
+	if err != nil {
+		return media
+	}
+	media.SHA256 = checksum
+	media.SizeBytes = size
+	return media
+}
+
+// inList returns "(?, ?, ...)" for values, with the values as arguments.
+func inList(values []string) (string, []interface{}) {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return "(" + strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ") + ")", args
+}
+
+// etagMatches implements the weak comparison If-None-Match uses.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+type checksumEntry struct {
+	size    int64
+	modTime time.Time
+	sha256  string
+}
+
+// checksumCache remembers hashes of files the media library doesn't know
+// until the object's size or mtime changes, so polling players don't cause
+// them to be re-read. It holds at most maxChecksumEntries.
+type checksumCache struct {
+	mu      sync.Mutex
+	entries map[string]checksumEntry
+}
+
+const maxChecksumEntries = 1000
+
+var mediaChecksums = &checksumCache{entries: map[string]checksumEntry{}}
+
+func (cc *checksumCache) get(key string) (string, int64, error) {
+	obj, err := storage.Default.Stat(key)
+	if err != nil {
+		return "", 0, err
+	}
+
+	cc.mu.Lock()
+	entry, ok := cc.entries[key]
+	cc.mu.Unlock()
+	if ok && entry.size == obj.Size && entry.modTime.Equal(obj.ModTime) {
+		return entry.sha256, entry.size, nil
+	}
+
+	r, _, err := storage.Default.Get(key)
+	if err != nil {
+		return "", 0, err
+	}
+	defer r.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", 0, err
+	}
+	entry = checksumEntry{
+		size:    obj.Size,
+		modTime: obj.ModTime,
+		sha256:  hex.EncodeToString(hash.Sum(nil)),
+	}
+
+	cc.mu.Lock()
+	if _, ok := cc.entries[key]; !ok && len(cc.entries) >= maxChecksumEntries {
+		// Evict an arbitrary entry; legacy files are few and rarely change
+		for old := range cc.entries {
+			delete(cc.entries, old)
+			break
+		}
+	}
+	cc.entries[key] = entry
+	cc.mu.Unlock()
+
+	return entry.sha256, entry.size, nil
+}
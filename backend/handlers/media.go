@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"digital-signage-backend/audit"
+	"digital-signage-backend/config"
+	"digital-signage-backend/database"
+	"digital-signage-backend/media"
+	"digital-signage-backend/models"
+	"digital-signage-backend/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mediaReferenceSQL matches the ads (alias a) of the asset's organization
+// that use the asset m, as media or in their gallery, by the URL the upload
+// returned. Deleted ads are never restored and don't count.
+const mediaReferenceSQL = `a.org_id = m.org_id AND a.is_deleted = false
+		AND (a.media_url = m.url OR JSON_CONTAINS(a.gallery_images, JSON_QUOTE(m.url)))`
+
+// mediaAssetColumns is the column list scanned by mediaAssetScanDest, to be
+// selected FROM mediaAssetTables.
+const mediaAssetColumns = `m.id, m.org_id, m.url, m.storage_key, m.original_name, m.mime_type, m.media_type,
+		       m.size_bytes, COALESCE(m.sha256, ''), m.width, m.height, m.duration_seconds,
+		       m.thumbnail_url, m.preview_url, m.created_by,
+		       COALESCE(u.email, ''), (SELECT COUNT(*) FROM ads a WHERE ` + mediaReferenceSQL + `), m.created_at,
+		       m.last_uploaded_at`
+
+const mediaAssetTables = `media_assets m LEFT JOIN users u ON u.id = m.created_by`
+
+func mediaAssetScanDest(a *models.MediaAsset) []interface{} {
+	return []interface{}{
+		&a.ID, &a.OrgID, &a.URL, &a.StorageKey, &a.OriginalName, &a.MimeType, &a.MediaType,
+		&a.SizeBytes, &a.SHA256, &a.Width, &a.Height, &a.DurationSeconds,
+		&a.ThumbnailURL, &a.PreviewURL, &a.CreatedBy,
+		&a.CreatedByEmail, &a.ReferenceCount, &a.CreatedAt, &a.LastUploadedAt,
+	}
+}
+
+func loadMediaAsset(where string, args ...interface{}) (models.MediaAsset, error) {
+	var asset models.MediaAsset
+	err := database.DB.QueryRow(`
+		SELECT `+mediaAssetColumns+`
+		FROM `+mediaAssetTables+`
+		WHERE `+where, args...).Scan(mediaAssetScanDest(&asset)...)
+	return asset, err
+}
+
+// findMediaAssetByURL looks up the asset a media URL points at. It returns
+// sql.ErrNoRows for URLs outside media storage and files uploaded before
+// assets were recorded.
+func findMediaAssetByURL(url string) (models.MediaAsset, error) {
+	key, ok := storage.Default.KeyForURL(url)
+	if !ok {
+		return models.MediaAsset{}, sql.ErrNoRows
+	}
+	return loadMediaAsset("m.storage_key = ?", key)
+}
+
+// mediaFilter is a WHERE condition limiting assets (alias m) to those the
+// caller may see: the organization's, and for advertisers only the files
+// they uploaded, first or again.
+func mediaFilter(c *gin.Context) (string, []interface{}) {
+	orgSQL, args := orgFilter(c, "m.org_id")
+	if _, restricted := advertiserCompany(c); restricted {
+		userID := c.GetString("user_id")
+		return orgSQL + ` AND (m.created_by = ? OR EXISTS (
+			SELECT 1 FROM media_asset_uploaders mu WHERE mu.asset_id = m.id AND mu.user_id = ?))`,
+			append(args, userID, userID)
+	}
+	return orgSQL, args
+}
+
+// findOrgMediaAsset loads the asset of the :id parameter with the ads using
+// it. It writes the error response and returns false when the asset can't
+// be loaded or isn't visible to the caller.
+func findOrgMediaAsset(c *gin.Context) (models.MediaAsset, bool) {
+	filterSQL, args := mediaFilter(c)
+	asset, err := loadMediaAsset("m.id = ? AND "+filterSQL, append([]interface{}{c.Param("id")}, args...)...)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return asset, false
+	}
+	if err == nil {
+		asset.References, err = mediaReferences(asset)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return asset, false
+	}
+	return asset, true
+}
+
+// mediaReferences lists the ads using asset, once for each field it appears
+// in.
+func mediaReferences(asset models.MediaAsset) ([]models.MediaReference, error) {
+	rows, err := database.DB.Query(`
+		SELECT a.id, a.title, a.status, a.media_url, a.gallery_images
+		FROM ads a, (SELECT ? AS org_id, ? AS url) m
+		WHERE `+mediaReferenceSQL+`
+		ORDER BY a.order_index, a.id
+	`, asset.OrgID, asset.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	references := []models.MediaReference{}
+	for rows.Next() {
+		var id, title, status, mediaURL string
+		var gallery models.StringArray
+		if err := rows.Scan(&id, &title, &status, &mediaURL, &gallery); err != nil {
+			return nil, err
+		}
+		if mediaURL == asset.URL {
+			references = append(references, models.MediaReference{AdID: id, Title: title, Status: status, Field: "media_url"})
+		}
+		for _, url := range gallery {
+			if url == asset.URL {
+				references = append(references, models.MediaReference{AdID: id, Title: title, Status: status, Field: "gallery_images"})
+				break
+			}
+		}
+	}
+	return references, rows.Err()
+}
+
+// checkMediaType makes sure the uploads an ad refers to are of the type it
+// declares: media_url of mediaType and gallery images of images. It writes
+// the error response and returns false when they are not.
+func checkMediaType(c *gin.Context, mediaURL, mediaType string, galleryImages []string) bool {
+	check := func(field, url, want string) bool {
+		asset, err := findMediaAssetByURL(url)
+		if err == sql.ErrNoRows {
+			return true
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return false
+		}
+		if asset.MediaType != want {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": field + " is " + article(asset.MediaType) + " " + asset.MediaType + ", not " + article(want) + " " + want,
+			})
+			return false
+		}
+		return true
+	}
+
+	if mediaURL != "" && !check("media_url", mediaURL, mediaType) {
+		return false
+	}
+	for _, url := range galleryImages {
+		if !check("gallery_images", url, media.TypeImage) {
+			return false
+		}
+	}
+	return true
+}
+
+func article(mediaType string) string {
+	if mediaType == media.TypeImage {
+		return "an"
+	}
+	return "a"
+}
+
+type MediaHandler struct {
+	cfg *config.Config
+}
+
+func NewMediaHandler(cfg *config.Config) *MediaHandler {
+	return &MediaHandler{cfg: cfg}
+}
+
+// GetMedia lists the media library of the caller's organization, newest
+// first; advertisers only see their own uploads. Optional filters: search
+// (matches the original file name), type (image, video or pdf), mime_type
+// and in_use (true or false).
+func (h *MediaHandler) GetMedia(c *gin.Context) {
+	page, limit := pagination(c)
+
+	filterSQL, args := mediaFilter(c)
+	where := []string{filterSQL}
+	if search := strings.TrimSpace(c.Query("search")); search != "" {
+		where = append(where, "m.original_name LIKE ?")
+		args = append(args, "%"+search+"%")
+	}
+	if mediaType := c.Query("type"); mediaType != "" {
+		where = append(where, "m.media_type = ?")
+		args = append(args, mediaType)
+	}
+	if mimeType := c.Query("mime_type"); mimeType != "" {
+		where = append(where, "m.mime_type = ?")
+		args = append(args, mimeType)
+	}
+	switch c.Query("in_use") {
+	case "true":
+		where = append(where, "EXISTS (SELECT 1 FROM ads a WHERE "+mediaReferenceSQL+")")
+	case "false":
+		where = append(where, "NOT EXISTS (SELECT 1 FROM ads a WHERE "+mediaReferenceSQL+")")
+	}
+	whereSQL := strings.Join(where, " AND ")
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM media_assets m WHERE "+whereSQL, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch media"})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT `+mediaAssetColumns+`
+		FROM `+mediaAssetTables+`
+		WHERE `+whereSQL+`
+		ORDER BY m.created_at DESC, m.id
+		LIMIT ? OFFSET ?
+	`, append(args, limit, (page-1)*limit)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch media"})
+		return
+	}
+	defer rows.Close()
+
+	assets := []models.MediaAsset{}
+	for rows.Next() {
+		var asset models.MediaAsset
+		if err := rows.Scan(mediaAssetScanDest(&asset)...); err != nil {
+			continue
+		}
+		assets = append(assets, asset)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"assets": assets,
+		"total":  total,
+		"page":   page,
+		"limit":  limit,
+	})
+}
+
+// GetMediaByID returns an asset with the ads using it.
+func (h *MediaHandler) GetMediaByID(c *gin.Context) {
+	asset, ok := findOrgMediaAsset(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, asset)
+}
+
+// DeleteMedia deletes an asset and its file. Assets still used by an ad
+// can't be deleted; the response lists those ads.
+func (h *MediaHandler) DeleteMedia(c *gin.Context) {
+	asset, ok := findOrgMediaAsset(c)
+	if !ok {
+		return
+	}
+	if len(asset.References) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Media is still in use", "references": asset.References})
+		return
+	}
+
+	deleted, err := deleteMediaAsset(c, asset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete media"})
+		return
+	}
+	if !deleted {
+		// An ad started using it in the meantime
+		c.JSON(http.StatusConflict, gin.H{"error": "Media is still in use"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Media deleted successfully"})
+}
+
+// DeleteOrphanedMedia deletes the assets visible to the caller that no ad
+// uses and that weren't uploaded, first or again, within min_age_hours
+// (default 24), so files uploaded for an ad that isn't saved yet are left
+// alone. With dry_run=true it only lists them.
+func (h *MediaHandler) DeleteOrphanedMedia(c *gin.Context) {
+	minAgeHours, err := strconv.Atoi(c.DefaultQuery("min_age_hours", "24"))
+	if err != nil || minAgeHours < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "min_age_hours must be a whole number of hours"})
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+
+	filterSQL, args := mediaFilter(c)
+	rows, err := database.DB.Query(`
+		SELECT `+mediaAssetColumns+`
+		FROM `+mediaAssetTables+`
+		WHERE `+filterSQL+` AND COALESCE(m.last_uploaded_at, m.created_at) < ?
+		  AND NOT EXISTS (SELECT 1 FROM ads a WHERE `+mediaReferenceSQL+`)
+		ORDER BY m.created_at, m.id
+	`, append(args, time.Now().Add(-time.Duration(minAgeHours)*time.Hour))...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch media"})
+		return
+	}
+	orphans := []models.MediaAsset{}
+	for rows.Next() {
+		var asset models.MediaAsset
+		if err := rows.Scan(mediaAssetScanDest(&asset)...); err != nil {
+			continue
+		}
+		orphans = append(orphans, asset)
+	}
+	rows.Close()
+
+	if dryRun {
+		c.JSON(http.StatusOK, gin.H{"assets": orphans, "count": len(orphans), "dry_run": true})
+		return
+	}
+
+	deleted := []models.MediaAsset{}
+	for _, asset := range orphans {
+		ok, err := deleteMediaAsset(c, asset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete media", "assets": deleted, "count": len(deleted)})
+			return
+		}
+		if ok {
+			deleted = append(deleted, asset)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"assets": deleted, "count": len(deleted), "dry_run": false})
+}
+
+// deleteMediaAsset removes the record of an asset, unless an ad uses it by
+// now, and then its file. It reports whether the asset was deleted.
+func deleteMediaAsset(c *gin.Context, asset models.MediaAsset) (bool, error) {
+	result, err := database.DB.Exec(`
+		DELETE m FROM media_assets m
+		WHERE m.id = ? AND NOT EXISTS (SELECT 1 FROM ads a WHERE `+mediaReferenceSQL+`)
+	`, asset.ID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	// Without its record the files can't be found again, so a failure here
+	// only leaves stray files behind
+	deleteMediaFiles(asset)
+
+	recordAudit(c, audit.ActionMediaDeleted, "media", asset.StorageKey, asset, nil)
+	return true, nil
+}
+
+// deleteMediaFiles deletes the stored files of an asset: the original and
+// its renditions.
+func deleteMediaFiles(asset models.MediaAsset) {
+	keys := []string{asset.StorageKey}
+	for _, url := range []*string{asset.ThumbnailURL, asset.PreviewURL} {
+		if url == nil {
+			continue
+		}
+		if key, ok := storage.Default.KeyForURL(*url); ok && key != asset.StorageKey {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		if err := storage.Default.Delete(key); err != nil {
+			log.Printf("Failed to delete media file %s: %v", key, err)
+		}
+	}
+}
+
+// mediaRenditions returns the renditions of the asset mediaURL points at,
+// for storing with an ad. Both are nil for anything but uploaded images.
+func mediaRenditions(mediaURL string) (thumbnailURL, previewURL *string) {
+	asset, err := findMediaAssetByURL(mediaURL)
+	if err != nil {
+		return nil, nil
+	}
+	return asset.ThumbnailURL, asset.PreviewURL
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"digital-signage-backend/audit"
+	"digital-signage-backend/config"
+	"digital-signage-backend/database"
+	"digital-signage-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// isSuperAdmin reports whether the caller works across organizations. API
+// keys never do: they carry no role and stay in the organization they were
+// created in.
+func isSuperAdmin(c *gin.Context) bool {
+	return c.GetString("user_role") == models.RoleSuperAdmin
+}
+
+// orgScope is the organization a request is limited to, or "" for every
+// organization. Users and API keys get their own; super admins see them all
+// unless they pick one with ?org_id=. Devices get theirs, and anonymous
+// callers of the public endpoints name one with ?org_id= or fall back to the
+// default organization, which is what players set up before organizations
+// existed expect.
+func orgScope(c *gin.Context) string {
+	if isSuperAdmin(c) {
+		return c.Query("org_id")
+	}
+	if orgID := c.GetString("org_id"); orgID != "" {
+		return orgID
+	}
+	if orgID := c.GetString("device_org_id"); orgID != "" {
+		return orgID
+	}
+	if orgID := c.Query("org_id"); orgID != "" {
+		return orgID
+	}
+	return models.DefaultOrgID
+}
+
+// orgFilter is a WHERE condition limiting column to orgScope.
+func orgFilter(c *gin.Context, column string) (string, []interface{}) {
+	if orgID := orgScope(c); orgID != "" {
+		return column + " = ?", []interface{}{orgID}
+	}
+	return "1 = 1", nil
+}
+
+// inOrg reports whether something belonging to orgID is visible to the
+// caller. Anything outside the caller's scope is reported as not found.
+func inOrg(c *gin.Context, orgID string) bool {
+	scope := orgScope(c)
+	return scope == "" || scope == orgID
+}
+
+// targetOrg is the organization new entities are created in: the caller's
+// own, or for super admins the one named by ?org_id=. It writes the error
+// response and returns false when that organization doesn't exist.
+func targetOrg(c *gin.Context) (string, bool) {
+	orgID := c.GetString("org_id")
+	if requested := c.Query("org_id"); requested != "" && isSuperAdmin(c) {
+		orgID = requested
+	}
+
+	var exists bool
+	if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM organizations WHERE id = ?)", orgID).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return "", false
+	}
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Organization not found"})
+		return "", false
+	}
+	return orgID, true
+}
+
+type OrganizationHandler struct {
+	cfg *config.Config
+}
+
+func NewOrganizationHandler(cfg *config.Config) *OrganizationHandler {
+	return &OrganizationHandler{cfg: cfg}
+}
+
+// organizationColumns is the column list scanned by organizationScanDest.
+const organizationColumns = `o.id, o.name,
+		       (SELECT COUNT(*) FROM users WHERE org_id = o.id),
+		       (SELECT COUNT(*) FROM devices WHERE org_id = o.id),
+		       (SELECT COUNT(*) FROM ads WHERE org_id = o.id AND is_deleted = false),
+		       o.created_at, o.updated_at`
+
+func organizationScanDest(org *models.Organization) []interface{} {
+	return []interface{}{
+		&org.ID, &org.Name, &org.UserCount, &org.DeviceCount, &org.AdCount, &org.CreatedAt, &org.UpdatedAt,
+	}
+}
+
+func (h *OrganizationHandler) GetOrganizations(c *gin.Context) {
+	rows, err := database.DB.Query(`
+		SELECT ` + organizationColumns + `
+		FROM organizations o
+		ORDER BY o.name
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch organizations"})
+		return
+	}
+	defer rows.Close()
+
+	orgs := []models.Organization{}
+	for rows.Next() {
+		var org models.Organization
+		if err := rows.Scan(organizationScanDest(&org)...); err != nil {
+			continue
+		}
+		orgs = append(orgs, org)
+	}
+
+	c.JSON(http.StatusOK, orgs)
+}
+
+func (h *OrganizationHandler) GetOrganizationByID(c *gin.Context) {
+	org, err := loadOrganization(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
+	var req models.CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name must not be empty"})
+		return
+	}
+
+	if taken, err := organizationNameTaken(name, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	} else if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "An organization with this name already exists"})
+		return
+	}
+
+	orgID := uuid.New().String()
+	if _, err := database.DB.Exec("INSERT INTO organizations (id, name) VALUES (?, ?)", orgID, name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create organization"})
+		return
+	}
+
+	org, err := loadOrganization(orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve created organization"})
+		return
+	}
+
+	recordAudit(c, audit.ActionOrganizationCreated, "organization", org.ID, nil, org)
+
+	c.JSON(http.StatusCreated, org)
+}
+
+func (h *OrganizationHandler) UpdateOrganization(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.UpdateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+	name := strings.TrimSpace(*req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name must not be empty"})
+		return
+	}
+
+	before, err := loadOrganization(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if taken, err := organizationNameTaken(name, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	} else if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "An organization with this name already exists"})
+		return
+	}
+
+	if _, err := database.DB.Exec("UPDATE organizations SET name = ? WHERE id = ?", name, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update organization"})
+		return
+	}
+
+	org, err := loadOrganization(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get updated organization"})
+		return
+	}
+
+	recordAudit(c, audit.ActionOrganizationUpdated, "organization", id, before, org)
+
+	c.JSON(http.StatusOK, org)
+}
+
+// DeleteOrganization removes an empty organization. Its users, devices and
+// content have to be deleted first; the default organization is permanent.
+func (h *OrganizationHandler) DeleteOrganization(c *gin.Context) {
+	id := c.Param("id")
+	if id == models.DefaultOrgID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The default organization cannot be deleted"})
+		return
+	}
+
+	before, err := loadOrganization(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Soft-deleted ads still reference the organization
+	var inUse bool
+	err = database.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM users WHERE org_id = ?)
+		    OR EXISTS(SELECT 1 FROM devices WHERE org_id = ?)
+		    OR EXISTS(SELECT 1 FROM ads WHERE org_id = ?)
+		    OR EXISTS(SELECT 1 FROM playlists WHERE org_id = ?)
+		    OR EXISTS(SELECT 1 FROM device_groups WHERE org_id = ?)
+		    OR EXISTS(SELECT 1 FROM api_keys WHERE org_id = ?)
+	`, id, id, id, id, id, id).Scan(&inUse)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if inUse {
+		c.JSON(http.StatusConflict, gin.H{"error": "Organization still has users, devices or content"})
+		return
+	}
+
+	if _, err := database.DB.Exec("DELETE FROM organizations WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete organization"})
+		return
+	}
+
+	recordAudit(c, audit.ActionOrganizationDeleted, "organization", id, before, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Organization deleted successfully"})
+}
+
+func loadOrganization(id string) (models.Organization, error) {
+	var org models.Organization
+	err := database.DB.QueryRow(`
+		SELECT `+organizationColumns+`
+		FROM organizations o WHERE o.id = ?
+	`, id).Scan(organizationScanDest(&org)...)
+	return org, err
+}
+
+func organizationNameTaken(name, exceptID string) (bool, error) {
+	var taken bool
+	err := database.DB.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM organizations WHERE name = ? AND id <> ?)", name, exceptID,
+	).Scan(&taken)
+	return taken, err
+}
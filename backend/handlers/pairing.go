@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"digital-signage-backend/audit"
+	"digital-signage-backend/database"
+	"digital-signage-backend/models"
+	"digital-signage-backend/presence"
+	"digital-signage-backend/realtime"
+	"digital-signage-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const pairingCodeLength = 6
+
+// RequestPairing is called by an unpaired device. It returns a short code to
+// show on screen and a secret the device uses to collect its credential once
+// an admin has claimed the code. Requests are rate limited per IP address.
+func (h *DeviceHandler) RequestPairing(c *gin.Context) {
+	var req models.RequestPairingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	window := time.Duration(h.cfg.PairingRateWindowMinutes) * time.Minute
+	if rateLimited(c, rateLimitPairingIP, c.ClientIP(), h.cfg.PairingMaxRequestsPerIP, window) {
+		return
+	}
+	if err := purgeExpiredPairings(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start pairing"})
+		return
+	}
+
+	if req.DeviceID == "" {
+		req.DeviceID = uuid.New().String()
+	}
+
+	secret, err := utils.GenerateSecureToken("", 32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start pairing"})
+		return
+	}
+
+	pairingID := uuid.New().String()
+	expiresAt := time.Now().Add(time.Duration(h.cfg.PairingCodeTTLMinutes) * time.Minute)
+
+	// Retry on the rare collision with another live code
+	var code string
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err = utils.GenerateCode(pairingCodeLength)
+		if err != nil {
+			break
+		}
+		_, err = database.DB.Exec(`
+			INSERT INTO device_pairings (id, code, secret_hash, hardware_id, status, expires_at)
+			VALUES (?, ?, ?, ?, 'pending', ?)
+		`, pairingID, code, utils.HashToken(secret), req.DeviceID, expiresAt)
+		if err == nil || !strings.Contains(err.Error(), "Duplicate entry") {
+			break
+		}
+		// The code may belong to an expired pairing that can be discarded
+		database.DB.Exec("DELETE FROM device_pairings WHERE code = ? AND expires_at < NOW() AND status <> 'completed'", code)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start pairing"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"pairing_id":     pairingID,
+		"pairing_secret": secret,
+		"code":           code,
+		"device_id":      req.DeviceID,
+		"expires_at":     expiresAt,
+	})
+}
+
+// ClaimPairing is called by an admin with the code shown on the screen. It
+// creates the device in the admin's organization, or re-pairs it if the
+// hardware id is already known there. The hardware id comes from the
+// unauthenticated device, so re-pairing a device that still has a credential
+// has to be confirmed with "repair".
+func (h *DeviceHandler) ClaimPairing(c *gin.Context) {
+	var req models.ClaimPairingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	orgID, ok := targetOrg(c)
+	if !ok {
+		return
+	}
+
+	timezone := req.Timezone
+	if timezone == "" {
+		timezone = h.cfg.DefaultTimezone
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var pairingID, hardwareID, status string
+	var expiresAt time.Time
+	err = tx.QueryRow(`
+		SELECT id, hardware_id, status, expires_at FROM device_pairings
+		WHERE code = ? FOR UPDATE
+	`, strings.ToUpper(strings.TrimSpace(req.Code))).Scan(&pairingID, &hardwareID, &status, &expiresAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pairing code not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if status != models.PairingStatusPending || time.Now().After(expiresAt) {
+		c.JSON(http.StatusGone, gin.H{"error": "Pairing code expired or already used"})
+		return
+	}
+
+	// A re-paired device is audited with its previous state
+	var before interface{}
+	if existing, err := findDevice(hardwareID); err == nil {
+		before = existing
+	}
+
+	var deviceRowID, deviceOrgID string
+	var paired bool
+	err = tx.QueryRow(`
+		SELECT id, org_id, token_hash IS NOT NULL FROM devices WHERE device_id = ?
+	`, hardwareID).Scan(&deviceRowID, &deviceOrgID, &paired)
+	if err == nil && deviceOrgID != orgID {
+		// Moving a screen between organizations means deleting it first
+		c.JSON(http.StatusConflict, gin.H{"error": "Device is registered to another organization"})
+		return
+	}
+	if err == nil && paired && !req.Repair {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     "Device is already paired, set repair to replace its credential",
+			"device_id": deviceRowID,
+		})
+		return
+	}
+	if err == sql.ErrNoRows {
+		deviceRowID = uuid.New().String()
+		defaultSettings := models.DeviceSettings{
+			SlideshowInterval: 5,
+			VideoAutoplay:     true,
+			EnabledAds:        []string{},
+		}
+		_, err = tx.Exec(`
+			INSERT INTO devices (id, org_id, device_id, location, timezone, is_online, settings)
+			VALUES (?, ?, ?, ?, ?, false, ?)
+		`, deviceRowID, orgID, hardwareID, req.Location, timezone, defaultSettings)
+	} else if err == nil {
+		// Re-pairing invalidates the previous credential
+		_, err = tx.Exec(`
+			UPDATE devices SET location = ?, timezone = ?, token_hash = NULL
+			WHERE id = ?
+		`, req.Location, timezone, deviceRowID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE device_pairings SET status = 'claimed', device_id = ?, claimed_by = ?, claimed_at = NOW()
+		WHERE id = ?
+	`, deviceRowID, userID, pairingID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim pairing"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	device, err := findDevice(deviceRowID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve device"})
+		return
+	}
+
+	recordAudit(c, audit.ActionDeviceClaimed, "device", device.ID, before, device)
+
+	c.JSON(http.StatusOK, device)
+}
+
+// PairingStatus is polled by the device. Once the code has been claimed it
+// returns the device's long-lived credential, exactly once.
+func (h *DeviceHandler) PairingStatus(c *gin.Context) {
+	var req models.PairingStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var status string
+	var deviceRowID sql.NullString
+	var expiresAt time.Time
+	err = tx.QueryRow(`
+		SELECT status, device_id, expires_at FROM device_pairings
+		WHERE id = ? AND secret_hash = ? FOR UPDATE
+	`, req.PairingID, utils.HashToken(req.PairingSecret)).Scan(&status, &deviceRowID, &expiresAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pairing not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	switch {
+	case status == models.PairingStatusCompleted:
+		c.JSON(http.StatusGone, gin.H{"error": "Credential already issued"})
+		return
+	case status == models.PairingStatusPending && time.Now().After(expiresAt):
+		c.JSON(http.StatusGone, gin.H{"error": "Pairing code expired"})
+		return
+	case status == models.PairingStatusPending:
+		c.JSON(http.StatusAccepted, gin.H{"status": status, "expires_at": expiresAt})
+		return
+	}
+
+	token, err := utils.GenerateSecureToken("dvc_", 32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue credential"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE devices SET token_hash = ?, token_issued_at = NOW()
+		WHERE id = ?
+	`, utils.HashToken(token), deviceRowID.String)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue credential"})
+		return
+	}
+	if _, err := tx.Exec("UPDATE device_pairings SET status = 'completed' WHERE id = ?", req.PairingID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue credential"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	if err := presence.MarkOnline(deviceRowID.String, presence.ReasonPairing); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device"})
+		return
+	}
+
+	device, err := findDevice(deviceRowID.String)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve device"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":       models.PairingStatusCompleted,
+		"device":       device,
+		"device_token": token,
+	})
+}
+
+// RevokeDeviceCredential invalidates a device's credential. The device has
+// to pair again before it can call device routes.
+func (h *DeviceHandler) RevokeDeviceCredential(c *gin.Context) {
+	device, err := findOrgDevice(c, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	_, err = database.DB.Exec(`
+		UPDATE devices SET token_hash = NULL, token_issued_at = NULL
+		WHERE id = ?
+	`, device.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke credential"})
+		return
+	}
+	if err := presence.MarkOffline(device.ID, presence.ReasonRevoked); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke credential"})
+		return
+	}
+
+	realtime.Default.Disconnect(device.ID)
+	entry := auditEntry(c, audit.ActionDeviceCredentialRevoked, "device", device.ID, nil, nil)
+	entry.OrgID = device.OrgID
+	audit.Record(entry)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device credential revoked"})
+}
+
+// purgeExpiredPairings deletes codes that ran out before being claimed, and
+// claimed ones a day after they ran out; a device collects its credential
+// within seconds of the claim.
+func purgeExpiredPairings() error {
+	_, err := database.DB.Exec(`
+		DELETE FROM device_pairings
+		WHERE (status = 'pending' AND expires_at < NOW())
+		   OR expires_at < NOW() - INTERVAL 1 DAY
+	`)
+	return err
+}
@@ -0,0 +1,647 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"digital-signage-backend/audit"
+	"digital-signage-backend/config"
+	"digital-signage-backend/database"
+	"digital-signage-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type PlaylistHandler struct {
+	cfg *config.Config
+}
+
+func NewPlaylistHandler(cfg *config.Config) *PlaylistHandler {
+	return &PlaylistHandler{cfg: cfg}
+}
+
+func (h *PlaylistHandler) GetPlaylists(c *gin.Context) {
+	orgSQL, args := orgFilter(c, "org_id")
+	rows, err := database.DB.Query(`
+		SELECT id, org_id, name, COALESCE(description, ''), created_by, created_at, updated_at
+		FROM playlists WHERE `+orgSQL+`
+		ORDER BY name
+	`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch playlists"})
+		return
+	}
+	defer rows.Close()
+
+	playlists := []models.Playlist{}
+	for rows.Next() {
+		var p models.Playlist
+		if err := rows.Scan(&p.ID, &p.OrgID, &p.Name, &p.Description, &p.CreatedBy, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			continue
+		}
+		playlists = append(playlists, p)
+	}
+
+	for i := range playlists {
+		playlists[i].Items, _ = loadPlaylistItems(playlists[i].ID, false)
+		playlists[i].Assignments, _ = loadPlaylistAssignments(playlists[i].ID)
+	}
+
+	c.JSON(http.StatusOK, playlists)
+}
+
+func (h *PlaylistHandler) GetPlaylistByID(c *gin.Context) {
+	playlist, err := loadOrgPlaylist(c, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, playlist)
+}
+
+func (h *PlaylistHandler) CreatePlaylist(c *gin.Context) {
+	var req models.CreatePlaylistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	orgID, ok := targetOrg(c)
+	if !ok {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	playlistID := uuid.New().String()
+	_, err = tx.Exec(`
+		INSERT INTO playlists (id, org_id, name, description, created_by)
+		VALUES (?, ?, ?, ?, ?)
+	`, playlistID, orgID, req.Name, req.Description, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create playlist"})
+		return
+	}
+
+	if !replacePlaylistItems(c, tx, orgID, playlistID, req.Items) {
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	playlist, err := loadPlaylist(playlistID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve created playlist"})
+		return
+	}
+
+	recordAudit(c, audit.ActionPlaylistCreated, "playlist", playlist.ID, nil, playlist)
+	notifyContentChanged(playlist.OrgID)
+
+	c.JSON(http.StatusCreated, playlist)
+}
+
+func (h *PlaylistHandler) UpdatePlaylist(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.UpdatePlaylistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := []string{}
+	args := []interface{}{}
+
+	if req.Name != nil {
+		updates = append(updates, "name = ?")
+		args = append(args, *req.Name)
+	}
+	if req.Description != nil {
+		updates = append(updates, "description = ?")
+		args = append(args, *req.Description)
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	before, err := loadOrgPlaylist(c, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	args = append(args, id)
+
+	query := "UPDATE playlists SET " + updates[0]
+	for i := 1; i < len(updates); i++ {
+		query += ", " + updates[i]
+	}
+	query += " WHERE id = ?"
+
+	if _, err := database.DB.Exec(query, args...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update playlist"})
+		return
+	}
+
+	playlist, err := loadPlaylist(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get updated playlist"})
+		return
+	}
+
+	recordAudit(c, audit.ActionPlaylistUpdated, "playlist", playlist.ID, before, playlist)
+	notifyContentChanged(playlist.OrgID)
+
+	c.JSON(http.StatusOK, playlist)
+}
+
+func (h *PlaylistHandler) DeletePlaylist(c *gin.Context) {
+	id := c.Param("id")
+	before, err := loadOrgPlaylist(c, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	result, err := database.DB.Exec("DELETE FROM playlists WHERE id = ?", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete playlist"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		return
+	}
+
+	recordAudit(c, audit.ActionPlaylistDeleted, "playlist", id, before, nil)
+	notifyContentChanged(before.OrgID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Playlist deleted successfully"})
+}
+
+// SetPlaylistItems replaces the ordered item list of a playlist.
+func (h *PlaylistHandler) SetPlaylistItems(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.SetPlaylistItemsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before, err := loadOrgPlaylist(c, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if !replacePlaylistItems(c, tx, before.OrgID, id, req.Items) {
+		return
+	}
+
+	// Touch the playlist so clients can tell its content changed
+	if _, err := tx.Exec("UPDATE playlists SET updated_at = NOW() WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update playlist"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	playlist, err := loadPlaylist(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get updated playlist"})
+		return
+	}
+
+	recordAudit(c, audit.ActionPlaylistItemsUpdated, "playlist", id, before, playlist)
+	notifyContentChanged(playlist.OrgID)
+
+	c.JSON(http.StatusOK, playlist)
+}
+
+// AssignPlaylist assigns a playlist to a device or location of its
+// organization, replacing any playlist previously assigned to the same
+// target.
+func (h *PlaylistHandler) AssignPlaylist(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.AssignPlaylistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before, err := loadOrgPlaylist(c, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	targetValue := req.TargetValue
+	if req.TargetType == models.PlaylistTargetDevice {
+		// Accept either the row id or the hardware device_id
+		device, err := findDevice(targetValue)
+		if err == sql.ErrNoRows || (err == nil && device.OrgID != before.OrgID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		targetValue = device.ID
+	}
+
+	_, err = database.DB.Exec(`
+		INSERT INTO playlist_assignments (id, org_id, playlist_id, target_type, target_value)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE playlist_id = VALUES(playlist_id), created_at = NOW()
+	`, uuid.New().String(), before.OrgID, id, req.TargetType, targetValue)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign playlist"})
+		return
+	}
+
+	playlist, err := loadPlaylist(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get playlist"})
+		return
+	}
+
+	recordAudit(c, audit.ActionPlaylistAssigned, "playlist", id, before, playlist)
+	notifyContentChanged(playlist.OrgID)
+
+	c.JSON(http.StatusOK, playlist)
+}
+
+func (h *PlaylistHandler) UnassignPlaylist(c *gin.Context) {
+	id := c.Param("id")
+	before, err := loadOrgPlaylist(c, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	result, err := database.DB.Exec(`
+		DELETE FROM playlist_assignments WHERE id = ? AND playlist_id = ?
+	`, c.Param("assignmentId"), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove assignment"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+		return
+	}
+
+	if playlist, err := loadPlaylist(id); err == nil {
+		recordAudit(c, audit.ActionPlaylistUnassigned, "playlist", id, before, playlist)
+	}
+	notifyContentChanged(before.OrgID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Assignment removed successfully"})
+}
+
+// GetDevicePlaylist returns what a device should play: its resolved
+// playlist, or the location-filtered ads list when no playlist is assigned.
+func (h *PlaylistHandler) GetDevicePlaylist(c *gin.Context) {
+	device, err := findDevice(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !authorizeDevice(c, device.ID) {
+		return
+	}
+
+	loc, err := time.LoadLocation(device.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	playlist, source, err := resolvePlaylist(device)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve playlist"})
+		return
+	}
+
+	ads, err := deviceAds(device, playlist)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ads"})
+		return
+	}
+
+	now := time.Now()
+	live := []models.Ad{}
+	for _, ad := range ads {
+		if ad.IsLiveAt(now, loc) {
+			live = append(live, ad)
+		}
+	}
+
+	response := gin.H{
+		"device_id": device.ID,
+		"source":    source,
+		"ads":       live,
+	}
+	if playlist != nil {
+		response["playlist_id"] = playlist.ID
+		response["playlist_name"] = playlist.Name
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// resolvePlaylist returns the playlist assigned to the device, preferring a
+// direct device assignment over one for the device's location. Location
+// assignments only apply within the device's organization. The source is
+// "device", "location" or "default" when nothing is assigned.
+func resolvePlaylist(device models.Device) (*models.Playlist, string, error) {
+	var p models.Playlist
+	var targetType string
+	err := database.DB.QueryRow(`
+		SELECT p.id, p.org_id, p.name, COALESCE(p.description, ''), p.created_by, p.created_at, p.updated_at, pa.target_type
+		FROM playlist_assignments pa
+		JOIN playlists p ON p.id = pa.playlist_id
+		WHERE pa.org_id = ?
+		  AND ((pa.target_type = 'device' AND pa.target_value = ?)
+		   OR (pa.target_type = 'location' AND pa.target_value = ?))
+		ORDER BY pa.target_type = 'device' DESC
+		LIMIT 1
+	`, device.OrgID, device.ID, device.Location).Scan(&p.ID, &p.OrgID, &p.Name, &p.Description, &p.CreatedBy, &p.CreatedAt, &p.UpdatedAt, &targetType)
+	if err == sql.ErrNoRows {
+		return nil, "default", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return &p, targetType, nil
+}
+
+// deviceAds returns the ads of the playlist with per-item durations applied,
+// or every ad targeting the device when playlist is nil.
+func deviceAds(device models.Device, playlist *models.Playlist) ([]models.Ad, error) {
+	if playlist == nil {
+		subject, err := deviceSubject(device)
+		if err != nil {
+			return nil, err
+		}
+		ads, err := loadAds(device.OrgID, true)
+		if err != nil {
+			return nil, err
+		}
+		filtered := []models.Ad{}
+		for _, ad := range ads {
+			if ad.Targets(subject) {
+				filtered = append(filtered, ad)
+			}
+		}
+		return filtered, nil
+	}
+
+	items, err := loadPlaylistItems(playlist.ID, true)
+	if err != nil {
+		return nil, err
+	}
+	ads := []models.Ad{}
+	for _, item := range items {
+		if item.Ad == nil {
+			continue
+		}
+		ad := *item.Ad
+		ad.OrderIndex = item.Position
+		if item.DurationSeconds != nil {
+			ad.DurationSeconds = *item.DurationSeconds
+		}
+		ads = append(ads, ad)
+	}
+	return ads, nil
+}
+
+func loadPlaylist(id string) (*models.Playlist, error) {
+	var p models.Playlist
+	err := database.DB.QueryRow(`
+		SELECT id, org_id, name, COALESCE(description, ''), created_by, created_at, updated_at
+		FROM playlists WHERE id = ?
+	`, id).Scan(&p.ID, &p.OrgID, &p.Name, &p.Description, &p.CreatedBy, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Items, err = loadPlaylistItems(id, true); err != nil {
+		return nil, err
+	}
+	if p.Assignments, err = loadPlaylistAssignments(id); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// loadOrgPlaylist is loadPlaylist limited to the caller's organization.
+func loadOrgPlaylist(c *gin.Context, id string) (*models.Playlist, error) {
+	p, err := loadPlaylist(id)
+	if err == nil && !inOrg(c, p.OrgID) {
+		return nil, sql.ErrNoRows
+	}
+	return p, err
+}
+
+// loadPlaylistItems returns the items in position order, skipping deleted
+// ads. withAds also attaches the full ad to each item.
+func loadPlaylistItems(playlistID string, withAds bool) ([]models.PlaylistItem, error) {
+	rows, err := database.DB.Query(`
+		SELECT pi.id, pi.playlist_id, pi.ad_id, pi.position, pi.duration_seconds
+		FROM playlist_items pi
+		JOIN ads a ON a.id = pi.ad_id
+		WHERE pi.playlist_id = ? AND a.is_deleted = false
+		ORDER BY pi.position ASC
+	`, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.PlaylistItem{}
+	for rows.Next() {
+		var item models.PlaylistItem
+		if err := rows.Scan(&item.ID, &item.PlaylistID, &item.AdID, &item.Position, &item.DurationSeconds); err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if withAds && len(items) > 0 {
+		ids := make([]string, len(items))
+		for i, item := range items {
+			ids[i] = item.AdID
+		}
+		inSQL, args := inList(ids)
+		adRows, err := database.DB.Query(`
+			SELECT `+adColumns+`
+			FROM ads WHERE id IN `+inSQL, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer adRows.Close()
+
+		ads := map[string]*models.Ad{}
+		for adRows.Next() {
+			var ad models.Ad
+			if err := adRows.Scan(adScanDest(&ad)...); err != nil {
+				continue
+			}
+			ads[ad.ID] = &ad
+		}
+		if err := adRows.Err(); err != nil {
+			return nil, err
+		}
+		// An ad used twice is shared by both items
+		for i := range items {
+			items[i].Ad = ads[items[i].AdID]
+		}
+	}
+	return items, nil
+}
+
+func loadPlaylistAssignments(playlistID string) ([]models.PlaylistAssignment, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, playlist_id, target_type, target_value, created_at
+		FROM playlist_assignments
+		WHERE playlist_id = ?
+		ORDER BY target_type, target_value
+	`, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := []models.PlaylistAssignment{}
+	for rows.Next() {
+		var a models.PlaylistAssignment
+		if err := rows.Scan(&a.ID, &a.PlaylistID, &a.TargetType, &a.TargetValue, &a.CreatedAt); err != nil {
+			continue
+		}
+		assignments = append(assignments, a)
+	}
+	return assignments, rows.Err()
+}
+
+// replacePlaylistItems rewrites the items of a playlist inside tx. Ads must
+// belong to the playlist's organization. It writes the error response and
+// returns false when the items can't be saved.
+func replacePlaylistItems(c *gin.Context, tx *sql.Tx, orgID, playlistID string, items []models.PlaylistItemInput) bool {
+	if _, err := tx.Exec("DELETE FROM playlist_items WHERE playlist_id = ?", playlistID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save playlist items"})
+		return false
+	}
+	if len(items) == 0 {
+		return true
+	}
+
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.AdID
+	}
+	inSQL, args := inList(ids)
+	rows, err := tx.Query(
+		"SELECT id FROM ads WHERE org_id = ? AND is_deleted = false AND id IN "+inSQL,
+		append([]interface{}{orgID}, args...)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save playlist items"})
+		return false
+	}
+	found := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			found[id] = true
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save playlist items"})
+		return false
+	}
+
+	for position, item := range items {
+		if !found[item.AdID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ad " + item.AdID + " not found"})
+			return false
+		}
+
+		_, err := tx.Exec(`
+			INSERT INTO playlist_items (id, playlist_id, ad_id, position, duration_seconds)
+			VALUES (?, ?, ?, ?, ?)
+		`, uuid.New().String(), playlistID, item.AdID, position, item.DurationSeconds)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save playlist items"})
+			return false
+		}
+	}
+	return true
+}
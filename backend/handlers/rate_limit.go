@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"digital-signage-backend/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rate limit scopes. Unlike login throttling, rate limits count ordinary
+// requests: nothing is a failure, there is no backoff and no lockout, only a
+// cap per fixed window.
+const (
+	rateLimitPairingIP = "pairing_ip"
+)
+
+// rateLimited counts a request against scope and subject, and answers 429
+// with Retry-After once more than limit requests were made in the current
+// window. A limit of 0 or less turns the check off.
+func rateLimited(c *gin.Context, scope, subject string, limit int64, window time.Duration) bool {
+	if limit <= 0 || window <= 0 {
+		return false
+	}
+	seconds := int64(window / time.Second)
+
+	// Windows are timed by the database so every API instance agrees
+	_, err := database.DB.Exec(`
+		INSERT INTO rate_limits (scope, subject, window_start, hits)
+		VALUES (?, ?, NOW(), 1)
+		ON DUPLICATE KEY UPDATE
+			hits = IF(window_start <= NOW() - INTERVAL ? SECOND, 1, hits + 1),
+			window_start = IF(window_start <= NOW() - INTERVAL ? SECOND, NOW(), window_start)
+	`, scope, subject, seconds, seconds)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return true
+	}
+
+	var hits, remaining int64
+	err = database.DB.QueryRow(`
+		SELECT hits, TIMESTAMPDIFF(SECOND, NOW(), window_start + INTERVAL ? SECOND)
+		FROM rate_limits WHERE scope = ? AND subject = ?
+	`, seconds, scope, subject).Scan(&hits, &remaining)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return true
+	}
+
+	// Windows that ended are only reset by their next request; forget the
+	// ones nobody came back for
+	database.DB.Exec(`
+		DELETE FROM rate_limits
+		WHERE scope = ? AND window_start < NOW() - INTERVAL ? SECOND
+	`, scope, seconds)
+
+	if hits <= limit {
+		return false
+	}
+	if remaining < 1 {
+		remaining = 1
+	}
+	c.Header("Retry-After", strconv.FormatInt(remaining, 10))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many requests, try again later",
+		"retry_after": remaining,
+	})
+	return true
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"digital-signage-backend/database/dbtest"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hits := map[string]int64{}
+	dbtest.Use(t, func(query string, args []driver.Value) dbtest.Result {
+		switch {
+		case strings.HasPrefix(query, "INSERT INTO rate_limits"):
+			hits[args[1].(string)]++
+			return dbtest.Result{RowsAffected: 1}
+		case strings.HasPrefix(query, "SELECT hits"):
+			return dbtest.Result{
+				Columns: []string{"hits", "remaining"},
+				Rows:    [][]driver.Value{{hits[args[2].(string)], int64(420)}},
+			}
+		case strings.HasPrefix(query, "DELETE FROM rate_limits"):
+			return dbtest.Result{}
+		}
+		t.Errorf("unexpected statement: %s", query)
+		return dbtest.Result{}
+	})
+
+	request := func(subject string, limit int64) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		if rateLimited(c, rateLimitPairingIP, subject, limit, 10*time.Minute) && w.Code == http.StatusOK {
+			t.Fatal("limited without writing a response")
+		}
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := request("10.0.0.1", 3); w.Code != http.StatusOK || w.Body.Len() != 0 {
+			t.Fatalf("request %d answered %d, want it let through", i+1, w.Code)
+		}
+	}
+	w := request("10.0.0.1", 3)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "420" {
+		t.Errorf("request over the limit = %d, Retry-After %q, want 429 after 420 seconds", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// Other subjects have their own count
+	if w := request("10.0.0.2", 3); w.Code != http.StatusOK {
+		t.Errorf("another address answered %d, want it let through", w.Code)
+	}
+	// No limit configured
+	if w := request("10.0.0.1", 0); w.Code != http.StatusOK {
+		t.Errorf("disabled limit answered %d", w.Code)
+	}
+}
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"digital-signage-backend/audit"
+	"digital-signage-backend/database"
+	"digital-signage-backend/models"
+	"digital-signage-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// sessionColumns is the column list scanned by sessionScanDest.
+const sessionColumns = `id, user_id, COALESCE(user_agent, ''), COALESCE(ip_address, ''),
+		       created_at, last_used_at, expires_at, revoked_at`
+
+func sessionScanDest(s *models.Session) []interface{} {
+	return []interface{}{
+		&s.ID, &s.UserID, &s.UserAgent, &s.IPAddress,
+		&s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &s.RevokedAt,
+	}
+}
+
+// issueSession starts a new session for user and returns its first access
+// and refresh tokens.
+func (h *AuthHandler) issueSession(c *gin.Context, user models.User) (models.AuthResponse, error) {
+	refreshToken, err := utils.GenerateSecureToken("rft_", 32)
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+
+	sessionID := uuid.New().String()
+	_, err = database.DB.Exec(`
+		INSERT INTO user_sessions (id, user_id, refresh_token_hash, user_agent, ip_address, last_used_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, NOW(), ?)
+	`, sessionID, user.ID, utils.HashToken(refreshToken), truncate(c.Request.UserAgent(), 255), c.ClientIP(),
+		time.Now().Add(h.refreshTTL()))
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+
+	return h.authResponse(user, sessionID, refreshToken)
+}
+
+func (h *AuthHandler) authResponse(user models.User, sessionID, refreshToken string) (models.AuthResponse, error) {
+	ttl := time.Duration(h.cfg.AccessTokenTTLMinutes) * time.Minute
+	token, err := utils.GenerateToken(user.ID, user.Email, user.Role, user.OrgID, sessionID, h.cfg.JWTSecret, ttl)
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+	user.Permissions = models.RolePermissions[user.Role]
+
+	return models.AuthResponse{
+		Token:        token,
+		ExpiresIn:    int64(ttl.Seconds()),
+		RefreshToken: refreshToken,
+		User:         user,
+	}, nil
+}
+
+func (h *AuthHandler) refreshTTL() time.Duration {
+	return time.Duration(h.cfg.RefreshTokenTTLDays) * 24 * time.Hour
+}
+
+// Refresh trades a refresh token for a new access token and a new refresh
+// token. Presenting a refresh token that was already rotated away means it
+// leaked, so the whole session is revoked.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokenHash := utils.HashToken(req.RefreshToken)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var session models.Session
+	var currentHash string
+	err = tx.QueryRow(`
+		SELECT `+sessionColumns+`, refresh_token_hash
+		FROM user_sessions
+		WHERE refresh_token_hash = ? OR previous_token_hash = ?
+		FOR UPDATE
+	`, tokenHash, tokenHash).Scan(append(sessionScanDest(&session), &currentHash)...)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if currentHash != tokenHash {
+		if session.RevokedAt == nil {
+			tx.Exec(`
+				UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = ?
+				WHERE id = ?
+			`, models.SessionRevokedRefreshReuse, session.ID)
+			tx.Commit()
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used; session revoked"})
+		return
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has expired or was revoked"})
+		return
+	}
+
+	user, err := loadUser(session.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User no longer exists"})
+		return
+	}
+	if user.IsDisabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is disabled"})
+		return
+	}
+
+	refreshToken, err := utils.GenerateSecureToken("rft_", 32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+	_, err = tx.Exec(`
+		UPDATE user_sessions
+		SET previous_token_hash = refresh_token_hash, refresh_token_hash = ?,
+		    last_used_at = NOW(), expires_at = ?, ip_address = ?
+		WHERE id = ?
+	`, utils.HashToken(refreshToken), time.Now().Add(h.refreshTTL()), c.ClientIP(), session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	response, err := h.authResponse(user, session.ID, refreshToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Logout revokes the session of the access token used for the request.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if !requireSession(c) {
+		return
+	}
+	_, err := database.DB.Exec(`
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = ?
+		WHERE id = ? AND revoked_at IS NULL
+	`, models.SessionRevokedLogout, c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	recordAudit(c, audit.ActionLogout, "session", c.GetString("session_id"), nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// LogoutAll revokes every session of the current user, this one included.
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	if !requireSession(c) {
+		return
+	}
+	revoked, err := revokeUserSessions(database.DB, c.GetString("user_id"), models.SessionRevokedLogoutAll)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	entry := auditEntry(c, audit.ActionLogoutAll, "user", c.GetString("user_id"), nil, nil)
+	entry.Details = map[string]interface{}{"revoked": revoked}
+	audit.Record(entry)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions", "revoked": revoked})
+}
+
+// GetSessions lists the current user's active sessions.
+func (h *AuthHandler) GetSessions(c *gin.Context) {
+	if !requireSession(c) {
+		return
+	}
+	sessions, err := activeSessions(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	current := c.GetString("session_id")
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession ends one of the current user's sessions, e.g. a forgotten
+// login on a shared computer.
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	if !requireSession(c) {
+		return
+	}
+	result, err := database.DB.Exec(`
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = ?
+		WHERE id = ? AND user_id = ? AND revoked_at IS NULL
+	`, models.SessionRevokedByUser, c.Param("sessionId"), c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	recordAudit(c, audit.ActionSessionRevoked, "session", c.Param("sessionId"), nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// GetUserSessions lets admins see where a user is logged in.
+func (h *UserHandler) GetUserSessions(c *gin.Context) {
+	if user, err := loadUser(c.Param("id")); err == sql.ErrNoRows || (err == nil && !inOrg(c, user.OrgID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	sessions, err := activeSessions(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+func activeSessions(userID string) ([]models.Session, error) {
+	rows, err := database.DB.Query(`
+		SELECT `+sessionColumns+`
+		FROM user_sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY last_used_at DESC
+	`, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var s models.Session
+		if err := rows.Scan(sessionScanDest(&s)...); err != nil {
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// revokeUserSessions ends every active session of a user.
+func revokeUserSessions(db execer, userID, reason string) (int64, error) {
+	result, err := db.Exec(`
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = ?
+		WHERE user_id = ? AND revoked_at IS NULL
+	`, reason, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// requireSession refuses requests made with an API key, which has no
+// session of its own and must not end its owner's sessions.
+func requireSession(c *gin.Context) bool {
+	if c.GetString("session_id") == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only available to logged-in users"})
+		return false
+	}
+	return true
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max]
+}
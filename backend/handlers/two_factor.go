@@ -0,0 +1,431 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"digital-signage-backend/audit"
+	"digital-signage-backend/database"
+	"digital-signage-backend/models"
+	"digital-signage-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// recoveryCodeCount is how many recovery codes a user gets at a time.
+const recoveryCodeCount = 10
+
+// GetTwoFactor reports whether 2FA is on and how many recovery codes are
+// left.
+func (h *AuthHandler) GetTwoFactor(c *gin.Context) {
+	userID := c.GetString("user_id")
+	_, enabled, err := loadTwoFactor(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var remaining int
+	err = database.DB.QueryRow(`
+		SELECT COUNT(*) FROM user_recovery_codes
+		WHERE user_id = ? AND used_at IS NULL
+	`, userID).Scan(&remaining)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  enabled,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// EnrollTwoFactor creates a new TOTP secret for the current user. 2FA is
+// only switched on once a code from the authenticator app is verified.
+func (h *AuthHandler) EnrollTwoFactor(c *gin.Context) {
+	if !requireSession(c) {
+		return
+	}
+	userID := c.GetString("user_id")
+	_, enabled, err := loadTwoFactor(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+	_, err = database.DB.Exec(`
+		UPDATE users SET totp_secret = ?, totp_last_step = NULL
+		WHERE id = ?
+	`, secret, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": utils.TOTPProvisioningURI(h.cfg.TOTPIssuer, c.GetString("user_email"), secret),
+	})
+}
+
+// VerifyTwoFactor finishes enrollment with a code from the authenticator
+// app and returns the recovery codes. They are shown only this once.
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	if !requireSession(c) {
+		return
+	}
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	secret, enabled, err := loadTwoFactor(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if secret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start enrollment first"})
+		return
+	}
+
+	step, ok := utils.ValidateTOTP(secret, req.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET totp_enabled = true, totp_last_step = ? WHERE id = ?", step, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create recovery codes"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	recordAudit(c, audit.ActionTwoFactorEnabled, "user", userID, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns 2FA off. It takes both the password and a current
+// code so a stolen session alone can't remove the second factor.
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	if !requireSession(c) {
+		return
+	}
+	var req models.DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	var passwordHash string
+	if err := database.DB.QueryRow("SELECT password_hash FROM users WHERE id = ?", userID).Scan(&passwordHash); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	secret, enabled, err := loadTwoFactor(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if !utils.CheckPassword(req.Password, passwordHash) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid password or code"})
+		return
+	}
+	ok, err := checkSecondFactor(userID, secret, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid password or code"})
+		return
+	}
+
+	if err := clearTwoFactor(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	recordAudit(c, audit.ActionTwoFactorDisabled, "user", userID, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes, used or not.
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	if !requireSession(c) {
+		return
+	}
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	secret, enabled, err := loadTwoFactor(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	ok, err := checkSecondFactor(userID, secret, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(database.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create recovery codes"})
+		return
+	}
+
+	recordAudit(c, audit.ActionRecoveryCodesRenewed, "user", userID, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// LoginTwoFactor is the second step of logging in to an account with 2FA:
+// the token from Login plus a TOTP or recovery code buys a session.
+func (h *AuthHandler) LoginTwoFactor(c *gin.Context) {
+	var req models.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := utils.ValidateToken(req.TwoFactorToken, h.cfg.JWTSecret)
+	if err != nil || claims.Purpose != utils.PurposeTwoFactor {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired two-factor token"})
+		return
+	}
+
+	user, err := loadUser(claims.UserID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired two-factor token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if user.IsDisabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+
+	secret, enabled, err := loadTwoFactor(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !enabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired two-factor token"})
+		return
+	}
+
+	// Codes are short, so guessing them is throttled like passwords
+	keys := loginKeys(c, user.Email)
+	if h.throttled(c, keys...) {
+		return
+	}
+	ok, err := checkSecondFactor(user.ID, secret, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !ok {
+		if err := h.recordFailures(c, keys...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+	clearFailures(keys[0])
+
+	// Start a session
+	response, err := h.issueSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	recordLogin(c, user, "two_factor")
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ResetTwoFactor turns off 2FA for a user who lost both their
+// authenticator and recovery codes. They can enroll again after logging in.
+func (h *UserHandler) ResetTwoFactor(c *gin.Context) {
+	user, ok := loadManagedUser(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if err := clearTwoFactor(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+
+	entry := auditEntry(c, audit.ActionTwoFactorReset, "user", user.ID, nil, nil)
+	entry.OrgID = user.OrgID
+	audit.Record(entry)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
+
+// twoFactorChallenge answers a correct password on an account with 2FA.
+func (h *AuthHandler) twoFactorChallenge(user models.User) (models.TwoFactorChallenge, error) {
+	ttl := time.Duration(h.cfg.TwoFactorTokenTTLMinutes) * time.Minute
+	token, err := utils.GenerateTwoFactorToken(user.ID, user.Email, h.cfg.JWTSecret, ttl)
+	if err != nil {
+		return models.TwoFactorChallenge{}, err
+	}
+	return models.TwoFactorChallenge{
+		TwoFactorRequired: true,
+		TwoFactorToken:    token,
+		ExpiresIn:         int64(ttl.Seconds()),
+	}, nil
+}
+
+func loadTwoFactor(userID string) (secret string, enabled bool, err error) {
+	err = database.DB.QueryRow(`
+		SELECT COALESCE(totp_secret, ''), totp_enabled
+		FROM users WHERE id = ?
+	`, userID).Scan(&secret, &enabled)
+	return secret, enabled, err
+}
+
+// checkSecondFactor accepts a TOTP code or an unused recovery code. Each
+// TOTP code and each recovery code only works once.
+func checkSecondFactor(userID, secret, code string) (bool, error) {
+	if step, ok := utils.ValidateTOTP(secret, code, time.Now()); ok {
+		result, err := database.DB.Exec(`
+			UPDATE users SET totp_last_step = ?
+			WHERE id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)
+		`, step, userID, step)
+		if err != nil {
+			return false, err
+		}
+		rowsAffected, _ := result.RowsAffected()
+		return rowsAffected == 1, nil
+	}
+
+	result, err := database.DB.Exec(`
+		UPDATE user_recovery_codes SET used_at = NOW()
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`, userID, utils.HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected == 1, nil
+}
+
+func clearTwoFactor(userID string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE users SET totp_enabled = false, totp_secret = NULL, totp_last_step = NULL
+		WHERE id = ?
+	`, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// replaceRecoveryCodes stores a fresh set of recovery codes and returns
+// them in clear, formatted as XXXXX-XXXXX.
+func replaceRecoveryCodes(db execer, userID string) ([]string, error) {
+	if _, err := db.Exec("DELETE FROM user_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := utils.GenerateCode(10)
+		if err != nil {
+			return nil, err
+		}
+		_, err = db.Exec(`
+			INSERT INTO user_recovery_codes (id, user_id, code_hash)
+			VALUES (?, ?, ?)
+		`, uuid.New().String(), userID, utils.HashToken(code))
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, fmt.Sprintf("%s-%s", code[:5], code[5:]))
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode makes recovery codes forgiving of case, spaces and
+// the dash.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"database/sql/driver"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"digital-signage-backend/database/dbtest"
+)
+
+// totpAt computes the 6-digit code of secret for the step holding t, the
+// same way an authenticator app does.
+func totpAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+// useTOTPUser stands in for the users row of one user with 2FA enabled,
+// applying the totp_last_step guard of checkSecondFactor the way MySQL
+// would. Recovery codes never match.
+func useTOTPUser(t *testing.T) *dbtest.DB {
+	var lastStep *int64
+	return dbtest.Use(t, func(query string, args []driver.Value) dbtest.Result {
+		switch {
+		case strings.HasPrefix(query, "UPDATE users SET totp_last_step = ?"):
+			step := args[0].(int64)
+			if args[1] != "user-1" || (lastStep != nil && *lastStep >= step) {
+				return dbtest.Result{}
+			}
+			lastStep = &step
+			return dbtest.Result{RowsAffected: 1}
+		case strings.HasPrefix(query, "UPDATE user_recovery_codes"):
+			return dbtest.Result{}
+		}
+		t.Errorf("unexpected statement: %s", query)
+		return dbtest.Result{}
+	})
+}
+
+func TestCheckSecondFactorRejectsReplayedCode(t *testing.T) {
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	db := useTOTPUser(t)
+	now := time.Now()
+
+	code := totpAt(t, secret, now)
+	ok, err := checkSecondFactor("user-1", secret, code)
+	if err != nil || !ok {
+		t.Fatalf("first use of a valid code = %v, %v, want accepted", ok, err)
+	}
+	ok, err = checkSecondFactor("user-1", secret, code)
+	if err != nil || ok {
+		t.Errorf("replayed code = %v, %v, want rejected", ok, err)
+	}
+
+	// A code from the previous step is still inside the skew window, but
+	// older than the step that was just used
+	ok, err = checkSecondFactor("user-1", secret, totpAt(t, secret, now.Add(-30*time.Second)))
+	if err != nil || ok {
+		t.Errorf("code older than the last used step = %v, %v, want rejected", ok, err)
+	}
+
+	// A replayed TOTP code is refused, not tried as a recovery code; other
+	// codes are
+	if n := len(db.Statements("UPDATE user_recovery_codes")); n != 0 {
+		t.Errorf("%d recovery code lookups for TOTP codes, want 0", n)
+	}
+	ok, err = checkSecondFactor("user-1", secret, "ABCD-EFGH")
+	if err != nil || ok {
+		t.Errorf("unknown recovery code = %v, %v, want rejected", ok, err)
+	}
+	if n := len(db.Statements("UPDATE user_recovery_codes")); n != 1 {
+		t.Errorf("%d recovery code lookups, want 1", n)
+	}
+}
+
+func TestCheckSecondFactorAcceptsNextStep(t *testing.T) {
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	useTOTPUser(t)
+	now := time.Now()
+
+	if ok, err := checkSecondFactor("user-1", secret, totpAt(t, secret, now.Add(-30*time.Second))); err != nil || !ok {
+		t.Fatalf("code of the previous step = %v, %v, want accepted", ok, err)
+	}
+	if ok, err := checkSecondFactor("user-1", secret, totpAt(t, secret, now)); err != nil || !ok {
+		t.Errorf("code of a later step = %v, %v, want accepted", ok, err)
+	}
+}
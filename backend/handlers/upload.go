@@ -0,0 +1,598 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"digital-signage-backend/audit"
+	"digital-signage-backend/database"
+	"digital-signage-backend/media"
+	"digital-signage-backend/models"
+	"digital-signage-backend/storage"
+	"digital-signage-backend/uploadsession"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// saveMedia sniffs an uploaded file, stores it under a new key named after
+// its detected type and records it as a media asset and in the audit log.
+// A file the organization already has is not stored again; its existing
+// asset is returned instead, marked as uploaded again by the caller. Content that isn't an allowed format returns an
+// error wrapping media.ErrUnsupported.
+func (h *AdHandler) saveMedia(c *gin.Context, originalName string, r io.ReaderAt, size int64) (models.MediaAsset, error) {
+	info, err := media.Inspect(r, size)
+	if err != nil {
+		return models.MediaAsset{}, err
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(r, 0, size)); err != nil {
+		return models.MediaAsset{}, err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	orgID := c.GetString("org_id")
+	existing, err := loadMediaAsset("m.org_id = ? AND m.sha256 = ?", orgID, sum)
+	if err == nil {
+		return reuploadedMedia(c, existing)
+	}
+	if err != sql.ErrNoRows {
+		return models.MediaAsset{}, err
+	}
+
+	key := uuid.New().String() + info.Extension()
+	if err := storage.Default.Put(key, io.NewSectionReader(r, 0, size), size, info.MimeType); err != nil {
+		log.Printf("Failed to store upload %s: %v", key, err)
+		return models.MediaAsset{}, err
+	}
+
+	asset := models.MediaAsset{
+		ID:           uuid.New().String(),
+		OrgID:        orgID,
+		URL:          storage.Default.URL(key),
+		StorageKey:   key,
+		OriginalName: filepath.Base(originalName),
+		MimeType:     info.MimeType,
+		MediaType:    info.Type,
+		SizeBytes:    size,
+		SHA256:       sum,
+	}
+	if info.Width > 0 && info.Height > 0 {
+		asset.Width, asset.Height = &info.Width, &info.Height
+	}
+	if info.Duration > 0 {
+		asset.DurationSeconds = &info.Duration
+	}
+	if info.Type == media.TypeImage {
+		asset.ThumbnailURL, asset.PreviewURL = h.storeRenditions(asset, r, info)
+	}
+
+	_, err = database.DB.Exec(`
+		INSERT INTO media_assets (id, org_id, storage_key, url, original_name, mime_type, media_type,
+			size_bytes, sha256, width, height, duration_seconds, thumbnail_url, preview_url, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''))
+	`, asset.ID, asset.OrgID, asset.StorageKey, asset.URL, asset.OriginalName, asset.MimeType,
+		asset.MediaType, asset.SizeBytes, asset.SHA256, asset.Width, asset.Height, asset.DurationSeconds,
+		asset.ThumbnailURL, asset.PreviewURL, c.GetString("user_id"))
+	if err != nil {
+		deleteMediaFiles(asset)
+		// The same file was uploaded at the same time
+		if strings.Contains(err.Error(), "Duplicate entry") {
+			existing, err := loadMediaAsset("m.org_id = ? AND m.sha256 = ?", orgID, sum)
+			if err != nil {
+				return existing, err
+			}
+			return reuploadedMedia(c, existing)
+		}
+		return models.MediaAsset{}, err
+	}
+	if err := recordMediaUploader(asset.ID, c.GetString("user_id")); err != nil {
+		return models.MediaAsset{}, err
+	}
+
+	entry := auditEntry(c, audit.ActionMediaUploaded, "media", key, nil, nil)
+	entry.Details = map[string]interface{}{
+		"url":           asset.URL,
+		"original_name": asset.OriginalName,
+		"size":          size,
+		"mime_type":     asset.MimeType,
+		"sha256":        sum,
+	}
+	audit.Record(entry)
+
+	return loadMediaAsset("m.id = ?", asset.ID)
+}
+
+// reuploadedMedia marks an asset whose file was uploaded again as fresh, so
+// the orphan sweep gives the ad it is for time to be saved, and lets the
+// uploader see it.
+func reuploadedMedia(c *gin.Context, asset models.MediaAsset) (models.MediaAsset, error) {
+	if _, err := database.DB.Exec(
+		"UPDATE media_assets SET last_uploaded_at = NOW() WHERE id = ?", asset.ID,
+	); err != nil {
+		return models.MediaAsset{}, err
+	}
+	if err := recordMediaUploader(asset.ID, c.GetString("user_id")); err != nil {
+		return models.MediaAsset{}, err
+	}
+	return loadMediaAsset("m.id = ?", asset.ID)
+}
+
+// recordMediaUploader records userID as an uploader of an asset. Uploads
+// without a user, like created_by, aren't recorded.
+func recordMediaUploader(assetID, userID string) error {
+	if userID == "" {
+		return nil
+	}
+	_, err := database.DB.Exec(`
+		INSERT INTO media_asset_uploaders (asset_id, user_id) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE uploaded_at = NOW()
+	`, assetID, userID)
+	return err
+}
+
+// storeRenditions stores the thumbnail and preview of an uploaded image
+// next to the original, as <key>_thumb and <key>_preview. An image that
+// already fits is its own rendition, and so are GIFs as their preview, to
+// keep them animated. Renditions that fail are logged and left out; the
+// upload itself still succeeds.
+func (h *AdHandler) storeRenditions(asset models.MediaAsset, r io.ReaderAt, info media.Info) (thumbnailURL, previewURL *string) {
+	if info.Width*info.Height > media.MaxRenditionPixels {
+		log.Printf("Skipping renditions of %s: %dx%d is too large to decode", asset.StorageKey, info.Width, info.Height)
+		return nil, nil
+	}
+
+	var img image.Image
+	store := func(suffix string, maxSize int64) *string {
+		if maxSize <= 0 {
+			return nil
+		}
+		if media.Fits(info.Width, info.Height, int(maxSize)) {
+			return &asset.URL
+		}
+		if img == nil {
+			var err error
+			if img, err = media.DecodeImage(io.NewSectionReader(r, 0, asset.SizeBytes)); err != nil {
+				log.Printf("Failed to decode %s for renditions: %v", asset.StorageKey, err)
+				return nil
+			}
+		}
+		rendition, err := media.MakeRendition(img, int(maxSize))
+		if err != nil {
+			log.Printf("Failed to make %s rendition of %s: %v", suffix, asset.StorageKey, err)
+			return nil
+		}
+		key := strings.TrimSuffix(asset.StorageKey, filepath.Ext(asset.StorageKey)) + suffix + rendition.Extension
+		if err := storage.Default.Put(key, bytes.NewReader(rendition.Data), int64(len(rendition.Data)), rendition.MimeType); err != nil {
+			log.Printf("Failed to store rendition %s: %v", key, err)
+			return nil
+		}
+		url := storage.Default.URL(key)
+		return &url
+	}
+
+	thumbnailURL = store("_thumb", h.cfg.ThumbnailSize)
+	if info.MimeType == "image/gif" && h.cfg.PreviewSize > 0 {
+		return thumbnailURL, &asset.URL
+	}
+	return thumbnailURL, store("_preview", h.cfg.PreviewSize)
+}
+
+// mediaUploadError writes the response for an error of saveMedia.
+func mediaUploadError(c *gin.Context, err error) {
+	if errors.Is(err, media.ErrUnsupported) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+}
+
+// uploadLocks keeps two requests from writing to the same upload at once.
+// Staged chunks live on this server's disk, so a process-wide lock is
+// enough.
+var uploadLocks = &sessionLocks{held: map[string]bool{}}
+
+type sessionLocks struct {
+	mu   sync.Mutex
+	held map[string]bool
+}
+
+func (l *sessionLocks) tryLock(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held[id] {
+		return false
+	}
+	l.held[id] = true
+	return true
+}
+
+func (l *sessionLocks) unlock(id string) {
+	l.mu.Lock()
+	delete(l.held, id)
+	l.mu.Unlock()
+}
+
+const uploadSessionColumns = `id, filename, COALESCE(content_type, ''), size_bytes, received_bytes,
+		       COALESCE(sha256, ''), status, COALESCE(url, ''), COALESCE(storage_key, ''), expires_at, created_at`
+
+func uploadSessionScanDest(s *models.UploadSession) []interface{} {
+	return []interface{}{
+		&s.ID, &s.Filename, &s.ContentType, &s.Size, &s.Offset,
+		&s.SHA256, &s.Status, &s.URL, &s.StorageKey, &s.ExpiresAt, &s.CreatedAt,
+	}
+}
+
+// CreateUpload starts a resumable upload of a file of known size.
+func (h *AdHandler) CreateUpload(c *gin.Context) {
+	var req models.CreateUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Size > h.cfg.MaxUploadSizeMB*1024*1024 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File too large"})
+		return
+	}
+	req.SHA256 = strings.ToLower(req.SHA256)
+	if req.SHA256 != "" && !isSHA256Hex(req.SHA256) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sha256 must be a hex encoded SHA-256 digest"})
+		return
+	}
+
+	if err := os.MkdirAll(h.cfg.UploadSessionPath, 0700); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start upload"})
+		return
+	}
+
+	id := uuid.New().String()
+	_, err := database.DB.Exec(`
+		INSERT INTO upload_sessions (id, org_id, user_id, api_key_id, filename, content_type, size_bytes, sha256, expires_at)
+		VALUES (?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, NULLIF(?, ''), ?, NULLIF(?, ''), ?)
+	`, id, c.GetString("org_id"), c.GetString("user_id"), c.GetString("api_key_id"), filepath.Base(req.Filename),
+		req.ContentType, req.Size, req.SHA256, h.uploadExpiry())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start upload"})
+		return
+	}
+
+	session, err := loadUploadSession(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve upload"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, session)
+}
+
+// GetUpload reports how far an upload got, so a client can resume at
+// offset after losing its connection.
+func (h *AdHandler) GetUpload(c *gin.Context) {
+	session, ok := findUploadSession(c)
+	if !ok {
+		return
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.JSON(http.StatusOK, session)
+}
+
+// AppendUploadChunk writes the request body at the offset given in the
+// Upload-Offset header, which has to match the bytes received so far. An
+// optional Upload-Checksum header ("sha256 <base64 digest>", as in tus)
+// verifies the chunk; a chunk that doesn't match is discarded.
+func (h *AdHandler) AppendUploadChunk(c *gin.Context) {
+	session, ok := findUploadSession(c)
+	if !ok {
+		return
+	}
+	if session.Status != models.UploadStatusUploading {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload is already complete"})
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset header is required"})
+		return
+	}
+	checksum, err := parseChunkChecksum(c.GetHeader("Upload-Checksum"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Checksum must be \"sha256 <base64 digest>\""})
+		return
+	}
+
+	if !uploadLocks.tryLock(session.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another chunk of this upload is being written"})
+		return
+	}
+	defer uploadLocks.unlock(session.ID)
+
+	// Another request may have appended a chunk before the lock was taken
+	session, ok = findUploadSession(c)
+	if !ok {
+		return
+	}
+	if session.Status != models.UploadStatusUploading {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload is already complete"})
+		return
+	}
+	if offset != session.Offset {
+		c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+		c.JSON(http.StatusConflict, gin.H{"error": "Offset does not match the bytes received", "offset": session.Offset})
+		return
+	}
+
+	f, err := os.OpenFile(uploadsession.StagingPath(h.cfg.UploadSessionPath, session.ID), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write chunk"})
+		return
+	}
+	defer f.Close()
+
+	// Drop whatever an earlier, interrupted request left past the offset
+	if err := f.Truncate(offset); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write chunk"})
+		return
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write chunk"})
+		return
+	}
+
+	// Read one byte past what is left to notice a chunk that's too long
+	remaining := session.Size - offset
+	hash := sha256.New()
+	written, copyErr := io.Copy(io.MultiWriter(f, hash), io.LimitReader(c.Request.Body, remaining+1))
+
+	if written > remaining {
+		f.Truncate(offset)
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Chunk goes past the size of the upload", "offset": offset})
+		return
+	}
+	if checksum != nil && (copyErr != nil || !bytes.Equal(hash.Sum(nil), checksum)) {
+		f.Truncate(offset)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Chunk checksum mismatch", "offset": offset})
+		return
+	}
+	// Without a checksum, whatever arrived before the connection broke is
+	// kept so the client can resume from there
+	if err := f.Sync(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write chunk"})
+		return
+	}
+
+	newOffset := offset + written
+
+	// Turn away a file of the wrong type as soon as its first bytes are in,
+	// instead of after the whole upload
+	if offset < media.SniffLen && (newOffset >= media.SniffLen || newOffset == session.Size) {
+		head := make([]byte, media.SniffLen)
+		n, _ := f.ReadAt(head, 0)
+		if media.Sniff(head[:n]) == "" {
+			f.Truncate(0)
+			database.DB.Exec("UPDATE upload_sessions SET received_bytes = 0 WHERE id = ?", session.ID)
+			c.Header("Upload-Offset", "0")
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": media.ErrUnsupported.Error(), "offset": 0})
+			return
+		}
+	}
+
+	_, err = database.DB.Exec(`
+		UPDATE upload_sessions SET received_bytes = ?, expires_at = ?
+		WHERE id = ? AND received_bytes = ?
+	`, newOffset, h.uploadExpiry(), session.ID, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write chunk"})
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	if copyErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Chunk was cut off", "offset": newOffset})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"offset": newOffset, "size": session.Size})
+}
+
+// CompleteUpload checks the assembled file against the sha256 given when
+// the upload was started and moves it into media storage. Completing an
+// upload again returns the same result.
+func (h *AdHandler) CompleteUpload(c *gin.Context) {
+	session, ok := findUploadSession(c)
+	if !ok {
+		return
+	}
+	if session.Status == models.UploadStatusCompleted {
+		completedUpload(c, session)
+		return
+	}
+
+	if !uploadLocks.tryLock(session.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another chunk of this upload is being written"})
+		return
+	}
+	defer uploadLocks.unlock(session.ID)
+
+	session, ok = findUploadSession(c)
+	if !ok {
+		return
+	}
+	if session.Status == models.UploadStatusCompleted {
+		completedUpload(c, session)
+		return
+	}
+	if session.Offset != session.Size {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload is incomplete", "offset": session.Offset, "size": session.Size})
+		return
+	}
+
+	staged := uploadsession.StagingPath(h.cfg.UploadSessionPath, session.ID)
+	if session.SHA256 != "" {
+		sum, err := fileSHA256(staged)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read upload"})
+			return
+		}
+		if sum != session.SHA256 {
+			// The data is unusable; start over from the beginning
+			os.Remove(staged)
+			database.DB.Exec("UPDATE upload_sessions SET received_bytes = 0 WHERE id = ?", session.ID)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File checksum mismatch, upload it again", "offset": 0})
+			return
+		}
+	}
+
+	f, err := os.Open(staged)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read upload"})
+		return
+	}
+	defer f.Close()
+
+	asset, err := h.saveMedia(c, session.Filename, f, session.Size)
+	if errors.Is(err, media.ErrUnsupported) {
+		// Retrying won't help, the client has to send another file
+		f.Close()
+		os.Remove(staged)
+		database.DB.Exec("UPDATE upload_sessions SET received_bytes = 0 WHERE id = ?", session.ID)
+	}
+	if err != nil {
+		mediaUploadError(c, err)
+		return
+	}
+
+	_, err = database.DB.Exec(`
+		UPDATE upload_sessions SET status = ?, storage_key = ?, url = ?, expires_at = ?
+		WHERE id = ?
+	`, models.UploadStatusCompleted, asset.StorageKey, asset.URL, h.uploadExpiry(), session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	f.Close()
+	os.Remove(staged)
+
+	c.JSON(http.StatusOK, gin.H{
+		"url":      asset.URL,
+		"filename": asset.StorageKey,
+		"asset":    asset,
+	})
+}
+
+// completedUpload repeats the response of completing session.
+func completedUpload(c *gin.Context, session models.UploadSession) {
+	response := gin.H{"url": session.URL, "filename": session.StorageKey}
+	if asset, err := findMediaAssetByURL(session.URL); err == nil {
+		response["asset"] = asset
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CancelUpload discards an upload and its staged chunks.
+func (h *AdHandler) CancelUpload(c *gin.Context) {
+	session, ok := findUploadSession(c)
+	if !ok {
+		return
+	}
+
+	if !uploadLocks.tryLock(session.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another chunk of this upload is being written"})
+		return
+	}
+	defer uploadLocks.unlock(session.ID)
+
+	if _, err := database.DB.Exec("DELETE FROM upload_sessions WHERE id = ?", session.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel upload"})
+		return
+	}
+	os.Remove(uploadsession.StagingPath(h.cfg.UploadSessionPath, session.ID))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Upload cancelled"})
+}
+
+// uploadExpiry is when an upload that sees no further activity is removed.
+func (h *AdHandler) uploadExpiry() time.Time {
+	return time.Now().Add(time.Duration(h.cfg.UploadSessionTTLHours) * time.Hour)
+}
+
+// loadUploadSession loads an upload started by the caller. Uploads of
+// anyone else are reported as missing.
+func loadUploadSession(c *gin.Context, id string) (models.UploadSession, error) {
+	var session models.UploadSession
+	err := database.DB.QueryRow(`
+		SELECT `+uploadSessionColumns+`
+		FROM upload_sessions
+		WHERE id = ? AND org_id = ? AND COALESCE(user_id, '') = ? AND COALESCE(api_key_id, '') = ?
+	`, id, c.GetString("org_id"), c.GetString("user_id"), c.GetString("api_key_id")).Scan(uploadSessionScanDest(&session)...)
+	return session, err
+}
+
+// findUploadSession is loadUploadSession for the :id parameter. It writes
+// the error response and returns false when the upload can't be loaded.
+func findUploadSession(c *gin.Context) (models.UploadSession, bool) {
+	session, err := loadUploadSession(c, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return session, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return session, false
+	}
+	return session, true
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// parseChunkChecksum decodes an Upload-Checksum header. It returns nil when
+// the header is empty.
+func parseChunkChecksum(header string) ([]byte, error) {
+	if header == "" {
+		return nil, nil
+	}
+	algorithm, encoded, ok := strings.Cut(header, " ")
+	if !ok || algorithm != "sha256" {
+		return nil, errors.New("unsupported checksum")
+	}
+	sum, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sum) != sha256.Size {
+		return nil, errors.New("invalid checksum")
+	}
+	return sum, nil
+}
+
+func isSHA256Hex(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"digital-signage-backend/database"
+	"digital-signage-backend/models"
+	"digital-signage-backend/presence"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDeviceUptime reports availability per device over a date range.
+func (h *AnalyticsHandler) GetDeviceUptime(c *gin.Context) {
+	tallies, from, to, ok := h.uptimeTallies(c)
+	if !ok {
+		return
+	}
+
+	reports := []models.UptimeReport{}
+	for _, t := range tallies {
+		report := t.report()
+		report.DeviceID = t.deviceID
+		report.HardwareID = t.hardwareID
+		reports = append(reports, report)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"start":   from,
+		"end":     to,
+		"devices": reports,
+	})
+}
+
+// GetLocationUptime reports availability aggregated per location.
+func (h *AnalyticsHandler) GetLocationUptime(c *gin.Context) {
+	tallies, from, to, ok := h.uptimeTallies(c)
+	if !ok {
+		return
+	}
+
+	byLocation := map[string]*uptimeTally{}
+	for _, t := range tallies {
+		agg, exists := byLocation[t.location]
+		if !exists {
+			agg = &uptimeTally{location: t.location}
+			byLocation[t.location] = agg
+		}
+		agg.merge(t)
+	}
+
+	reports := []models.UptimeReport{}
+	for _, agg := range byLocation {
+		reports = append(reports, agg.report())
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Location < reports[j].Location })
+
+	c.JSON(http.StatusOK, gin.H{
+		"start":     from,
+		"end":       to,
+		"locations": reports,
+	})
+}
+
+// uptimeTallies parses the query and computes a tally per matching device.
+// It writes the error response itself and returns ok=false on failure.
+func (h *AnalyticsHandler) uptimeTallies(c *gin.Context) ([]*uptimeTally, time.Time, time.Time, bool) {
+	var query models.UptimeQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	// Default to last 30 days; end_date is inclusive
+	now := time.Now()
+	to := now
+	from := now.AddDate(0, 0, -30)
+	if query.StartDate != "" {
+		t, err := time.Parse("2006-01-02", query.StartDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date, expected YYYY-MM-DD"})
+			return nil, time.Time{}, time.Time{}, false
+		}
+		from = t
+	}
+	if query.EndDate != "" {
+		t, err := time.Parse("2006-01-02", query.EndDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date, expected YYYY-MM-DD"})
+			return nil, time.Time{}, time.Time{}, false
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+	if to.After(now) {
+		to = now
+	}
+	if !to.After(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_date must not be before start_date"})
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	orgSQL, orgArgs := orgFilter(c, "d.org_id")
+	filterSQL := "d.created_at < ? AND " + orgSQL
+	filterArgs := append([]interface{}{to}, orgArgs...)
+	if query.DeviceID != "" {
+		filterSQL += " AND (d.id = ? OR d.device_id = ?)"
+		filterArgs = append(filterArgs, query.DeviceID, query.DeviceID)
+	}
+	if query.Location != "" {
+		filterSQL += " AND d.location = ?"
+		filterArgs = append(filterArgs, query.Location)
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT d.id, d.device_id, d.location, d.is_online, d.created_at
+		FROM devices d
+		WHERE `+filterSQL+`
+		ORDER BY d.location, d.device_id
+	`, filterArgs...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch devices"})
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	type deviceRow struct {
+		id, hardwareID, location string
+		isOnline                 bool
+		createdAt                time.Time
+	}
+	devices := []deviceRow{}
+	for rows.Next() {
+		var d deviceRow
+		if err := rows.Scan(&d.id, &d.hardwareID, &d.location, &d.isOnline, &d.createdAt); err != nil {
+			continue
+		}
+		devices = append(devices, d)
+	}
+	rows.Close()
+
+	// The history of every device in one query rather than one per device
+	history, err := loadStatusHistory(filterSQL, filterArgs, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch status history"})
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	tallies := []*uptimeTally{}
+	for _, d := range devices {
+		start, initialOnline, changes := monitoredWindow(history[d.id], d.isOnline, d.createdAt, from, to)
+		t := computeUptime(initialOnline, changes, start, to)
+		t.deviceID, t.hardwareID, t.location = d.id, d.hardwareID, d.location
+		tallies = append(tallies, t)
+	}
+
+	return tallies, from, to, true
+}
+
+type statusChange struct {
+	online bool
+	at     time.Time
+}
+
+// loadStatusHistory returns the status changes before to of the devices
+// matching filterSQL (on devices aliased d), by device row id and in order.
+func loadStatusHistory(filterSQL string, filterArgs []interface{}, to time.Time) (map[string][]statusChange, error) {
+	args := append([]interface{}{to}, filterArgs...)
+	rows, err := database.DB.Query(`
+		SELECT h.device_id, h.status, h.changed_at
+		FROM device_status_history h
+		JOIN devices d ON d.id = h.device_id
+		WHERE h.changed_at < ? AND `+filterSQL+`
+		ORDER BY h.device_id, h.changed_at
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := map[string][]statusChange{}
+	for rows.Next() {
+		var deviceRowID, status string
+		var at time.Time
+		if err := rows.Scan(&deviceRowID, &status, &at); err != nil {
+			continue
+		}
+		history[deviceRowID] = append(history[deviceRowID], statusChange{online: status == presence.StatusOnline, at: at})
+	}
+	return history, rows.Err()
+}
+
+// monitoredWindow picks where a device's monitoring starts inside [from, to),
+// its state there and its changes after that. A device is monitored from its
+// first online event, normally its pairing, so the time before it was set up
+// isn't downtime. History that starts with going offline predates the
+// history table; such a device, and one that is online without any history,
+// is monitored from its creation. A device never seen online isn't monitored
+// at all: the start is to.
+func monitoredWindow(history []statusChange, currentOnline bool, createdAt, from, to time.Time) (time.Time, bool, []statusChange) {
+	var begin time.Time
+	switch {
+	case len(history) > 0 && history[0].online:
+		begin = history[0].at
+	case len(history) > 0 || currentOnline:
+		begin = createdAt
+	default:
+		return to, false, nil
+	}
+
+	start := from
+	if begin.After(start) {
+		start = begin
+	}
+	if !start.Before(to) {
+		return to, false, nil
+	}
+
+	online := true
+	changes := []statusChange{}
+	for _, change := range history {
+		if change.at.After(start) {
+			changes = append(changes, change)
+		} else {
+			online = change.online
+		}
+	}
+	return start, online, changes
+}
+
+// uptimeTally accumulates availability figures; outages are offline spans.
+type uptimeTally struct {
+	deviceID, hardwareID, location string
+
+	devices        int
+	monitored      time.Duration
+	online         time.Duration
+	outages        int
+	longestOutage  time.Duration
+	recovered      int
+	recoveredTotal time.Duration
+}
+
+// computeUptime walks the changes across [from, to) starting in state
+// initialOnline. Outage durations are clipped to the window; only outages
+// that ended inside it count towards the mean time to recovery.
+func computeUptime(initialOnline bool, changes []statusChange, from, to time.Time) *uptimeTally {
+	t := &uptimeTally{devices: 1}
+	if !to.After(from) {
+		return t
+	}
+	t.monitored = to.Sub(from)
+
+	online := initialOnline
+	spanStart := from
+	closeSpan := func(end time.Time, recovered bool) {
+		span := end.Sub(spanStart)
+		if online {
+			t.online += span
+			return
+		}
+		t.outages++
+		if span > t.longestOutage {
+			t.longestOutage = span
+		}
+		if recovered {
+			t.recovered++
+			t.recoveredTotal += span
+		}
+	}
+
+	for _, change := range changes {
+		if change.online == online {
+			continue
+		}
+		closeSpan(change.at, change.online)
+		online = change.online
+		spanStart = change.at
+	}
+	closeSpan(to, false)
+
+	return t
+}
+
+func (t *uptimeTally) merge(other *uptimeTally) {
+	t.devices += other.devices
+	t.monitored += other.monitored
+	t.online += other.online
+	t.outages += other.outages
+	if other.longestOutage > t.longestOutage {
+		t.longestOutage = other.longestOutage
+	}
+	t.recovered += other.recovered
+	t.recoveredTotal += other.recoveredTotal
+}
+
+func (t *uptimeTally) report() models.UptimeReport {
+	report := models.UptimeReport{
+		Location:             t.location,
+		DeviceCount:          t.devices,
+		MonitoredSeconds:     int64(t.monitored.Seconds()),
+		OnlineSeconds:        int64(t.online.Seconds()),
+		OutageCount:          t.outages,
+		LongestOutageSeconds: int64(t.longestOutage.Seconds()),
+	}
+	if t.monitored > 0 {
+		report.UptimePercent = math.Round(t.online.Seconds()/t.monitored.Seconds()*10000) / 100
+	}
+	if t.recovered > 0 {
+		report.MTTRSeconds = math.Round(t.recoveredTotal.Seconds() / float64(t.recovered))
+	}
+	return report
+}
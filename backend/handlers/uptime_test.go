@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+var uptimeDay = time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)
+
+// hour returns uptimeDay plus h hours.
+func hour(h float64) time.Time {
+	return uptimeDay.Add(time.Duration(h * float64(time.Hour)))
+}
+
+func TestComputeUptime(t *testing.T) {
+	tests := []struct {
+		name          string
+		initialOnline bool
+		changes       []statusChange
+		from, to      time.Time
+
+		online        time.Duration
+		outages       int
+		longestOutage time.Duration
+		recovered     int
+		mttr          time.Duration
+	}{
+		{
+			name: "online throughout", initialOnline: true,
+			from: hour(0), to: hour(24),
+			online: 24 * time.Hour,
+		},
+		{
+			name: "offline throughout", initialOnline: false,
+			from: hour(0), to: hour(24),
+			outages: 1, longestOutage: 24 * time.Hour,
+		},
+		{
+			name: "two outages that recovered", initialOnline: true,
+			changes: []statusChange{
+				{false, hour(2)}, {true, hour(3)},
+				{false, hour(10)}, {true, hour(13)},
+			},
+			from: hour(0), to: hour(24),
+			online: 20 * time.Hour, outages: 2, longestOutage: 3 * time.Hour,
+			recovered: 2, mttr: 2 * time.Hour,
+		},
+		{
+			name: "outage still open at the end counts but not towards MTTR", initialOnline: true,
+			changes: []statusChange{{false, hour(20)}},
+			from:    hour(0), to: hour(24),
+			online: 20 * time.Hour, outages: 1, longestOutage: 4 * time.Hour,
+		},
+		{
+			name: "outage carried in from before the window is clipped", initialOnline: false,
+			changes: []statusChange{{true, hour(1)}},
+			from:    hour(0), to: hour(24),
+			online: 23 * time.Hour, outages: 1, longestOutage: time.Hour,
+			recovered: 1, mttr: time.Hour,
+		},
+		{
+			name: "repeated states are ignored", initialOnline: true,
+			changes: []statusChange{
+				{true, hour(1)}, {false, hour(6)}, {false, hour(7)}, {true, hour(12)}, {true, hour(13)},
+			},
+			from: hour(0), to: hour(24),
+			online: 18 * time.Hour, outages: 1, longestOutage: 6 * time.Hour,
+			recovered: 1, mttr: 6 * time.Hour,
+		},
+		{
+			name: "empty window", initialOnline: false,
+			from: hour(24), to: hour(24),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := computeUptime(tt.initialOnline, tt.changes, tt.from, tt.to)
+			monitored := tt.to.Sub(tt.from)
+			if got.devices != 1 || got.monitored != monitored {
+				t.Errorf("devices = %d, monitored = %s, want 1, %s", got.devices, got.monitored, monitored)
+			}
+			if got.online != tt.online || got.outages != tt.outages || got.longestOutage != tt.longestOutage {
+				t.Errorf("online = %s, outages = %d, longest = %s, want %s, %d, %s",
+					got.online, got.outages, got.longestOutage, tt.online, tt.outages, tt.longestOutage)
+			}
+			if got.recovered != tt.recovered {
+				t.Errorf("recovered = %d, want %d", got.recovered, tt.recovered)
+			}
+			if tt.recovered > 0 && got.recoveredTotal/time.Duration(got.recovered) != tt.mttr {
+				t.Errorf("MTTR = %s, want %s", got.recoveredTotal/time.Duration(got.recovered), tt.mttr)
+			}
+		})
+	}
+}
+
+func TestUptimeReport(t *testing.T) {
+	lobby := computeUptime(true, []statusChange{{false, hour(6)}, {true, hour(12)}}, hour(0), hour(24))
+	gate := computeUptime(true, []statusChange{{false, hour(18)}, {true, hour(20)}}, hour(0), hour(24))
+
+	report := lobby.report()
+	if report.UptimePercent != 75 || report.MTTRSeconds != 6*3600 || report.OutageCount != 1 {
+		t.Errorf("report = %+v, want 75%% with a 6 hour MTTR", report)
+	}
+
+	total := &uptimeTally{location: "Lobby"}
+	total.merge(lobby)
+	total.merge(gate)
+	report = total.report()
+	if report.DeviceCount != 2 || report.MonitoredSeconds != 48*3600 || report.OnlineSeconds != 40*3600 {
+		t.Errorf("merged report = %+v", report)
+	}
+	if report.UptimePercent != 83.33 || report.MTTRSeconds != 4*3600 || report.LongestOutageSeconds != 6*3600 {
+		t.Errorf("merged report = %+v, want 83.33%%, 4 hour MTTR, 6 hour longest outage", report)
+	}
+
+	if empty := (&uptimeTally{}).report(); empty.UptimePercent != 0 || empty.MTTRSeconds != 0 {
+		t.Errorf("report without monitoring = %+v", empty)
+	}
+}
+
+func TestMonitoredWindow(t *testing.T) {
+	created := hour(-48)
+	from, to := hour(0), hour(24)
+
+	tests := []struct {
+		name          string
+		history       []statusChange
+		currentOnline bool
+		createdAt     time.Time
+
+		start         time.Time
+		initialOnline bool
+		changes       int
+	}{
+		{
+			name:      "paired inside the window starts there, not at creation",
+			history:   []statusChange{{true, hour(5)}, {false, hour(8)}},
+			createdAt: hour(1),
+			start:     hour(5), initialOnline: true, changes: 1,
+		},
+		{
+			name:      "paired before the window starts at the window",
+			history:   []statusChange{{true, hour(-30)}, {false, hour(-2)}, {true, hour(3)}},
+			createdAt: created,
+			start:     from, initialOnline: false, changes: 1,
+		},
+		{
+			name:      "never online is not monitored",
+			createdAt: created,
+			start:     to,
+		},
+		{
+			name:          "online without history counts from creation",
+			currentOnline: true, createdAt: hour(2),
+			start: hour(2), initialOnline: true,
+		},
+		{
+			name:      "history starting offline predates the history table",
+			history:   []statusChange{{false, hour(4)}},
+			createdAt: created,
+			start:     from, initialOnline: true, changes: 1,
+		},
+		{
+			name:      "change at the start sets the state, not a zero-length span",
+			history:   []statusChange{{true, from}},
+			createdAt: created,
+			start:     from, initialOnline: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, initialOnline, changes := monitoredWindow(tt.history, tt.currentOnline, tt.createdAt, from, to)
+			if !start.Equal(tt.start) || initialOnline != tt.initialOnline || len(changes) != tt.changes {
+				t.Errorf("monitoredWindow = %s, %v, %d changes, want %s, %v, %d",
+					start.Format(time.RFC3339), initialOnline, len(changes), tt.start.Format(time.RFC3339), tt.initialOnline, tt.changes)
+			}
+		})
+	}
+
+	// Before pairing a device isn't down: its only outage is the real one
+	start, initialOnline, changes := monitoredWindow(
+		[]statusChange{{true, hour(5)}, {false, hour(8)}, {true, hour(9)}}, true, hour(1), from, to)
+	tally := computeUptime(initialOnline, changes, start, to)
+	if tally.monitored != 19*time.Hour || tally.online != 18*time.Hour || tally.outages != 1 {
+		t.Errorf("tally after pairing = %+v", tally)
+	}
+}
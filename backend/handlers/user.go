@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"digital-signage-backend/audit"
+	"digital-signage-backend/config"
+	"digital-signage-backend/database"
+	"digital-signage-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userColumns is the column list scanned by userScanDest.
+const userColumns = `id, org_id, email, display_name, role, COALESCE(company_name, ''),
+		       is_disabled, disabled_at, totp_enabled, created_at, updated_at`
+
+func userScanDest(user *models.User) []interface{} {
+	return []interface{}{
+		&user.ID, &user.OrgID, &user.Email, &user.DisplayName, &user.Role, &user.CompanyName,
+		&user.IsDisabled, &user.DisabledAt, &user.TwoFactorEnabled, &user.CreatedAt, &user.UpdatedAt,
+	}
+}
+
+func loadUser(id string) (models.User, error) {
+	var user models.User
+	err := database.DB.QueryRow(`
+		SELECT `+userColumns+`
+		FROM users WHERE id = ?
+	`, id).Scan(userScanDest(&user)...)
+	return user, err
+}
+
+type UserHandler struct {
+	cfg *config.Config
+}
+
+func NewUserHandler(cfg *config.Config) *UserHandler {
+	return &UserHandler{cfg: cfg}
+}
+
+// GetRoles returns the permission matrix so clients can adapt their UI.
+func (h *UserHandler) GetRoles(c *gin.Context) {
+	c.JSON(http.StatusOK, models.RolePermissions)
+}
+
+// GetUsers lists the users of the caller's organization, newest first.
+// Optional filters: search (matches email and display name), role and
+// status (active or disabled).
+func (h *UserHandler) GetUsers(c *gin.Context) {
+	page, limit := pagination(c)
+
+	orgSQL, args := orgFilter(c, "org_id")
+	where := []string{orgSQL}
+	if search := strings.TrimSpace(c.Query("search")); search != "" {
+		where = append(where, "(email LIKE ? OR display_name LIKE ?)")
+		pattern := "%" + search + "%"
+		args = append(args, pattern, pattern)
+	}
+	if role := c.Query("role"); role != "" {
+		where = append(where, "role = ?")
+		args = append(args, role)
+	}
+	switch c.Query("status") {
+	case "active":
+		where = append(where, "is_disabled = false")
+	case "disabled":
+		where = append(where, "is_disabled = true")
+	}
+	whereSQL := strings.Join(where, " AND ")
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM users WHERE "+whereSQL, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT `+userColumns+`
+		FROM users WHERE `+whereSQL+`
+		ORDER BY created_at DESC
+		LIMIT ? OFFSET ?
+	`, append(args, limit, (page-1)*limit)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(userScanDest(&user)...); err != nil {
+			continue
+		}
+		users = append(users, user)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": users,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+func (h *UserHandler) GetUserByID(c *gin.Context) {
+	user, err := loadUser(c.Param("id"))
+	if err == sql.ErrNoRows || (err == nil && !inOrg(c, user.OrgID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	user.Permissions = models.RolePermissions[user.Role]
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateUser changes display name, role and company of a user.
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	var req models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.updateUser(c, c.Param("id"), req)
+}
+
+// UpdateUserRole assigns a role. Only super admins may grant or take away
+// the admin and super admin roles, and nobody can change their own role.
+func (h *UserHandler) UpdateUserRole(c *gin.Context) {
+	var req models.UpdateUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.updateUser(c, c.Param("id"), models.UpdateUserRequest{
+		Role:        &req.Role,
+		CompanyName: req.CompanyName,
+	})
+}
+
+func (h *UserHandler) updateUser(c *gin.Context, id string, req models.UpdateUserRequest) {
+	user, ok := loadManagedUser(c, id)
+	if !ok {
+		return
+	}
+
+	updates := []string{}
+	args := []interface{}{}
+
+	if req.DisplayName != nil {
+		name := strings.TrimSpace(*req.DisplayName)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "display_name must not be empty"})
+			return
+		}
+		updates = append(updates, "display_name = ?")
+		args = append(args, name)
+	}
+
+	role := user.Role
+	if req.Role != nil && *req.Role != user.Role {
+		if id == c.GetString("user_id") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot change your own role"})
+			return
+		}
+		if !authorizeRoleGrant(c, *req.Role) {
+			return
+		}
+		role = *req.Role
+		updates = append(updates, "role = ?")
+		args = append(args, role)
+	}
+
+	company := user.CompanyName
+	if req.CompanyName != nil {
+		company = strings.TrimSpace(*req.CompanyName)
+		updates = append(updates, "company_name = NULLIF(?, '')")
+		args = append(args, company)
+	}
+	if role == models.RoleAdvertiser && company == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "company_name is required for advertisers"})
+		return
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	args = append(args, id)
+	if _, err := database.DB.Exec("UPDATE users SET "+strings.Join(updates, ", ")+" WHERE id = ?", args...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	updated, err := loadUser(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get updated user"})
+		return
+	}
+	updated.Permissions = models.RolePermissions[updated.Role]
+
+	action := audit.ActionUserUpdated
+	if updated.Role != user.Role {
+		action = audit.ActionUserRoleChanged
+	}
+	recordAudit(c, action, "user", id, user, updated)
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// DisableUser blocks login and invalidates the user's existing tokens.
+func (h *UserHandler) DisableUser(c *gin.Context) {
+	h.setDisabled(c, true)
+}
+
+func (h *UserHandler) EnableUser(c *gin.Context) {
+	h.setDisabled(c, false)
+}
+
+func (h *UserHandler) setDisabled(c *gin.Context, disabled bool) {
+	id := c.Param("id")
+	if id == c.GetString("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot disable or enable your own account"})
+		return
+	}
+	before, ok := loadManagedUser(c, id)
+	if !ok {
+		return
+	}
+
+	_, err := database.DB.Exec(`
+		UPDATE users SET is_disabled = ?, disabled_at = IF(?, NOW(), NULL)
+		WHERE id = ?
+	`, disabled, disabled, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+	if disabled {
+		if _, err := revokeUserSessions(database.DB, id, models.SessionRevokedDisabled); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+			return
+		}
+	}
+
+	user, err := loadUser(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get updated user"})
+		return
+	}
+
+	action := audit.ActionUserEnabled
+	if disabled {
+		action = audit.ActionUserDisabled
+	}
+	recordAudit(c, action, "user", id, before, user)
+
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteUser removes a user. Ads, playlists and API keys they created are
+// handed over to the user given in reassign_to, or to the caller when it is
+// omitted.
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	id := c.Param("id")
+	if id == c.GetString("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot delete your own account"})
+		return
+	}
+	before, ok := loadManagedUser(c, id)
+	if !ok {
+		return
+	}
+
+	reassignTo := c.Query("reassign_to")
+	if reassignTo == "" {
+		reassignTo = c.GetString("user_id")
+	}
+	if reassignTo == id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reassign_to must be a different user"})
+		return
+	}
+	if heir, err := loadUser(reassignTo); err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reassign_to user not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	} else if heir.OrgID != before.OrgID {
+		// Content stays in its organization
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reassign_to must belong to the same organization"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	adsResult, err := tx.Exec("UPDATE ads SET created_by = ? WHERE created_by = ?", reassignTo, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reassign ads"})
+		return
+	}
+	playlistsResult, err := tx.Exec("UPDATE playlists SET created_by = ? WHERE created_by = ?", reassignTo, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reassign playlists"})
+		return
+	}
+	// Integrations keep working under the new owner
+	if _, err := tx.Exec("UPDATE api_keys SET created_by = ? WHERE created_by = ?", reassignTo, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reassign API keys"})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM users WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	adsMoved, _ := adsResult.RowsAffected()
+	playlistsMoved, _ := playlistsResult.RowsAffected()
+
+	entry := auditEntry(c, audit.ActionUserDeleted, "user", id, before, nil)
+	entry.Details = map[string]interface{}{
+		"reassigned_to":        reassignTo,
+		"ads_reassigned":       adsMoved,
+		"playlists_reassigned": playlistsMoved,
+	}
+	audit.Record(entry)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":              "User deleted successfully",
+		"reassigned_to":        reassignTo,
+		"ads_reassigned":       adsMoved,
+		"playlists_reassigned": playlistsMoved,
+	})
+}
+
+// loadManagedUser loads a user of the caller's organization that the caller
+// is about to change. Admin and super admin accounts can only be managed by
+// a super admin.
+func loadManagedUser(c *gin.Context, id string) (models.User, bool) {
+	user, err := loadUser(id)
+	if err == sql.ErrNoRows || (err == nil && !inOrg(c, user.OrgID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return user, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return user, false
+	}
+	if models.IsAdminRole(user.Role) && c.GetString("user_role") != models.RoleSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only a super admin can manage admin accounts"})
+		return user, false
+	}
+	return user, true
+}
+
+// authorizeRoleGrant checks that the caller may hand out role.
+func authorizeRoleGrant(c *gin.Context, role string) bool {
+	if models.IsAdminRole(role) && c.GetString("user_role") != models.RoleSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only a super admin can manage admin roles"})
+		return false
+	}
+	return true
+}
+
+// pagination reads page (from 1) and limit (1-100, default 20).
+func pagination(c *gin.Context) (page, limit int) {
+	page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ = strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	return page, limit
+}
+
+// advertiserCompany returns the company an advertiser is restricted to.
+// ok is false for every other role and for anonymous requests.
+func advertiserCompany(c *gin.Context) (company string, ok bool) {
+	if c.GetString("user_role") != models.RoleAdvertiser {
+		return "", false
+	}
+	return c.GetString("user_company"), true
+}
@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LogMailer writes every message to the server log instead of sending it.
+// Meant for development only: reset links end up in the log.
+type LogMailer struct {
+	From string
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	body, err := build(m.From, msg)
+	if err != nil {
+		return err
+	}
+	log.Printf("Email (not sent):\n%s", body)
+	return nil
+}
+
+// FileMailer stores every message as an .eml file in Dir, which can be
+// opened with any mail client.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	body, err := build(m.From, msg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405"), uuid.New().String())
+	return os.WriteFile(filepath.Join(m.Dir, name), body, 0600)
+}
@@ -0,0 +1,105 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"net/mail"
+	"strings"
+	"time"
+
+	"digital-signage-backend/config"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Default is the mailer shared by the HTTP handlers. It logs messages until
+// Initialize replaces it with the configured driver.
+var Default Mailer = &LogMailer{From: "no-reply@localhost"}
+
+// Initialize sets Default from MAIL_DRIVER: "smtp", "file" or "log".
+func Initialize(cfg *config.Config) error {
+	switch cfg.MailDriver {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return fmt.Errorf("SMTP_HOST is required for the smtp mail driver")
+		}
+		Default = &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		}
+	case "file":
+		Default = &FileMailer{Dir: cfg.MailDir, From: cfg.MailFrom}
+	case "log", "":
+		Default = &LogMailer{From: cfg.MailFrom}
+	default:
+		return fmt.Errorf("unknown MAIL_DRIVER %q", cfg.MailDriver)
+	}
+	log.Printf("Mail driver: %s", driverName(cfg.MailDriver))
+	return nil
+}
+
+// SendAsync delivers msg in the background and only logs failures, so that
+// response times don't reveal whether an email was sent.
+func SendAsync(msg Message) {
+	go func() {
+		if err := Default.Send(msg); err != nil {
+			log.Printf("Failed to send email to %s: %v", msg.To, err)
+		}
+	}()
+}
+
+func driverName(driver string) string {
+	if driver == "" {
+		return "log"
+	}
+	return driver
+}
+
+// build renders msg as an RFC 5322 message.
+func build(from string, msg Message) ([]byte, error) {
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, fmt.Errorf("subject must be a single line")
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.Trim(from[at+1:], "> ")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"fmt"
+	"time"
+)
+
+// InviteMessage is the email inviting to to create an account with role.
+// link opens the invite and stops working at expiresAt.
+func InviteMessage(to, role string, expiresAt time.Time, link string) Message {
+	return Message{
+		To:      to,
+		Subject: "You have been invited to Digital Signage",
+		Body: fmt.Sprintf(
+			"Hi,\n\nYou have been invited to the Digital Signage dashboard as %s.\n"+
+				"Open the link below to create your account. It works once and expires on %s.\n\n%s\n",
+			role, expiresAt.Format(time.RFC1123), link,
+		),
+	}
+}
+
+// PasswordResetMessage is the email with a password reset link, valid for
+// ttlMinutes.
+func PasswordResetMessage(to, displayName string, ttlMinutes int64, link string) Message {
+	return Message{
+		To:      to,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nSomeone asked to reset the password of your Digital Signage account.\n"+
+				"Open the link below to choose a new one. It works once and expires in %d minutes.\n\n%s\n\n"+
+				"If you didn't ask for this, you can ignore this email.\n",
+			displayName, ttlMinutes, link,
+		),
+	}
+}
@@ -0,0 +1,90 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+)
+
+// SMTPMailer sends through an SMTP server. Port 465 uses implicit TLS; any
+// other port upgrades with STARTTLS when the server offers it, so a local
+// stand-in such as MailHog works without TLS or credentials.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	body, err := build(m.From, msg)
+	if err != nil {
+		return err
+	}
+
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("invalid MAIL_FROM: %w", err)
+	}
+	to, _ := mail.ParseAddress(msg.To)
+
+	client, err := m.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if m.Username != "" {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (m *SMTPMailer) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(m.Host, m.Port)
+	tlsConfig := &tls.Config{ServerName: m.Host}
+
+	if m.Port == "465" {
+		conn, err := tls.Dial("tcp", addr, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		return smtp.NewClient(conn, m.Host)
+	}
+
+	client, err := smtp.Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
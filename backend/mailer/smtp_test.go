@@ -0,0 +1,168 @@
+package mailer
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// received is what the fake SMTP server got for one message.
+type received struct {
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTP accepts a single SMTP session on a local port, without TLS or
+// AUTH, like MailHog. It returns the host, port and a channel delivering the
+// message once the session ends.
+func fakeSMTP(t *testing.T) (string, string, <-chan received) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	done := make(chan received, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		tp := textproto.NewConn(conn)
+		var msg received
+		tp.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch verb {
+			case "EHLO", "HELO":
+				tp.PrintfLine("250-fake\r\n250 8BITMIME")
+			case "MAIL":
+				// Drop ESMTP parameters such as BODY=8BITMIME
+				msg.from = strings.Fields(line[len("MAIL FROM:"):])[0]
+				tp.PrintfLine("250 OK")
+			case "RCPT":
+				msg.to = append(msg.to, line[len("RCPT TO:"):])
+				tp.PrintfLine("250 OK")
+			case "DATA":
+				tp.PrintfLine("354 Go ahead")
+				data, err := io.ReadAll(tp.DotReader())
+				if err != nil {
+					return
+				}
+				msg.data = string(data)
+				tp.PrintfLine("250 Queued")
+			case "QUIT":
+				tp.PrintfLine("221 Bye")
+				done <- msg
+				return
+			default:
+				tp.PrintfLine("502 Not implemented")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	return host, port, done
+}
+
+func sendThroughFake(t *testing.T, msg Message) (received, *mail.Message, string) {
+	t.Helper()
+	host, port, done := fakeSMTP(t)
+	m := &SMTPMailer{Host: host, Port: port, From: "Digital Signage <no-reply@example.com>"}
+	if err := m.Send(msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	var got received
+	select {
+	case got = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fake SMTP server got no message")
+	}
+
+	parsed, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(got.data)))
+	if err != nil {
+		t.Fatalf("message isn't RFC 5322: %v\n%s", err, got.data)
+	}
+	body, _ := io.ReadAll(parsed.Body)
+	return got, parsed, string(body)
+}
+
+func TestSMTPMailerInvite(t *testing.T) {
+	expires := time.Date(2024, 6, 8, 9, 30, 0, 0, time.UTC)
+	link := "https://signage.example.com/accept-invite?token=abc123"
+	got, msg, body := sendThroughFake(t, InviteMessage("New User <new@example.com>", "editor", expires, link))
+
+	if got.from != "<no-reply@example.com>" {
+		t.Errorf("MAIL FROM = %q, want <no-reply@example.com>", got.from)
+	}
+	if len(got.to) != 1 || got.to[0] != "<new@example.com>" {
+		t.Errorf("RCPT TO = %q, want [<new@example.com>]", got.to)
+	}
+
+	for header, want := range map[string]string{
+		"From":                      "Digital Signage <no-reply@example.com>",
+		"To":                        "New User <new@example.com>",
+		"Subject":                   "You have been invited to Digital Signage",
+		"Mime-Version":              "1.0",
+		"Content-Type":              "text/plain; charset=UTF-8",
+		"Content-Transfer-Encoding": "8bit",
+	} {
+		if v := msg.Header.Get(header); v != want {
+			t.Errorf("%s = %q, want %q", header, v, want)
+		}
+	}
+	if id := msg.Header.Get("Message-Id"); !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Message-ID = %q, want one at example.com", id)
+	}
+	if _, err := msg.Header.Date(); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+
+	for _, want := range []string{"as editor.", expires.Format(time.RFC1123), link} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body doesn't contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestSMTPMailerPasswordReset(t *testing.T) {
+	link := "https://signage.example.com/reset-password?token=xyz"
+	got, msg, body := sendThroughFake(t, PasswordResetMessage("ana@example.com", "Ana", 30, link))
+
+	if len(got.to) != 1 || got.to[0] != "<ana@example.com>" {
+		t.Errorf("RCPT TO = %q, want [<ana@example.com>]", got.to)
+	}
+	if v := msg.Header.Get("Subject"); v != "Reset your password" {
+		t.Errorf("Subject = %q", v)
+	}
+	if v := msg.Header.Get("To"); v != "ana@example.com" {
+		t.Errorf("To = %q", v)
+	}
+	for _, want := range []string{"Hi Ana,", "expires in 30 minutes", link, "you can ignore this email"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body doesn't contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestSMTPMailerRejectsBadRecipient(t *testing.T) {
+	m := &SMTPMailer{Host: "127.0.0.1", Port: "1", From: "no-reply@example.com"}
+	if err := m.Send(Message{To: "not an address", Subject: "x", Body: "x"}); err == nil {
+		t.Error("Send accepted an invalid recipient")
+	}
+}
@@ -2,11 +2,16 @@ package main
 
 import (
 	"log"
-	"os"
+	_ "time/tzdata"
 
 	"digital-signage-backend/config"
+	"digital-signage-backend/dailyviews"
 	"digital-signage-backend/database"
+	"digital-signage-backend/mailer"
+	"digital-signage-backend/presence"
 	"digital-signage-backend/routes"
+	"digital-signage-backend/storage"
+	"digital-signage-backend/uploadsession"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -27,9 +32,23 @@ func main() {
 	}
 	defer database.Close()
 
-	// Create uploads directory
-	if err := os.MkdirAll(cfg.UploadPath, 0755); err != nil {
-		log.Fatalf("Failed to create uploads directory: %v", err)
+	// Initialize mail delivery
+	if err := mailer.Initialize(cfg); err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
+
+	// Mark devices offline once they stop checking in
+	presence.StartSweeper(cfg)
+
+	// Archive and reset today_views at each device's local midnight
+	dailyviews.StartRollover(cfg)
+
+	// Remove resumable uploads that were abandoned
+	uploadsession.StartCleaner(cfg)
+
+	// Initialize media storage
+	if err := storage.Initialize(cfg); err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 
 	// Set Gin mode
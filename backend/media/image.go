@@ -0,0 +1,53 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+)
+
+// probeImageConfig reads the dimensions of the formats the standard library
+// can decode.
+func probeImageConfig(r io.ReaderAt, size int64, info *Info) error {
+	cfg, _, err := image.DecodeConfig(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return err
+	}
+	info.Width, info.Height = cfg.Width, cfg.Height
+	return nil
+}
+
+// probeWebP reads the canvas size from the first chunk of a WebP file,
+// which is VP8 (lossy), VP8L (lossless) or VP8X (extended).
+func probeWebP(r io.ReaderAt, size int64, info *Info) error {
+	header := make([]byte, 30)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return err
+	}
+
+	switch string(header[12:16]) {
+	case "VP8 ":
+		if header[23] != 0x9D || header[24] != 0x01 || header[25] != 0x2A {
+			return errors.New("bad VP8 frame header")
+		}
+		info.Width = int(binary.LittleEndian.Uint16(header[26:28]) & 0x3FFF)
+		info.Height = int(binary.LittleEndian.Uint16(header[28:30]) & 0x3FFF)
+	case "VP8L":
+		if header[20] != 0x2F {
+			return errors.New("bad VP8L signature")
+		}
+		bits := binary.LittleEndian.Uint32(header[21:25])
+		info.Width = int(bits&0x3FFF) + 1
+		info.Height = int(bits>>14&0x3FFF) + 1
+	case "VP8X":
+		info.Width = int(uint32(header[24])|uint32(header[25])<<8|uint32(header[26])<<16) + 1
+		info.Height = int(uint32(header[27])|uint32(header[28])<<8|uint32(header[29])<<16) + 1
+	default:
+		return errors.New("unknown WebP chunk")
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Media types of ads, as used by CreateAdRequest.MediaType.
+const (
+	TypeImage = "image"
+	TypeVideo = "video"
+	TypePDF   = "pdf"
+)
+
+// ErrUnsupported is returned for content that isn't an allowed image, video
+// or PDF format.
+var ErrUnsupported = errors.New("unsupported file type: allowed are JPEG, PNG, GIF and WebP images, MP4, QuickTime and WebM videos, and PDF documents")
+
+// Info is what Inspect learned from a file's content.
+type Info struct {
+	MimeType string
+	// Type is image, video or pdf
+	Type string
+	// Width and Height are 0 when they couldn't be determined, as is
+	// Duration (in seconds, videos only)
+	Width    int
+	Height   int
+	Duration float64
+}
+
+// Extension is the file extension media of this type is stored with.
+func (info Info) Extension() string {
+	return formats[info.MimeType].ext
+}
+
+type format struct {
+	mediaType string
+	ext       string
+	// probe fills in dimensions and duration; nil when there is nothing to
+	// read for the format
+	probe func(r io.ReaderAt, size int64, info *Info) error
+}
+
+var formats = map[string]format{
+	"image/jpeg":      {TypeImage, ".jpg", probeImageConfig},
+	"image/png":       {TypeImage, ".png", probeImageConfig},
+	"image/gif":       {TypeImage, ".gif", probeImageConfig},
+	"image/webp":      {TypeImage, ".webp", probeWebP},
+	"video/mp4":       {TypeVideo, ".mp4", probeMP4},
+	"video/quicktime": {TypeVideo, ".mov", probeMP4},
+	"video/webm":      {TypeVideo, ".webm", probeWebM},
+	"application/pdf": {TypePDF, ".pdf", nil},
+}
+
+// SniffLen is how many leading bytes Sniff needs to recognize every format.
+const SniffLen = 64
+
+// mp4Brands are the ftyp brands of MP4 and QuickTime video. Other ISO media
+// files, like HEIC images or M4A audio, share the container but aren't
+// video.
+var mp4Brands = map[string]string{
+	"isom": "video/mp4", "iso2": "video/mp4", "iso3": "video/mp4", "iso4": "video/mp4",
+	"iso5": "video/mp4", "iso6": "video/mp4", "mp41": "video/mp4", "mp42": "video/mp4",
+	"avc1": "video/mp4", "dash": "video/mp4", "mmp4": "video/mp4",
+	"M4V ": "video/mp4", "M4VH": "video/mp4", "M4VP": "video/mp4",
+	"qt  ": "video/quicktime",
+}
+
+// Sniff identifies an allowed format from the first bytes of a file by its
+// magic number, ignoring names and declared content types. It returns ""
+// for anything else.
+func Sniff(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return "image/gif"
+	case len(head) >= 12 && string(head[0:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		return "image/webp"
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return "application/pdf"
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		return mp4Brands[string(head[8:12])]
+	case bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		// Matroska in general isn't allowed, only its WebM profile
+		if bytes.Contains(head, []byte("webm")) {
+			return "video/webm"
+		}
+	}
+	return ""
+}
+
+// Inspect sniffs the size bytes of r and reads dimensions and duration. It
+// returns ErrUnsupported unless the content is an allowed format, and an
+// error wrapping it when the file is damaged beyond reading its header.
+func Inspect(r io.ReaderAt, size int64) (Info, error) {
+	head := make([]byte, SniffLen)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return Info{}, err
+	}
+
+	mimeType := Sniff(head[:n])
+	f, ok := formats[mimeType]
+	if !ok {
+		return Info{}, ErrUnsupported
+	}
+
+	info := Info{MimeType: mimeType, Type: f.mediaType}
+	if f.probe != nil {
+		if err := f.probe(r, size, &info); err != nil {
+			return Info{}, fmt.Errorf("%w: unreadable %s: %v", ErrUnsupported, mimeType, err)
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,74 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// MaxRenditionPixels is the largest image renditions are made of. Decoding
+// takes about 4 bytes per pixel, so this keeps a single upload from taking
+// more than 200 MB of memory.
+const MaxRenditionPixels = 50000000
+
+// Rendition is a resized copy of an image, encoded as JPEG, or PNG when the
+// image has transparency.
+type Rendition struct {
+	Data      []byte
+	MimeType  string
+	Extension string
+	Width     int
+	Height    int
+}
+
+// DecodeImage decodes a JPEG, PNG, GIF or WebP image. Of an animated GIF
+// only the first frame is decoded.
+func DecodeImage(r io.Reader) (image.Image, error) {
+	img, _, err := image.Decode(r)
+	return img, err
+}
+
+// Fits reports whether a width x height image fits in a maxSize square
+// without resizing.
+func Fits(width, height, maxSize int) bool {
+	return width <= maxSize && height <= maxSize
+}
+
+// MakeRendition scales img down to fit in a maxSize square, keeping its
+// aspect ratio.
+func MakeRendition(img image.Image, maxSize int) (Rendition, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if !Fits(width, height, maxSize) {
+		if width >= height {
+			width, height = maxSize, max(1, height*maxSize/width)
+		} else {
+			width, height = max(1, width*maxSize/height), maxSize
+		}
+	}
+
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+
+	var buf bytes.Buffer
+	rendition := Rendition{Width: width, Height: height}
+	if scaled.Opaque() {
+		rendition.MimeType, rendition.Extension = "image/jpeg", ".jpg"
+		if err := jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: 85}); err != nil {
+			return Rendition{}, err
+		}
+	} else {
+		rendition.MimeType, rendition.Extension = "image/png", ".png"
+		if err := png.Encode(&buf, scaled); err != nil {
+			return Rendition{}, err
+		}
+	}
+	rendition.Data = buf.Bytes()
+	return rendition, nil
+}
@@ -0,0 +1,301 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// probeMP4 reads duration and dimensions from the moov box of an MP4 or
+// QuickTime file, which may come before or after the media data.
+func probeMP4(r io.ReaderAt, size int64, info *Info) error {
+	moov, err := findBox(r, 0, size, "moov")
+	if err != nil {
+		return err
+	}
+
+	for offset := moov.dataStart(); offset < moov.end(); {
+		b, err := readBox(r, offset, moov.end())
+		if err != nil {
+			return err
+		}
+		switch b.typ {
+		case "mvhd":
+			if err := readMvhd(r, b, info); err != nil {
+				return err
+			}
+		case "trak":
+			if info.Width == 0 {
+				if tkhd, err := findBox(r, b.dataStart(), b.end(), "tkhd"); err == nil {
+					readTkhd(r, tkhd, info)
+				}
+			}
+		}
+		offset = b.end()
+	}
+	return nil
+}
+
+type box struct {
+	typ    string
+	start  int64
+	size   int64
+	header int64
+}
+
+func (b box) dataStart() int64 { return b.start + b.header }
+func (b box) end() int64       { return b.start + b.size }
+
+// readBox reads the header of the box at offset, which has to end by end.
+func readBox(r io.ReaderAt, offset, end int64) (box, error) {
+	header := make([]byte, 16)
+	if _, err := r.ReadAt(header[:8], offset); err != nil {
+		return box{}, err
+	}
+	b := box{
+		typ:    string(header[4:8]),
+		start:  offset,
+		size:   int64(binary.BigEndian.Uint32(header[0:4])),
+		header: 8,
+	}
+	switch b.size {
+	case 0:
+		// Extends to the end of the file
+		b.size = end - offset
+	case 1:
+		if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+			return box{}, err
+		}
+		b.size = int64(binary.BigEndian.Uint64(header[8:16]))
+		b.header = 16
+	}
+	if b.size < b.header || b.size > end-offset {
+		return box{}, errors.New("box size out of range")
+	}
+	return b, nil
+}
+
+func findBox(r io.ReaderAt, offset, end int64, typ string) (box, error) {
+	for offset < end {
+		b, err := readBox(r, offset, end)
+		if err != nil {
+			return box{}, err
+		}
+		if b.typ == typ {
+			return b, nil
+		}
+		offset = b.end()
+	}
+	return box{}, errors.New("no " + typ + " box")
+}
+
+// readMvhd reads the movie duration. Version 1 boxes use 64-bit times.
+func readMvhd(r io.ReaderAt, b box, info *Info) error {
+	data := make([]byte, 32)
+	if n, _ := r.ReadAt(data, b.dataStart()); n < len(data) || b.size-b.header < int64(len(data)) {
+		return errors.New("short mvhd box")
+	}
+	var timescale, duration uint64
+	if data[0] == 1 {
+		timescale = uint64(binary.BigEndian.Uint32(data[20:24]))
+		duration = binary.BigEndian.Uint64(data[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(data[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(data[16:20]))
+	}
+	if timescale > 0 {
+		info.Duration = float64(duration) / float64(timescale)
+	}
+	return nil
+}
+
+// readTkhd reads the presentation size of a track, stored as 16.16 fixed
+// point numbers. Audio tracks have a size of zero.
+func readTkhd(r io.ReaderAt, b box, info *Info) {
+	data := make([]byte, 96)
+	n, _ := r.ReadAt(data, b.dataStart())
+	if int64(n) > b.size-b.header {
+		n = int(b.size - b.header)
+	}
+	at := 76
+	if n > 0 && data[0] == 1 {
+		at = 88
+	}
+	if n < at+8 {
+		return
+	}
+	info.Width = int(binary.BigEndian.Uint32(data[at:at+4]) >> 16)
+	info.Height = int(binary.BigEndian.Uint32(data[at+4:at+8]) >> 16)
+}
+
+// EBML element IDs used by probeWebM
+const (
+	ebmlHeader        = 0x1A45DFA3
+	ebmlSegment       = 0x18538067
+	ebmlInfo          = 0x1549A966
+	ebmlTimecodeScale = 0x2AD7B1
+	ebmlDuration      = 0x4489
+	ebmlTracks        = 0x1654AE6B
+	ebmlTrackEntry    = 0xAE
+	ebmlVideo         = 0xE0
+	ebmlPixelWidth    = 0xB0
+	ebmlPixelHeight   = 0xBA
+	ebmlCluster       = 0x1F43B675
+)
+
+// probeWebM reads duration and dimensions from the Info and Tracks elements
+// of a WebM file, which come before the first cluster of media data.
+func probeWebM(r io.ReaderAt, size int64, info *Info) error {
+	header, err := readElement(r, 0, size)
+	if err != nil || header.id != ebmlHeader {
+		return errors.New("no EBML header")
+	}
+	segment, err := readElement(r, header.end(), size)
+	if err != nil || segment.id != ebmlSegment {
+		return errors.New("no segment")
+	}
+
+	timecodeScale := uint64(1000000)
+	var duration float64
+	for offset := segment.dataStart; offset < segment.end(); {
+		el, err := readElement(r, offset, segment.end())
+		if err != nil || el.id == ebmlCluster {
+			break
+		}
+		switch el.id {
+		case ebmlInfo:
+			walkElements(r, el, func(child element) {
+				switch child.id {
+				case ebmlTimecodeScale:
+					if v, err := readUint(r, child); err == nil && v > 0 {
+						timecodeScale = v
+					}
+				case ebmlDuration:
+					duration, _ = readFloat(r, child)
+				}
+			})
+		case ebmlTracks:
+			walkElements(r, el, func(entry element) {
+				if entry.id != ebmlTrackEntry || info.Width > 0 {
+					return
+				}
+				walkElements(r, entry, func(video element) {
+					if video.id != ebmlVideo {
+						return
+					}
+					walkElements(r, video, func(child element) {
+						v, _ := readUint(r, child)
+						switch child.id {
+						case ebmlPixelWidth:
+							info.Width = int(v)
+						case ebmlPixelHeight:
+							info.Height = int(v)
+						}
+					})
+				})
+			})
+		}
+		offset = el.end()
+	}
+
+	info.Duration = duration * float64(timecodeScale) / 1e9
+	return nil
+}
+
+type element struct {
+	id        uint64
+	dataStart int64
+	size      int64
+}
+
+func (e element) end() int64 { return e.dataStart + e.size }
+
+// readElement reads the ID and size of the EBML element at offset. An
+// unknown size, as used for live streams, extends to end.
+func readElement(r io.ReaderAt, offset, end int64) (element, error) {
+	id, idLen, err := readVint(r, offset, false)
+	if err != nil {
+		return element{}, err
+	}
+	size, sizeLen, err := readVint(r, offset+int64(idLen), true)
+	if err != nil {
+		return element{}, err
+	}
+	el := element{id: id, dataStart: offset + int64(idLen+sizeLen)}
+	unknown := uint64(1)<<(7*sizeLen) - 1
+	if size == unknown || int64(size) > end-el.dataStart {
+		el.size = end - el.dataStart
+	} else {
+		el.size = int64(size)
+	}
+	return el, nil
+}
+
+// readVint reads an EBML variable length integer. IDs keep their length
+// marker bit, sizes don't.
+func readVint(r io.ReaderAt, offset int64, stripMarker bool) (uint64, int, error) {
+	first := make([]byte, 1)
+	if _, err := r.ReadAt(first, offset); err != nil {
+		return 0, 0, err
+	}
+	length := 1
+	for mask := byte(0x80); length <= 8 && first[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 {
+		return 0, 0, errors.New("invalid EBML integer")
+	}
+
+	data := make([]byte, length)
+	if _, err := r.ReadAt(data, offset); err != nil {
+		return 0, 0, err
+	}
+	if stripMarker {
+		data[0] &= 0xFF >> length
+	}
+	var v uint64
+	for _, b := range data {
+		v = v<<8 | uint64(b)
+	}
+	return v, length, nil
+}
+
+// walkElements calls fn for every child of parent.
+func walkElements(r io.ReaderAt, parent element, fn func(element)) {
+	for offset := parent.dataStart; offset < parent.end(); {
+		child, err := readElement(r, offset, parent.end())
+		if err != nil {
+			return
+		}
+		fn(child)
+		offset = child.end()
+	}
+}
+
+func readUint(r io.ReaderAt, el element) (uint64, error) {
+	if el.size < 1 || el.size > 8 {
+		return 0, errors.New("bad integer size")
+	}
+	data := make([]byte, el.size)
+	if _, err := r.ReadAt(data, el.dataStart); err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, b := range data {
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+func readFloat(r io.ReaderAt, el element) (float64, error) {
+	switch el.size {
+	case 4:
+		v, err := readUint(r, el)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 8:
+		v, err := readUint(r, el)
+		return math.Float64frombits(v), err
+	}
+	return 0, errors.New("bad float size")
+}
@@ -1,17 +1,28 @@
 package middleware
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"digital-signage-backend/config"
+	"digital-signage-backend/database"
 	"digital-signage-backend/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
+// AuthMiddleware accepts either a user's access token or an API key. API
+// key requests carry no role; RequirePermission checks their scopes instead.
 func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if key := apiKeyFromRequest(c); key != "" {
+			authenticateAPIKey(c, key)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
@@ -28,19 +39,70 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 
 		token := parts[1]
 		claims, err := utils.ValidateToken(token, cfg.JWTSecret)
+		if err == nil && claims.Purpose != "" {
+			err = errors.New("not an access token")
+		}
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
+		// Role and company are read from the database so role changes
+		// apply right away instead of when the token expires
+		// The session must still be live, which also covers deleted users
+		// and tokens issued before sessions existed
+		// The organization must match too; tokens from before organizations
+		// existed have none and are renewed through /auth/refresh.
+		// expires_at is written from Go, so it is compared with Go's clock
+		var role, company string
+		var disabled bool
+		err = database.DB.QueryRow(`
+			SELECT u.role, COALESCE(u.company_name, ''), u.is_disabled
+			FROM user_sessions s
+			JOIN users u ON u.id = s.user_id
+			WHERE s.id = ? AND s.user_id = ? AND u.org_id = ? AND s.revoked_at IS NULL AND s.expires_at > ?
+		`, claims.SessionID, claims.UserID, claims.OrgID, time.Now()).Scan(&role, &company, &disabled)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has expired or was revoked"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			c.Abort()
+			return
+		}
+		if disabled {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is disabled"})
+			c.Abort()
+			return
+		}
+
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
-		c.Set("user_role", claims.Role)
+		c.Set("user_role", role)
+		c.Set("user_company", company)
+		c.Set("org_id", claims.OrgID)
+		c.Set("session_id", claims.SessionID)
 		c.Next()
 	}
 }
 
+// OptionalAuthMiddleware authenticates the user when a bearer token is sent
+// and lets anonymous requests through untouched. Public endpoints use it to
+// narrow results for signed-in users, e.g. advertisers.
+func OptionalAuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+	required := AuthMiddleware(cfg)
+	return func(c *gin.Context) {
+		if !strings.HasPrefix(c.GetHeader("Authorization"), "Bearer ") && c.GetHeader("X-API-Key") == "" {
+			c.Next()
+			return
+		}
+		required(c)
+	}
+}
+
 func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userRole, exists := c.Get("user_role")
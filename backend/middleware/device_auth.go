@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"digital-signage-backend/database"
+	"digital-signage-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeviceAuthMiddleware authenticates a paired device by the credential it
+// received when pairing, sent as "Authorization: Device <token>" or in the
+// X-Device-Token header.
+func DeviceAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader("X-Device-Token")
+		if token == "" {
+			parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+			if len(parts) == 2 && parts[0] == "Device" {
+				token = parts[1]
+			}
+		}
+		if token == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Device credential required"})
+			c.Abort()
+			return
+		}
+
+		var deviceRowID, hardwareID, orgID string
+		err := database.DB.QueryRow(`
+			SELECT id, device_id, org_id FROM devices WHERE token_hash = ?
+		`, utils.HashToken(token)).Scan(&deviceRowID, &hardwareID, &orgID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or revoked device credential"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			c.Abort()
+			return
+		}
+
+		c.Set("device_row_id", deviceRowID)
+		c.Set("device_hardware_id", hardwareID)
+		c.Set("device_org_id", orgID)
+		c.Next()
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+
+	"digital-signage-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission lets the request through only when the authenticated
+// user's role, or the scopes of the API key used, grant permission. It must
+// run after AuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if allowed, isAPIKey := hasScope(c, permission); isAPIKey {
+			if !allowed {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error": "API key is missing the required scope",
+					"scope": permission,
+				})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		role := c.GetString("user_role")
+		if role == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Role information not found"})
+			c.Abort()
+			return
+		}
+
+		if !models.HasPermission(role, permission) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":      "Insufficient permissions",
+				"permission": permission,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -8,12 +8,14 @@ import (
 
 type Ad struct {
 	ID              string      `json:"id"`
+	OrgID           string      `json:"org_id"`
 	Title           string      `json:"title"`
 	MediaURL        string      `json:"media_url"`
 	MediaType       string      `json:"media_type"`
 	DurationSeconds int         `json:"duration_seconds"`
 	OrderIndex      int         `json:"order_index"`
 	IsEnabled       bool        `json:"is_enabled"`
+	Status          string      `json:"status"`
 	TargetLocations StringArray `json:"target_locations"`
 	CreatedBy       string      `json:"created_by"`
 	IsDeleted       bool        `json:"is_deleted"`
@@ -27,6 +29,60 @@ type Ad struct {
 	GalleryImages StringArray `json:"gallery_images"`
 	// Total views untuk tracking
 	TotalViews int `json:"total_views"`
+	// Campaign window and weekly dayparting
+	StartAt  *time.Time `json:"start_at"`
+	EndAt    *time.Time `json:"end_at"`
+	Schedule AdSchedule `json:"schedule"`
+	// Location, group and tag rules on top of TargetLocations
+	Targeting AdTargeting `json:"targeting"`
+	// Renditions of an uploaded image; nil for other media
+	ThumbnailURL *string `json:"thumbnail_url"`
+	PreviewURL   *string `json:"preview_url"`
+}
+
+// Review states of an ad. Only approved ads are ever put on screen.
+const (
+	AdStatusDraft     = "draft"
+	AdStatusSubmitted = "submitted"
+	AdStatusApproved  = "approved"
+	AdStatusRejected  = "rejected"
+	AdStatusArchived  = "archived"
+)
+
+// adTransitions lists the states each state may move to through the review
+// endpoints. An approved ad whose media is edited also goes back to
+// submitted, but that happens on update rather than on request.
+var adTransitions = map[string][]string{
+	AdStatusDraft:     {AdStatusSubmitted, AdStatusArchived},
+	AdStatusSubmitted: {AdStatusApproved, AdStatusRejected, AdStatusArchived},
+	AdStatusApproved:  {AdStatusArchived},
+	AdStatusRejected:  {AdStatusSubmitted, AdStatusArchived},
+	AdStatusArchived:  {AdStatusDraft},
+}
+
+// CanTransitionAd reports whether an ad in state from may move to state to.
+func CanTransitionAd(from, to string) bool {
+	for _, next := range adTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLiveAt reports whether the ad should be on screen at instant t, with
+// dayparting evaluated in loc (the device's timezone).
+func (ad *Ad) IsLiveAt(t time.Time, loc *time.Location) bool {
+	if !ad.IsEnabled || ad.IsDeleted || ad.Status != AdStatusApproved {
+		return false
+	}
+	if ad.StartAt != nil && t.Before(*ad.StartAt) {
+		return false
+	}
+	if ad.EndAt != nil && !t.Before(*ad.EndAt) {
+		return false
+	}
+	return ad.Schedule.Allows(t.In(loc))
 }
 
 // StringArray is a custom type for handling JSON arrays in MySQL
@@ -54,29 +110,67 @@ func (sa StringArray) Value() (driver.Value, error) {
 }
 
 type CreateAdRequest struct {
-	Title           string   `json:"title" binding:"required"`
-	MediaURL        string   `json:"media_url" binding:"required"`
-	MediaType       string   `json:"media_type" binding:"required,oneof=image video pdf"`
-	DurationSeconds int      `json:"duration_seconds" binding:"required,min=1"`
-	TargetLocations []string `json:"target_locations" binding:"required"`
-	Description     string   `json:"description"`
-	CompanyName     string   `json:"company_name"`
-	ContactInfo     string   `json:"contact_info"`
-	WebsiteURL      string   `json:"website_url"`
-	GalleryImages   []string `json:"gallery_images"`
+	Title           string       `json:"title" binding:"required"`
+	MediaURL        string       `json:"media_url" binding:"required"`
+	MediaType       string       `json:"media_type" binding:"required,oneof=image video pdf"`
+	DurationSeconds int          `json:"duration_seconds" binding:"required,min=1"`
+	TargetLocations []string     `json:"target_locations"`
+	Description     string       `json:"description"`
+	CompanyName     string       `json:"company_name"`
+	ContactInfo     string       `json:"contact_info"`
+	WebsiteURL      string       `json:"website_url"`
+	GalleryImages   []string     `json:"gallery_images"`
+	StartAt         *time.Time   `json:"start_at"`
+	EndAt           *time.Time   `json:"end_at"`
+	Schedule        AdSchedule   `json:"schedule"`
+	Targeting       *AdTargeting `json:"targeting"`
+	// Submit sends the new ad straight to review instead of saving a draft
+	Submit bool `json:"submit"`
 }
 
 type UpdateAdRequest struct {
-	Title           *string  `json:"title"`
-	MediaURL        *string  `json:"media_url"`
-	MediaType       *string  `json:"media_type"`
-	DurationSeconds *int     `json:"duration_seconds"`
-	IsEnabled       *bool    `json:"is_enabled"`
-	Description     *string  `json:"description"`
-	CompanyName     *string  `json:"company_name"`
-	ContactInfo     *string  `json:"contact_info"`
-	WebsiteURL      *string  `json:"website_url"`
-	TargetLocations []string `json:"target_locations"`
-	OrderIndex      *int     `json:"order_index"`
-	GalleryImages   []string `json:"gallery_images"`
+	Title           *string      `json:"title"`
+	MediaURL        *string      `json:"media_url"`
+	MediaType       *string      `json:"media_type"`
+	DurationSeconds *int         `json:"duration_seconds"`
+	IsEnabled       *bool        `json:"is_enabled"`
+	Description     *string      `json:"description"`
+	CompanyName     *string      `json:"company_name"`
+	ContactInfo     *string      `json:"contact_info"`
+	WebsiteURL      *string      `json:"website_url"`
+	TargetLocations []string     `json:"target_locations"`
+	OrderIndex      *int         `json:"order_index"`
+	GalleryImages   []string     `json:"gallery_images"`
+	StartAt         *time.Time   `json:"start_at"`
+	EndAt           *time.Time   `json:"end_at"`
+	Schedule        AdSchedule   `json:"schedule"`
+	Targeting       *AdTargeting `json:"targeting"`
+	// ClearStartAt / ClearEndAt remove a previously set campaign window bound
+	ClearStartAt bool `json:"clear_start_at"`
+	ClearEndAt   bool `json:"clear_end_at"`
+}
+
+// AdReview is one step in an ad's review history: who moved it from one
+// state to another, and why.
+type AdReview struct {
+	ID         string    `json:"id"`
+	AdID       string    `json:"ad_id"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Comment    string    `json:"comment"`
+	ActorID    *string   `json:"actor_id"`
+	ActorEmail string    `json:"actor_email"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AdStatusRequest is the optional body of the submit, archive and restore
+// endpoints.
+type AdStatusRequest struct {
+	Comment string `json:"comment"`
+}
+
+type AdReviewRequest struct {
+	Decision string `json:"decision" binding:"required,oneof=approve reject"`
+	// Comment is required when rejecting
+	Comment string `json:"comment"`
 }
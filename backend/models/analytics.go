@@ -31,3 +31,25 @@ type AnalyticsQuery struct {
 	EndDate   string `form:"end_date"`
 	AdID      string `form:"ad_id"`
 }
+
+// UptimeReport summarises availability of one device, or of every device at
+// a location, over a date range.
+type UptimeReport struct {
+	DeviceID             string  `json:"device_id,omitempty"`
+	HardwareID           string  `json:"hardware_id,omitempty"`
+	Location             string  `json:"location"`
+	DeviceCount          int     `json:"device_count"`
+	MonitoredSeconds     int64   `json:"monitored_seconds"`
+	OnlineSeconds        int64   `json:"online_seconds"`
+	UptimePercent        float64 `json:"uptime_percent"`
+	OutageCount          int     `json:"outage_count"`
+	LongestOutageSeconds int64   `json:"longest_outage_seconds"`
+	MTTRSeconds          float64 `json:"mttr_seconds"`
+}
+
+type UptimeQuery struct {
+	StartDate string `form:"start_date"`
+	EndDate   string `form:"end_date"`
+	DeviceID  string `form:"device_id"`
+	Location  string `form:"location"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+// APIKeyPrefix starts every API key so it can be told apart from a JWT.
+const APIKeyPrefix = "dsk_"
+
+// APIKey lets an integration call the API with a fixed set of scopes. The
+// key itself is only returned once; Prefix identifies it afterwards.
+type APIKey struct {
+	ID         string     `json:"id"`
+	OrgID      string     `json:"org_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     Scopes     `json:"scopes"`
+	CreatedBy  string     `json:"created_by"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Scopes is a list of permissions stored as a JSON array.
+type Scopes []string
+
+func (s *Scopes) Scan(value interface{}) error {
+	if value == nil {
+		*s = Scopes{}
+		return nil
+	}
+
+	b, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+
+	return json.Unmarshal(b, s)
+}
+
+func (s Scopes) Value() (driver.Value, error) {
+	if s == nil {
+		return json.Marshal([]string{})
+	}
+	return json.Marshal([]string(s))
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditLogEntry is one recorded change. Before and After are snapshots of
+// the entity; Changes holds only the fields that differ.
+type AuditLogEntry struct {
+	ID         string          `json:"id"`
+	OrgID      *string         `json:"org_id"`
+	ActorID    *string         `json:"actor_id"`
+	ActorEmail string          `json:"actor_email"`
+	APIKeyID   *string         `json:"api_key_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	IPAddress  string          `json:"ip_address"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	Changes    json.RawMessage `json:"changes"`
+	Details    json.RawMessage `json:"details"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
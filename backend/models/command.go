@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Remote commands a device understands
+const (
+	CommandReboot        = "reboot"
+	CommandReloadContent = "reload_content"
+	CommandClearCache    = "clear_cache"
+	CommandScreenshot    = "screenshot"
+	CommandSetVolume     = "set_volume"
+)
+
+// Command lifecycle: pending -> delivered (handed to the device with its
+// heartbeat) -> succeeded | failed. Commands not completed before
+// expires_at end up failed.
+const (
+	CommandStatusPending   = "pending"
+	CommandStatusDelivered = "delivered"
+	CommandStatusSucceeded = "succeeded"
+	CommandStatusFailed    = "failed"
+)
+
+type DeviceCommand struct {
+	ID           string          `json:"id"`
+	DeviceID     string          `json:"device_id"`
+	Command      string          `json:"command"`
+	Payload      json.RawMessage `json:"payload"`
+	Status       string          `json:"status"`
+	Result       json.RawMessage `json:"result"`
+	ErrorMessage string          `json:"error_message"`
+	CreatedBy    *string         `json:"created_by"`
+	CreatedAt    time.Time       `json:"created_at"`
+	ExpiresAt    time.Time       `json:"expires_at"`
+	DeliveredAt  *time.Time      `json:"delivered_at"`
+	CompletedAt  *time.Time      `json:"completed_at"`
+}
+
+type CreateCommandRequest struct {
+	Command string          `json:"command" binding:"required,oneof=reboot reload_content clear_cache screenshot set_volume"`
+	Payload json.RawMessage `json:"payload"`
+	// TTLSeconds defaults to one hour
+	TTLSeconds int `json:"ttl_seconds" binding:"omitempty,min=10,max=604800"`
+}
+
+type CommandResultRequest struct {
+	Status string          `json:"status" binding:"required,oneof=succeeded failed"`
+	Result json.RawMessage `json:"result"`
+	Error  string          `json:"error"`
+}
+
+// SetVolumePayload is the payload of a set_volume command.
+type SetVolumePayload struct {
+	Volume *int `json:"volume"`
+}
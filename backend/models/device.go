@@ -8,12 +8,19 @@ import (
 
 type Device struct {
 	ID          string          `json:"id"`
+	OrgID       string          `json:"org_id"`
 	DeviceID    string          `json:"device_id"`
 	Location    string          `json:"location"`
+	Timezone    string          `json:"timezone"`
 	IsOnline    bool            `json:"is_online"`
 	LastActive  time.Time       `json:"last_active"`
 	TodayViews  int             `json:"today_views"`
 	Settings    DeviceSettings  `json:"settings"`
+	Tags        TagList         `json:"tags"`
+	IsPaired    bool            `json:"is_paired"`
+	// Connected is true while the device holds an open push channel
+	Connected      bool       `json:"connected"`
+	ConnectedSince *time.Time `json:"connected_since,omitempty"`
 	CreatedAt   time.Time       `json:"created_at"`
 	UpdatedAt   time.Time       `json:"updated_at"`
 }
@@ -41,11 +48,23 @@ type RegisterDeviceRequest struct {
 	DeviceName string `json:"device_name"`
 	DeviceType string `json:"device_type"`
 	Location   string `json:"location" binding:"required"`
+	Timezone   string `json:"timezone"`
 }
 
 type UpdateDeviceRequest struct {
 	Location   *string         `json:"location"`
+	Timezone   *string         `json:"timezone"`
 	IsOnline   *bool           `json:"is_online"`
 	TodayViews *int            `json:"today_views"`
 	Settings   *DeviceSettings `json:"settings"`
+	Tags       []string        `json:"tags"`
+}
+
+// DeviceStatusChange is one online/offline transition of a device.
+type DeviceStatusChange struct {
+	ID        string    `json:"id"`
+	DeviceID  string    `json:"device_id"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason"`
+	ChangedAt time.Time `json:"changed_at"`
 }
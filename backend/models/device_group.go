@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// DeviceGroup is a named set of devices that ads can target, e.g. every
+// screen in the east wing of a mall.
+type DeviceGroup struct {
+	ID          string    `json:"id"`
+	OrgID       string    `json:"org_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	DeviceCount int       `json:"device_count"`
+	DeviceIDs   []string  `json:"device_ids,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type CreateDeviceGroupRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	DeviceIDs   []string `json:"device_ids"`
+}
+
+type UpdateDeviceGroupRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+type SetGroupDevicesRequest struct {
+	DeviceIDs []string `json:"device_ids" binding:"required"`
+}
@@ -0,0 +1,39 @@
+package models
+
+// ManifestMedia describes one media file a player has to download. SHA256
+// and SizeBytes are empty for media that is not hosted by this server.
+type ManifestMedia struct {
+	URL       string `json:"url"`
+	SHA256    string `json:"sha256,omitempty"`
+	SizeBytes int64  `json:"size_bytes,omitempty"`
+}
+
+type ManifestItem struct {
+	AdID            string          `json:"ad_id"`
+	Title           string          `json:"title"`
+	MediaType       string          `json:"media_type"`
+	Media           ManifestMedia   `json:"media"`
+	DurationSeconds int             `json:"duration_seconds"`
+	Position        int             `json:"position"`
+	Description     string          `json:"description"`
+	CompanyName     string          `json:"company_name"`
+	ContactInfo     string          `json:"contact_info"`
+	WebsiteURL      string          `json:"website_url"`
+	Gallery         []ManifestMedia `json:"gallery"`
+}
+
+type ManifestSettings struct {
+	SlideshowInterval int  `json:"slideshowInterval"`
+	VideoAutoplay     bool `json:"videoAutoplay"`
+}
+
+// Manifest is the exact ordered content a device should play. It carries no
+// timestamps so that its ETag only changes when the content does.
+type Manifest struct {
+	DeviceID   string           `json:"device_id"`
+	Source     string           `json:"source"`
+	PlaylistID string           `json:"playlist_id,omitempty"`
+	Settings   ManifestSettings `json:"settings"`
+	Items      []ManifestItem   `json:"items"`
+	TotalBytes int64            `json:"total_bytes"`
+}
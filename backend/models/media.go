@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+)
+
+// MediaAsset is an uploaded file with what was learned from its content.
+// Width and Height are set for images and videos, Duration for videos, when
+// they could be read. Images get a thumbnail and a screen-size preview,
+// which are the original itself when it is no larger. Identical files are
+// stored once per organization.
+type MediaAsset struct {
+	ID              string   `json:"id"`
+	OrgID           string   `json:"org_id"`
+	URL             string   `json:"url"`
+	StorageKey      string   `json:"storage_key"`
+	OriginalName    string   `json:"original_name"`
+	MimeType        string   `json:"mime_type"`
+	MediaType       string   `json:"media_type"`
+	SizeBytes       int64    `json:"size_bytes"`
+	SHA256          string   `json:"sha256"`
+	Width           *int     `json:"width"`
+	Height          *int     `json:"height"`
+	DurationSeconds *float64 `json:"duration_seconds"`
+	ThumbnailURL    *string  `json:"thumbnail_url"`
+	PreviewURL      *string  `json:"preview_url"`
+	CreatedBy       *string  `json:"created_by"`
+	CreatedByEmail  string   `json:"created_by_email"`
+	// ReferenceCount is how many ads use the asset as media or in their
+	// gallery
+	ReferenceCount int       `json:"reference_count"`
+	CreatedAt      time.Time `json:"created_at"`
+	// LastUploadedAt is when the file was last uploaded again after it was
+	// already stored
+	LastUploadedAt *time.Time `json:"last_uploaded_at"`
+	// References is only filled in for a single asset
+	References []MediaReference `json:"references,omitempty"`
+}
+
+// MediaReference is an ad using an asset. Field is media_url or
+// gallery_images.
+type MediaReference struct {
+	AdID   string `json:"ad_id"`
+	Title  string `json:"title"`
+	Status string `json:"status"`
+	Field  string `json:"field"`
+}
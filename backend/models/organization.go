@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// DefaultOrgID is the organization created by the migrations. Everything
+// that existed before organizations were introduced belongs to it, and so do
+// accounts created through open registration.
+const DefaultOrgID = "00000000-0000-0000-0000-000000000001"
+
+// Organization is one tenant, e.g. a venue operator. Users, ads, devices,
+// playlists and device groups each belong to exactly one organization.
+type Organization struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	UserCount   int       `json:"user_count"`
+	DeviceCount int       `json:"device_count"`
+	AdCount     int       `json:"ad_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type UpdateOrganizationRequest struct {
+	Name *string `json:"name"`
+}
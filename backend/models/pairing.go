@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	PairingStatusPending   = "pending"
+	PairingStatusClaimed   = "claimed"
+	PairingStatusCompleted = "completed"
+)
+
+type DevicePairing struct {
+	ID         string     `json:"id"`
+	Code       string     `json:"code"`
+	HardwareID string     `json:"hardware_id"`
+	Status     string     `json:"status"`
+	DeviceID   *string    `json:"device_id"`
+	ClaimedBy  *string    `json:"claimed_by"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	ClaimedAt  *time.Time `json:"claimed_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// RequestPairingRequest is sent by an unpaired device. DeviceID is the
+// hardware id it would like to keep; one is generated when empty.
+type RequestPairingRequest struct {
+	DeviceID string `json:"device_id"`
+}
+
+type PairingStatusRequest struct {
+	PairingID     string `json:"pairing_id" binding:"required"`
+	PairingSecret string `json:"pairing_secret" binding:"required"`
+}
+
+type ClaimPairingRequest struct {
+	Code     string `json:"code" binding:"required"`
+	Location string `json:"location" binding:"required"`
+	Timezone string `json:"timezone"`
+	// Repair confirms replacing the credential of a device that is
+	// already paired
+	Repair bool `json:"repair"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	PlaylistTargetDevice   = "device"
+	PlaylistTargetLocation = "location"
+)
+
+type Playlist struct {
+	ID          string               `json:"id"`
+	OrgID       string               `json:"org_id"`
+	Name        string               `json:"name"`
+	Description string               `json:"description"`
+	CreatedBy   string               `json:"created_by"`
+	CreatedAt   time.Time            `json:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at"`
+	Items       []PlaylistItem       `json:"items"`
+	Assignments []PlaylistAssignment `json:"assignments"`
+}
+
+type PlaylistItem struct {
+	ID         string `json:"id"`
+	PlaylistID string `json:"playlist_id"`
+	AdID       string `json:"ad_id"`
+	Position   int    `json:"position"`
+	// DurationSeconds overrides the ad's own duration when set
+	DurationSeconds *int `json:"duration_seconds"`
+	Ad              *Ad  `json:"ad,omitempty"`
+}
+
+// PlaylistAssignment links a playlist to a single device (by devices.id) or
+// to every device at a location. A device assignment wins over a location one.
+type PlaylistAssignment struct {
+	ID          string    `json:"id"`
+	PlaylistID  string    `json:"playlist_id"`
+	TargetType  string    `json:"target_type"`
+	TargetValue string    `json:"target_value"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type PlaylistItemInput struct {
+	AdID            string `json:"ad_id" binding:"required"`
+	DurationSeconds *int   `json:"duration_seconds" binding:"omitempty,min=1"`
+}
+
+type CreatePlaylistRequest struct {
+	Name        string              `json:"name" binding:"required"`
+	Description string              `json:"description"`
+	Items       []PlaylistItemInput `json:"items" binding:"dive"`
+}
+
+type UpdatePlaylistRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+type SetPlaylistItemsRequest struct {
+	Items []PlaylistItemInput `json:"items" binding:"required,dive"`
+}
+
+type AssignPlaylistRequest struct {
+	TargetType  string `json:"target_type" binding:"required,oneof=device location"`
+	TargetValue string `json:"target_value" binding:"required"`
+}
@@ -0,0 +1,106 @@
+package models
+
+// User roles, from most to least privileged.
+const (
+	RoleSuperAdmin = "super_admin"
+	RoleAdmin      = "admin"
+	RoleEditor     = "editor"
+	RoleViewer     = "viewer"
+	RoleAdvertiser = "advertiser"
+)
+
+// Permissions are checked per route. They take the form "resource:action".
+const (
+	PermAdsRead        = "ads:read"
+	PermAdsWrite       = "ads:write"
+	PermAdsReorder     = "ads:reorder"
+	PermAdsReview      = "ads:review"
+	PermPlaylistsRead  = "playlists:read"
+	PermPlaylistsWrite = "playlists:write"
+	PermDevicesRead    = "devices:read"
+	PermDevicesWrite   = "devices:write"
+	PermDevicesCommand = "devices:command"
+	PermAnalyticsRead  = "analytics:read"
+	PermUsersRead      = "users:read"
+	PermUsersWrite     = "users:write"
+	PermAPIKeysManage  = "api_keys:manage"
+	PermAuditRead      = "audit:read"
+	// PermOrganizationsManage is held by super admins only
+	PermOrganizationsManage = "organizations:manage"
+)
+
+var allPermissions = []string{
+	PermAdsRead, PermAdsWrite, PermAdsReorder, PermAdsReview,
+	PermPlaylistsRead, PermPlaylistsWrite,
+	PermDevicesRead, PermDevicesWrite, PermDevicesCommand,
+	PermAnalyticsRead,
+	PermUsersRead, PermUsersWrite,
+	PermAPIKeysManage,
+	PermAuditRead,
+}
+
+// RolePermissions is the permission matrix. Admins can do everything within
+// their organization. Super admins can also manage organizations, work
+// across all of them, and are the only ones who may hand out or take away
+// the admin and super admin roles. Only admins approve or reject ads.
+// Advertisers only ever see and edit ads of their own company.
+var RolePermissions = map[string][]string{
+	RoleSuperAdmin: append(append([]string{}, allPermissions...), PermOrganizationsManage),
+	RoleAdmin:      allPermissions,
+	RoleEditor: {
+		PermAdsRead, PermAdsWrite, PermAdsReorder,
+		PermPlaylistsRead, PermPlaylistsWrite,
+		PermDevicesRead,
+		PermAnalyticsRead,
+	},
+	RoleViewer: {
+		PermAdsRead,
+		PermPlaylistsRead,
+		PermDevicesRead,
+		PermAnalyticsRead,
+	},
+	RoleAdvertiser: {
+		PermAdsRead, PermAdsWrite,
+	},
+}
+
+// IsValidRole reports whether role is one of the known roles.
+func IsValidRole(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
+
+// HasPermission reports whether role grants permission.
+func HasPermission(role, permission string) bool {
+	for _, p := range RolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// IsGrantableScope reports whether permission may be given to an API key.
+// Keys can't manage other keys, so a leaked key can't mint new ones.
+func IsGrantableScope(permission string) bool {
+	if permission == PermAPIKeysManage {
+		return false
+	}
+	for _, p := range allPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdminRole reports whether role is admin or super admin.
+func IsAdminRole(role string) bool {
+	return role == RoleSuperAdmin || role == RoleAdmin
+}
+
+type UpdateUserRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=super_admin admin editor viewer advertiser"`
+	// CompanyName is required for advertisers and ties them to their ads
+	CompanyName *string `json:"company_name"`
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// DaypartRule is a weekly recurring window, e.g. Mon–Fri 07:00–10:00.
+// Days uses short names ("mon".."sun"); an empty list means every day.
+// EndTime may be earlier than StartTime for windows that run past midnight,
+// in which case the day refers to the day the window starts.
+type DaypartRule struct {
+	Days      []string `json:"days"`
+	StartTime string   `json:"start_time"`
+	EndTime   string   `json:"end_time"`
+}
+
+// AdSchedule is the list of dayparting rules of an ad. An ad with no rules
+// runs all day, every day.
+type AdSchedule []DaypartRule
+
+func (s *AdSchedule) Scan(value interface{}) error {
+	if value == nil {
+		*s = AdSchedule{}
+		return nil
+	}
+
+	b, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+
+	return json.Unmarshal(b, s)
+}
+
+func (s AdSchedule) Value() (driver.Value, error) {
+	if s == nil {
+		return json.Marshal(AdSchedule{})
+	}
+	return json.Marshal(s)
+}
+
+// Validate checks day names and HH:MM times of every rule.
+func (s AdSchedule) Validate() error {
+	for i, rule := range s {
+		for _, day := range rule.Days {
+			if _, ok := weekdayNames[strings.ToLower(day)]; !ok {
+				return fmt.Errorf("schedule[%d]: invalid day %q", i, day)
+			}
+		}
+		start, err := parseClock(rule.StartTime)
+		if err != nil {
+			return fmt.Errorf("schedule[%d]: invalid start_time: %w", i, err)
+		}
+		end, err := parseClock(rule.EndTime)
+		if err != nil {
+			return fmt.Errorf("schedule[%d]: invalid end_time: %w", i, err)
+		}
+		if start == end {
+			return fmt.Errorf("schedule[%d]: start_time and end_time must differ", i)
+		}
+	}
+	return nil
+}
+
+// Allows reports whether t (already converted to the device's timezone)
+// falls inside any of the rules.
+func (s AdSchedule) Allows(t time.Time) bool {
+	if len(s) == 0 {
+		return true
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	for _, rule := range s {
+		start, err := parseClock(rule.StartTime)
+		if err != nil {
+			continue
+		}
+		end, err := parseClock(rule.EndTime)
+		if err != nil {
+			continue
+		}
+
+		if start < end {
+			if minute >= start && minute < end && rule.hasDay(t.Weekday()) {
+				return true
+			}
+			continue
+		}
+
+		// Overnight window: the evening part belongs to today, the early
+		// morning part to the window that started yesterday.
+		if minute >= start && rule.hasDay(t.Weekday()) {
+			return true
+		}
+		if minute < end && rule.hasDay((t.Weekday()+6)%7) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r DaypartRule) hasDay(day time.Weekday) bool {
+	if len(r.Days) == 0 {
+		return true
+	}
+	for _, d := range r.Days {
+		if wd, ok := weekdayNames[strings.ToLower(d)]; ok && wd == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock converts "HH:MM" into minutes since midnight. "24:00" is
+// accepted as the end of the day.
+func parseClock(value string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hour, &minute); err != nil {
+		return 0, fmt.Errorf("expected HH:MM, got %q", value)
+	}
+	if hour == 24 && minute == 0 {
+		return 24 * 60, nil
+	}
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("expected HH:MM, got %q", value)
+	}
+	return hour*60 + minute, nil
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// at returns a time in the week of Monday 2024-06-03.
+func at(weekday time.Weekday, clock string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", "2024-06-03 "+clock)
+	if err != nil {
+		panic(err)
+	}
+	return t.AddDate(0, 0, (int(weekday)+6)%7)
+}
+
+func TestAdScheduleAllows(t *testing.T) {
+	breakfast := AdSchedule{{Days: []string{"mon", "tue", "wed", "thu", "fri"}, StartTime: "07:00", EndTime: "10:00"}}
+	// Friday and Saturday nights, 22:00 to 02:00 the next morning
+	lateNight := AdSchedule{{Days: []string{"Fri", "SAT"}, StartTime: "22:00", EndTime: "02:00"}}
+	evening := AdSchedule{{StartTime: "18:00", EndTime: "24:00"}}
+
+	tests := []struct {
+		name     string
+		schedule AdSchedule
+		at       time.Time
+		want     bool
+	}{
+		{"no rules", AdSchedule{}, at(time.Sunday, "03:00"), true},
+
+		{"inside a daytime window", breakfast, at(time.Monday, "07:00"), true},
+		{"end is exclusive", breakfast, at(time.Monday, "10:00"), false},
+		{"before the window", breakfast, at(time.Monday, "06:59"), false},
+		{"day not listed", breakfast, at(time.Saturday, "08:00"), false},
+
+		{"overnight, evening part", lateNight, at(time.Friday, "23:30"), true},
+		{"overnight, after midnight belongs to the day before", lateNight, at(time.Saturday, "01:59"), true},
+		{"overnight, end is exclusive", lateNight, at(time.Saturday, "02:00"), false},
+		{"overnight, morning after a day not listed", lateNight, at(time.Friday, "01:00"), false},
+		{"overnight, evening of a day not listed", lateNight, at(time.Sunday, "23:00"), false},
+		{"overnight wraps from Saturday into Sunday", lateNight, at(time.Sunday, "00:30"), true},
+		{"overnight, between end and start", lateNight, at(time.Saturday, "12:00"), false},
+
+		{"24:00 runs to the end of the day", evening, at(time.Wednesday, "23:59"), true},
+		{"24:00 doesn't spill into the next day", evening, at(time.Thursday, "00:00"), false},
+
+		{"any rule matching is enough", append(append(AdSchedule{}, breakfast...), evening...), at(time.Saturday, "19:00"), true},
+		{"rules with invalid clocks are skipped", AdSchedule{{StartTime: "7am", EndTime: "10:00"}}, at(time.Monday, "08:00"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.Allows(tt.at); got != tt.want {
+				t.Errorf("Allows(%s) = %v, want %v", tt.at.Format("Mon 15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	valid := map[string]int{
+		"00:00": 0,
+		"07:30": 7*60 + 30,
+		"23:59": 23*60 + 59,
+		"24:00": 24 * 60,
+	}
+	for value, want := range valid {
+		if got, err := parseClock(value); err != nil || got != want {
+			t.Errorf("parseClock(%q) = %d, %v, want %d", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"", "7", "ab:cd", "24:01", "25:00", "12:60", "-1:00", "12:-5"} {
+		if _, err := parseClock(value); err == nil {
+			t.Errorf("parseClock(%q) succeeded", value)
+		}
+	}
+}
+
+func TestAdScheduleValidate(t *testing.T) {
+	valid := AdSchedule{
+		{Days: []string{"Mon", "sun"}, StartTime: "22:00", EndTime: "02:00"},
+		{StartTime: "00:00", EndTime: "24:00"},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	invalid := map[string]DaypartRule{
+		"unknown day":        {Days: []string{"monday"}, StartTime: "07:00", EndTime: "10:00"},
+		"invalid start_time": {StartTime: "7am", EndTime: "10:00"},
+		"invalid end_time":   {StartTime: "07:00", EndTime: "24:30"},
+		"empty window":       {StartTime: "07:00", EndTime: "07:00"},
+	}
+	for name, rule := range invalid {
+		if err := (AdSchedule{rule}).Validate(); err == nil {
+			t.Errorf("%s: Validate() succeeded", name)
+		}
+	}
+}
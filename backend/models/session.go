@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// Reasons a session was revoked
+const (
+	SessionRevokedLogout        = "logout"
+	SessionRevokedLogoutAll     = "logout_all"
+	SessionRevokedByUser        = "revoked"
+	SessionRevokedPasswordReset = "password_reset"
+	SessionRevokedDisabled      = "disabled"
+	SessionRevokedRefreshReuse  = "refresh_reuse"
+)
+
+// Session is one login of a user. Access tokens carry its ID; the refresh
+// token rotates on every use and is only stored hashed.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Current    bool       `json:"current"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// TargetSet lists the locations, device group IDs and device tags of one side
+// of an ad's targeting rules.
+type TargetSet struct {
+	Locations []string `json:"locations"`
+	Groups    []string `json:"groups"`
+	Tags      []string `json:"tags"`
+}
+
+func (s TargetSet) isEmpty() bool {
+	return len(s.Locations) == 0 && len(s.Groups) == 0 && len(s.Tags) == 0
+}
+
+// AdTargeting holds include/exclude rules of an ad.
+//
+// A device is included when it matches every non-empty include dimension,
+// where a dimension matches if any of its values does (e.g. "location is
+// Jakarta or Bandung, and the device has the portrait tag"). Empty include
+// rules match every device. A device matching any exclude value is never
+// targeted, whatever the include rules say.
+type AdTargeting struct {
+	Include TargetSet `json:"include"`
+	Exclude TargetSet `json:"exclude"`
+}
+
+// TargetSubject is what targeting rules are evaluated against: a device's
+// location, the IDs of the groups it belongs to and its tags.
+type TargetSubject struct {
+	Location string
+	Groups   []string
+	Tags     []string
+}
+
+func (t *AdTargeting) Scan(value interface{}) error {
+	if value == nil {
+		*t = AdTargeting{}
+		return nil
+	}
+
+	b, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+
+	return json.Unmarshal(b, t)
+}
+
+func (t AdTargeting) Value() (driver.Value, error) {
+	return json.Marshal(t.Normalized())
+}
+
+// Normalized trims values, lowercases tags and drops empty entries.
+func (t AdTargeting) Normalized() AdTargeting {
+	return AdTargeting{
+		Include: t.Include.normalized(),
+		Exclude: t.Exclude.normalized(),
+	}
+}
+
+func (s TargetSet) normalized() TargetSet {
+	return TargetSet{
+		Locations: cleanValues(s.Locations, false),
+		Groups:    cleanValues(s.Groups, false),
+		Tags:      NormalizeTags(s.Tags),
+	}
+}
+
+// Validate rejects the "all" wildcard inside targeting rules, where it would
+// be ambiguous; an empty include set already means every device.
+func (t AdTargeting) Validate() error {
+	for _, side := range []struct {
+		name string
+		set  TargetSet
+	}{{"include", t.Include}, {"exclude", t.Exclude}} {
+		for _, loc := range side.set.Locations {
+			if strings.EqualFold(strings.TrimSpace(loc), "all") {
+				return fmt.Errorf("targeting.%s.locations: \"all\" is not allowed, leave the list empty instead", side.name)
+			}
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the rules target subject.
+func (t AdTargeting) Matches(subject TargetSubject) bool {
+	tags := NormalizeTags(subject.Tags)
+
+	if anyEqual(t.Exclude.Locations, []string{subject.Location}) ||
+		anyEqual(t.Exclude.Groups, subject.Groups) ||
+		anyEqual(NormalizeTags(t.Exclude.Tags), tags) {
+		return false
+	}
+
+	if len(t.Include.Locations) > 0 && !anyEqual(t.Include.Locations, []string{subject.Location}) {
+		return false
+	}
+	if len(t.Include.Groups) > 0 && !anyEqual(t.Include.Groups, subject.Groups) {
+		return false
+	}
+	if len(t.Include.Tags) > 0 && !anyEqual(NormalizeTags(t.Include.Tags), tags) {
+		return false
+	}
+	return true
+}
+
+// Targets evaluates the ad's targeting rules together with the legacy
+// TargetLocations list, which acts as an extra set of included locations
+// unless it contains "all".
+func (ad *Ad) Targets(subject TargetSubject) bool {
+	rules := ad.Targeting
+	legacy := []string{}
+	for _, loc := range ad.TargetLocations {
+		if loc == "all" {
+			legacy = nil
+			break
+		}
+		legacy = append(legacy, loc)
+	}
+	if len(legacy) > 0 {
+		rules.Include.Locations = append(append([]string{}, rules.Include.Locations...), legacy...)
+	}
+	return rules.Matches(subject)
+}
+
+// IsTargeted reports whether the ad has any include or exclude rule beyond
+// the legacy location list.
+func (t AdTargeting) IsTargeted() bool {
+	return !t.Include.isEmpty() || !t.Exclude.isEmpty()
+}
+
+// TagList is a device's free-form tags, stored as a JSON array.
+type TagList []string
+
+func (tl *TagList) Scan(value interface{}) error {
+	if value == nil {
+		*tl = TagList{}
+		return nil
+	}
+
+	b, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+
+	return json.Unmarshal(b, tl)
+}
+
+func (tl TagList) Value() (driver.Value, error) {
+	return json.Marshal(NormalizeTags(tl))
+}
+
+// NormalizeTags lowercases and trims tags and removes blanks and duplicates,
+// so "Food-Court " and "food-court" are the same tag.
+func NormalizeTags(tags []string) []string {
+	return cleanValues(tags, true)
+}
+
+func cleanValues(values []string, lower bool) []string {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if lower {
+			v = strings.ToLower(v)
+		}
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		out = append(out, v)
+	}
+	return out
+}
+
+func anyEqual(rules, values []string) bool {
+	for _, r := range rules {
+		for _, v := range values {
+			if r == v {
+				return true
+			}
+		}
+	}
+	return false
+}
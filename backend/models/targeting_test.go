@@ -0,0 +1,85 @@
+package models
+
+import "testing"
+
+func TestAdTargetingMatches(t *testing.T) {
+	lobby := TargetSubject{Location: "Lobby", Groups: []string{"g-mall"}, Tags: []string{"Portrait", "food-court"}}
+	bare := TargetSubject{Location: "Gate 3"}
+
+	tests := []struct {
+		name      string
+		targeting AdTargeting
+		subject   TargetSubject
+		want      bool
+	}{
+		{"empty targeting matches everything", AdTargeting{}, lobby, true},
+		{"empty targeting matches a bare device", AdTargeting{}, bare, true},
+
+		{"location included", AdTargeting{Include: TargetSet{Locations: []string{"Gate 3", "Lobby"}}}, lobby, true},
+		{"location not included", AdTargeting{Include: TargetSet{Locations: []string{"Gate 3"}}}, lobby, false},
+
+		{"group included", AdTargeting{Include: TargetSet{Groups: []string{"g-mall"}}}, lobby, true},
+		{"group not included", AdTargeting{Include: TargetSet{Groups: []string{"g-airport"}}}, lobby, false},
+		{"group rule and device without groups", AdTargeting{Include: TargetSet{Groups: []string{"g-mall"}}}, bare, false},
+
+		{"tag included", AdTargeting{Include: TargetSet{Tags: []string{"portrait"}}}, lobby, true},
+		{"tag matches regardless of case and spaces", AdTargeting{Include: TargetSet{Tags: []string{" FOOD-COURT "}}}, lobby, true},
+		{"tag not included", AdTargeting{Include: TargetSet{Tags: []string{"landscape"}}}, lobby, false},
+
+		{"every dimension has to match", AdTargeting{Include: TargetSet{
+			Locations: []string{"Lobby"}, Groups: []string{"g-mall"}, Tags: []string{"portrait"},
+		}}, lobby, true},
+		{"one dimension failing excludes", AdTargeting{Include: TargetSet{
+			Locations: []string{"Lobby"}, Groups: []string{"g-mall"}, Tags: []string{"landscape"},
+		}}, lobby, false},
+
+		{"location excluded", AdTargeting{Exclude: TargetSet{Locations: []string{"Lobby"}}}, lobby, false},
+		{"group excluded", AdTargeting{Exclude: TargetSet{Groups: []string{"g-mall"}}}, lobby, false},
+		{"tag excluded", AdTargeting{Exclude: TargetSet{Tags: []string{"Portrait"}}}, lobby, false},
+		{"unrelated exclusion", AdTargeting{Exclude: TargetSet{Locations: []string{"Gate 3"}, Tags: []string{"outdoor"}}}, lobby, true},
+		{"exclusion beats inclusion", AdTargeting{
+			Include: TargetSet{Locations: []string{"Lobby"}},
+			Exclude: TargetSet{Groups: []string{"g-mall"}},
+		}, lobby, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.targeting.Matches(tt.subject); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdTargets(t *testing.T) {
+	lobby := TargetSubject{Location: "Lobby", Tags: []string{"portrait"}}
+
+	tests := []struct {
+		name      string
+		locations StringArray
+		targeting AdTargeting
+		want      bool
+	}{
+		{"no rules", nil, AdTargeting{}, true},
+		{"legacy all", StringArray{"all"}, AdTargeting{}, true},
+		{"legacy all with other locations", StringArray{"Gate 3", "all"}, AdTargeting{}, true},
+		{"legacy location matches", StringArray{"Lobby"}, AdTargeting{}, true},
+		{"legacy location doesn't match", StringArray{"Gate 3"}, AdTargeting{}, false},
+		{"legacy list adds to included locations", StringArray{"Lobby"},
+			AdTargeting{Include: TargetSet{Locations: []string{"Gate 3"}}}, true},
+		{"legacy all and an include rule", StringArray{"all"},
+			AdTargeting{Include: TargetSet{Locations: []string{"Gate 3"}}}, false},
+		{"exclusion overrides the legacy list", StringArray{"Lobby"},
+			AdTargeting{Exclude: TargetSet{Tags: []string{"portrait"}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ad := &Ad{TargetLocations: tt.locations, Targeting: tt.targeting}
+			if got := ad.Targets(lobby); got != tt.want {
+				t.Errorf("Targets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
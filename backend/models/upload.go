@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	UploadStatusUploading = "uploading"
+	UploadStatusCompleted = "completed"
+)
+
+// UploadSession is a resumable upload. Chunks are appended at Offset until
+// it reaches Size; completing the session moves the file into media
+// storage, after which URL is set.
+type UploadSession struct {
+	ID          string    `json:"id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Offset      int64     `json:"offset"`
+	SHA256      string    `json:"sha256"`
+	Status      string    `json:"status"`
+	URL         string    `json:"url"`
+	StorageKey  string    `json:"storage_key"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type CreateUploadRequest struct {
+	Filename    string `json:"filename" binding:"required"`
+	Size        int64  `json:"size" binding:"required,min=1"`
+	ContentType string `json:"content_type"`
+	// SHA256 is the hex digest of the whole file, checked on completion
+	SHA256 string `json:"sha256"`
+}
@@ -5,13 +5,22 @@ import (
 )
 
 type User struct {
-	ID           string    `json:"id"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	DisplayName  string    `json:"display_name"`
-	Role         string    `json:"role"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           string `json:"id"`
+	OrgID        string `json:"org_id"`
+	Email        string `json:"email"`
+	PasswordHash string `json:"-"`
+	DisplayName  string `json:"display_name"`
+	Role         string `json:"role"`
+	// CompanyName ties an advertiser to the ads of their company
+	CompanyName string   `json:"company_name"`
+	Permissions []string `json:"permissions,omitempty"`
+	// Disabled accounts cannot log in or use existing tokens
+	IsDisabled bool       `json:"is_disabled"`
+	DisabledAt *time.Time `json:"disabled_at"`
+	// TwoFactorEnabled means login also asks for a TOTP or recovery code
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
 }
 
 type LoginRequest struct {
@@ -25,11 +34,76 @@ type RegisterRequest struct {
 	DisplayName string `json:"display_name" binding:"required"`
 }
 
+// TwoFactorChallenge is returned by login instead of an AuthResponse when
+// the account has two-factor authentication enabled.
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	TwoFactorToken    string `json:"two_factor_token"`
+	ExpiresIn         int64  `json:"expires_in"`
+}
+
+// TwoFactorLoginRequest completes a login. Code is either the current TOTP
+// code or one of the recovery codes.
+type TwoFactorLoginRequest struct {
+	TwoFactorToken string `json:"two_factor_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// AuthResponse carries a short-lived access token and the refresh token
+// used to get a new one from /auth/refresh.
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string `json:"token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	User         User   `json:"user"`
 }
 
 type ResetPasswordRequest struct {
 	Email string `json:"email" binding:"required,email"`
 }
+
+type ConfirmResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+type UpdateUserRequest struct {
+	DisplayName *string `json:"display_name"`
+	Role        *string `json:"role" binding:"omitempty,oneof=super_admin admin editor viewer advertiser"`
+	CompanyName *string `json:"company_name"`
+}
+
+// UserInvite is a pending, single-use signup invitation. The token itself
+// is only returned once, when the invite is created.
+type UserInvite struct {
+	ID          string     `json:"id"`
+	OrgID       string     `json:"org_id"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role"`
+	CompanyName string     `json:"company_name"`
+	InvitedBy   *string    `json:"invited_by"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	AcceptedAt  *time.Time `json:"accepted_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type CreateInviteRequest struct {
+	Email       string `json:"email" binding:"required,email"`
+	Role        string `json:"role" binding:"required,oneof=super_admin admin editor viewer advertiser"`
+	CompanyName string `json:"company_name"`
+}
+
+type AcceptInviteRequest struct {
+	Token       string `json:"token" binding:"required"`
+	Password    string `json:"password" binding:"required,min=6"`
+	DisplayName string `json:"display_name" binding:"required"`
+}
@@ -0,0 +1,147 @@
+package presence
+
+import (
+	"log"
+	"time"
+
+	"digital-signage-backend/config"
+	"digital-signage-backend/database"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+)
+
+// Reasons recorded with a status change
+const (
+	ReasonHeartbeat   = "heartbeat"
+	ReasonRegister    = "register"
+	ReasonPairing     = "pairing"
+	ReasonPushChannel = "push_channel"
+	ReasonAdmin       = "admin"
+	ReasonRevoked     = "revoked"
+	ReasonTimeout     = "timeout"
+)
+
+// MarkOnline refreshes last_active and, if the device was offline, flips it
+// online and records the change in device_status_history.
+func MarkOnline(deviceRowID, reason string) error {
+	result, err := database.DB.Exec(`
+		UPDATE devices SET is_online = true, last_active = NOW()
+		WHERE id = ? AND is_online = false
+	`, deviceRowID)
+	if err != nil {
+		return err
+	}
+
+	if changed, _ := result.RowsAffected(); changed > 0 {
+		return recordChange(deviceRowID, StatusOnline, reason, changedNow)
+	}
+
+	_, err = database.DB.Exec("UPDATE devices SET last_active = NOW() WHERE id = ?", deviceRowID)
+	return err
+}
+
+// MarkOffline flips the device offline, recording the change if it was online.
+func MarkOffline(deviceRowID, reason string) error {
+	result, err := database.DB.Exec(`
+		UPDATE devices SET is_online = false
+		WHERE id = ? AND is_online = true
+	`, deviceRowID)
+	if err != nil {
+		return err
+	}
+
+	if changed, _ := result.RowsAffected(); changed > 0 {
+		return recordChange(deviceRowID, StatusOffline, reason, changedNow)
+	}
+	return nil
+}
+
+// Sweep marks offline every online device not seen for longer than
+// threshold. The change is dated at the device's last_active, which is when
+// it actually went silent. It returns how many devices were flipped.
+func Sweep(threshold time.Duration) (int, error) {
+	// The cutoff is computed by the database, which also wrote last_active
+	// with NOW(), so the comparison holds whatever zone either side runs in
+	seconds := int64(threshold / time.Second)
+
+	rows, err := database.DB.Query(`
+		SELECT id FROM devices
+		WHERE is_online = true AND last_active < NOW() - INTERVAL ? SECOND
+	`, seconds)
+	if err != nil {
+		return 0, err
+	}
+
+	stale := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			continue
+		}
+		stale = append(stale, id)
+	}
+	rows.Close()
+
+	flipped := 0
+	for _, id := range stale {
+		// Re-check last_active so a heartbeat that raced the sweep wins
+		result, err := database.DB.Exec(`
+			UPDATE devices SET is_online = false
+			WHERE id = ? AND is_online = true AND last_active < NOW() - INTERVAL ? SECOND
+		`, id, seconds)
+		if err != nil {
+			return flipped, err
+		}
+		if changed, _ := result.RowsAffected(); changed == 0 {
+			continue
+		}
+		if err := recordChange(id, StatusOffline, ReasonTimeout, changedAtLastActive); err != nil {
+			return flipped, err
+		}
+		flipped++
+	}
+	return flipped, nil
+}
+
+// StartSweeper runs Sweep in the background every DeviceSweepIntervalSeconds.
+func StartSweeper(cfg *config.Config) {
+	threshold := time.Duration(cfg.DeviceOfflineThresholdSeconds) * time.Second
+	interval := time.Duration(cfg.DeviceSweepIntervalSeconds) * time.Second
+	if interval <= 0 || threshold <= 0 {
+		log.Println("Device offline sweeper disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := Sweep(threshold); err != nil {
+				log.Printf("Device offline sweep failed: %v", err)
+			} else if n > 0 {
+				log.Printf("Marked %d device(s) offline", n)
+			}
+		}
+	}()
+}
+
+// When a change happened, as an SQL expression over the devices row. Like
+// last_active, changed_at is always written by the database, so the history
+// never mixes its clock with the application's.
+const (
+	changedNow          = "NOW()"
+	changedAtLastActive = "last_active"
+)
+
+func recordChange(deviceRowID, status, reason, changedAt string) error {
+	_, err := database.DB.Exec(`
+		INSERT INTO device_status_history (id, device_id, status, reason, changed_at)
+		SELECT ?, id, ?, ?, `+changedAt+` FROM devices WHERE id = ?
+	`, uuid.New().String(), status, reason, deviceRowID)
+	return err
+}
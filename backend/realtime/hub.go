@@ -0,0 +1,156 @@
+package realtime
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types pushed to devices
+const (
+	EventContentChanged  = "content_changed"
+	EventSettingsChanged = "settings_changed"
+	EventReload          = "reload"
+	EventCommand         = "command"
+)
+
+type Event struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Subscription is one open push channel of a device in organization OrgID.
+// Events is closed when the hub disconnects the device.
+type Subscription struct {
+	DeviceID    string
+	OrgID       string
+	ConnectedAt time.Time
+	Events      chan Event
+}
+
+// Hub fans events out to the push channels of connected devices, keyed by
+// devices.id. A device may hold more than one channel (e.g. after a quick
+// reconnect before the old one has been noticed as closed).
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[*Subscription]struct{}
+}
+
+// Default is the hub shared by the HTTP handlers.
+var Default = NewHub()
+
+func NewHub() *Hub {
+	return &Hub{subscribers: map[string]map[*Subscription]struct{}{}}
+}
+
+func (h *Hub) Subscribe(deviceID, orgID string) *Subscription {
+	sub := &Subscription{
+		DeviceID:    deviceID,
+		OrgID:       orgID,
+		ConnectedAt: time.Now(),
+		Events:      make(chan Event, 16),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[deviceID] == nil {
+		h.subscribers[deviceID] = map[*Subscription]struct{}{}
+	}
+	h.subscribers[deviceID][sub] = struct{}{}
+	return sub
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs, ok := h.subscribers[sub.DeviceID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	close(sub.Events)
+	if len(subs) == 0 {
+		delete(h.subscribers, sub.DeviceID)
+	}
+}
+
+// Disconnect closes every channel of the device, e.g. after its credential
+// has been revoked.
+func (h *Hub) Disconnect(deviceID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers[deviceID] {
+		close(sub.Events)
+	}
+	delete(h.subscribers, deviceID)
+}
+
+// Publish sends ev to every channel of one device. Slow consumers whose
+// buffer is full miss the event; they re-sync on their next fetch anyway.
+func (h *Hub) Publish(deviceID string, ev Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sub := range h.subscribers[deviceID] {
+		select {
+		case sub.Events <- ev:
+		default:
+		}
+	}
+}
+
+// Broadcast sends ev to every connected device.
+func (h *Hub) Broadcast(ev Event) {
+	h.BroadcastOrg("", ev)
+}
+
+// BroadcastOrg sends ev to every connected device of one organization, or
+// of all of them when orgID is empty.
+func (h *Hub) BroadcastOrg(orgID string, ev Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, subs := range h.subscribers {
+		for sub := range subs {
+			if orgID != "" && sub.OrgID != orgID {
+				continue
+			}
+			select {
+			case sub.Events <- ev:
+			default:
+			}
+		}
+	}
+}
+
+// Presence reports whether the device has an open channel and since when.
+func (h *Hub) Presence(deviceID string) (bool, time.Time) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var since time.Time
+	for sub := range h.subscribers[deviceID] {
+		if since.IsZero() || sub.ConnectedAt.Before(since) {
+			since = sub.ConnectedAt
+		}
+	}
+	return !since.IsZero(), since
+}
+
+// Connected returns the connection time of every connected device of one
+// organization, or of all of them when orgID is empty.
+func (h *Hub) Connected(orgID string) map[string]time.Time {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	connected := make(map[string]time.Time, len(h.subscribers))
+	for deviceID, subs := range h.subscribers {
+		for sub := range subs {
+			if orgID != "" && sub.OrgID != orgID {
+				continue
+			}
+			if since, ok := connected[deviceID]; !ok || sub.ConnectedAt.Before(since) {
+				connected[deviceID] = sub.ConnectedAt
+			}
+		}
+	}
+	return connected
+}
@@ -1,9 +1,13 @@
 package routes
 
 import (
+	"log"
+
 	"digital-signage-backend/config"
 	"digital-signage-backend/handlers"
 	"digital-signage-backend/middleware"
+	"digital-signage-backend/models"
+	"digital-signage-backend/storage"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,17 +15,33 @@ import (
 func SetupRouter(cfg *config.Config) *gin.Engine {
 	router := gin.Default()
 
+	// Client IPs come from X-Forwarded-For only when set by a trusted proxy,
+	// so the per-IP login throttle can't be dodged by forging the header
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// Middleware
 	router.Use(middleware.CORS())
 
-	// Static files (uploads)
-	router.Static("/uploads", cfg.UploadPath)
+	// Static files (uploads); other storage drivers serve media themselves
+	if local, ok := storage.Default.(*storage.Local); ok {
+		router.Static(local.BaseURL, local.Dir)
+	}
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(cfg)
 	adHandler := handlers.NewAdHandler(cfg)
 	deviceHandler := handlers.NewDeviceHandler(cfg)
 	analyticsHandler := handlers.NewAnalyticsHandler(cfg)
+	playlistHandler := handlers.NewPlaylistHandler(cfg)
+	deviceGroupHandler := handlers.NewDeviceGroupHandler(cfg)
+	commandHandler := handlers.NewCommandHandler(cfg)
+	userHandler := handlers.NewUserHandler(cfg)
+	apiKeyHandler := handlers.NewAPIKeyHandler(cfg)
+	auditHandler := handlers.NewAuditHandler(cfg)
+	organizationHandler := handlers.NewOrganizationHandler(cfg)
+	mediaHandler := handlers.NewMediaHandler(cfg)
 
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
@@ -36,50 +56,171 @@ func SetupRouter(cfg *config.Config) *gin.Engine {
 		{
 			auth.POST("/register", authHandler.Register)
 			auth.POST("/login", authHandler.Login)
+			auth.POST("/login/2fa", authHandler.LoginTwoFactor)
 			auth.POST("/reset-password", authHandler.ResetPassword)
+			auth.POST("/reset-password/confirm", authHandler.ConfirmResetPassword)
+			auth.POST("/invites/accept", authHandler.AcceptInvite)
 			auth.GET("/me", middleware.AuthMiddleware(cfg), authHandler.GetCurrentUser)
+			auth.POST("/refresh", authHandler.Refresh)
+			auth.POST("/logout", middleware.AuthMiddleware(cfg), authHandler.Logout)
+			auth.POST("/logout-all", middleware.AuthMiddleware(cfg), authHandler.LogoutAll)
+			auth.GET("/sessions", middleware.AuthMiddleware(cfg), authHandler.GetSessions)
+			auth.DELETE("/sessions/:sessionId", middleware.AuthMiddleware(cfg), authHandler.RevokeSession)
+			auth.GET("/2fa", middleware.AuthMiddleware(cfg), authHandler.GetTwoFactor)
+			auth.POST("/2fa/enroll", middleware.AuthMiddleware(cfg), authHandler.EnrollTwoFactor)
+			auth.POST("/2fa/verify", middleware.AuthMiddleware(cfg), authHandler.VerifyTwoFactor)
+			auth.POST("/2fa/disable", middleware.AuthMiddleware(cfg), authHandler.DisableTwoFactor)
+			auth.POST("/2fa/recovery-codes", middleware.AuthMiddleware(cfg), authHandler.RegenerateRecoveryCodes)
 		}
 
 		// Ads routes
 		ads := v1.Group("/ads")
 		{
 			// Non-parameterized routes FIRST
-			ads.GET("", adHandler.GetAds)                                                    // Public
-			ads.POST("", middleware.AuthMiddleware(cfg), adHandler.CreateAd)                 // Protected
-			ads.POST("/upload", middleware.AuthMiddleware(cfg), adHandler.UploadMedia)       // Protected
-			ads.POST("/reorder", middleware.AuthMiddleware(cfg), adHandler.ReorderAds)       // Protected
-			ads.GET("/company/list", adHandler.GetAdsByCompany)                              // Public
-			ads.GET("/company/check-limit", adHandler.CheckCompanyUploadLimit)               // Public
-			
+			ads.GET("", middleware.OptionalAuthMiddleware(cfg), adHandler.GetAds)                                                           // Public (advertisers see own company)
+			ads.POST("", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAdsWrite), adHandler.CreateAd)             // Protected
+			ads.POST("/upload", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAdsWrite), adHandler.UploadMedia)   // Protected
+			ads.POST("/reorder", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAdsReorder), adHandler.ReorderAds) // Protected
+			ads.GET("/company/list", adHandler.GetAdsByCompany)                                                                             // Public
+			ads.GET("/company/check-limit", adHandler.CheckCompanyUploadLimit)                                                              // Public
+			ads.GET("/preview", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAdsRead), adHandler.PreviewAds)     // Protected
+
+			// Resumable uploads
+			ads.POST("/uploads", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAdsWrite), adHandler.CreateUpload)
+			ads.GET("/uploads/:id", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAdsWrite), adHandler.GetUpload)
+			ads.PATCH("/uploads/:id", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAdsWrite), adHandler.AppendUploadChunk)
+			ads.POST("/uploads/:id/complete", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAdsWrite), adHandler.CompleteUpload)
+			ads.DELETE("/uploads/:id", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAdsWrite), adHandler.CancelUpload)
+
 			// Parameterized routes AFTER
-			ads.GET("/:id", adHandler.GetAdByID)                                             // Public
-			ads.POST("/:id/view", adHandler.TrackAdView)                                     // Public
-			ads.PUT("/:id", middleware.AuthMiddleware(cfg), adHandler.UpdateAd)              // Protected
-			ads.DELETE("/:id", middleware.AuthMiddleware(cfg), adHandler.DeleteAd)           // Protected
+			ads.GET("/:id", middleware.OptionalAuthMiddleware(cfg), adHandler.GetAdByID)                                              // Public (advertisers see own company)
+			ads.POST("/:id/view", middleware.DeviceAuthMiddleware(), adHandler.TrackAdView)                                           // Device
+			ads.PUT("/:id", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAdsWrite), adHandler.UpdateAd)    // Protected
+			ads.DELETE("/:id", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAdsWrite), adHandler.DeleteAd) // Protected
+
+			// Review workflow
+			ads.GET("/:id/reviews", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAdsRead), adHandler.GetAdReviews)
+			ads.POST("/:id/submit", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAdsWrite), adHandler.SubmitAd)
+			ads.POST("/:id/review", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAdsReview), adHandler.ReviewAd)
+			ads.POST("/:id/archive", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAdsWrite), adHandler.ArchiveAd)
+			ads.POST("/:id/restore", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAdsWrite), adHandler.RestoreAd)
+		}
+
+		// Media library
+		mediaLibrary := v1.Group("/media", middleware.AuthMiddleware(cfg))
+		{
+			mediaLibrary.GET("", middleware.RequirePermission(models.PermAdsRead), mediaHandler.GetMedia)
+			mediaLibrary.DELETE("/orphans", middleware.RequirePermission(models.PermAdsWrite), mediaHandler.DeleteOrphanedMedia)
+			mediaLibrary.GET("/:id", middleware.RequirePermission(models.PermAdsRead), mediaHandler.GetMediaByID)
+			mediaLibrary.DELETE("/:id", middleware.RequirePermission(models.PermAdsWrite), mediaHandler.DeleteMedia)
 		}
 
 		// Devices routes
 		devices := v1.Group("/devices")
 		{
 			// Non-parameterized routes FIRST
-			devices.POST("/register", deviceHandler.RegisterDevice)                          // Public
-			
+			devices.POST("/register", middleware.DeviceAuthMiddleware(), deviceHandler.RegisterDevice)                                                     // Device
+			devices.POST("/pair", deviceHandler.RequestPairing)                                                                                            // Public
+			devices.POST("/pair/status", deviceHandler.PairingStatus)                                                                                      // Public (pairing secret)
+			devices.POST("/pair/claim", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermDevicesWrite), deviceHandler.ClaimPairing) // Protected
+			devices.GET("/presence", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermDevicesRead), deviceHandler.GetPresence)      // Protected
+
 			// Parameterized routes AFTER
-			devices.GET("", middleware.AuthMiddleware(cfg), deviceHandler.GetDevices)        // Protected
-			devices.GET("/:id", middleware.AuthMiddleware(cfg), deviceHandler.GetDeviceByID) // Protected
-			devices.PUT("/:id", middleware.AuthMiddleware(cfg), deviceHandler.UpdateDevice)  // Protected
-			devices.DELETE("/:id", middleware.AuthMiddleware(cfg), deviceHandler.DeleteDevice) // Protected
-			devices.POST("/:id/heartbeat", deviceHandler.Heartbeat)                          // Public
-			devices.POST("/:id/increment-views", deviceHandler.IncrementViews)               // Public
+			devices.GET("", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermDevicesRead), deviceHandler.GetDevices)                          // Protected
+			devices.GET("/:id", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermDevicesRead), deviceHandler.GetDeviceByID)                   // Protected
+			devices.PUT("/:id", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermDevicesWrite), deviceHandler.UpdateDevice)                   // Protected
+			devices.DELETE("/:id", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermDevicesWrite), deviceHandler.DeleteDevice)                // Protected
+			devices.POST("/:id/revoke", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermDevicesWrite), deviceHandler.RevokeDeviceCredential) // Protected
+			devices.POST("/:id/reload", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermDevicesCommand), deviceHandler.ReloadDevice)         // Protected
+			devices.GET("/:id/status-history", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermDevicesRead), deviceHandler.GetStatusHistory) // Protected
+			devices.GET("/:id/views-history", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermDevicesRead), deviceHandler.GetViewsHistory)   // Protected
+			devices.GET("/:id/commands", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermDevicesRead), commandHandler.GetCommands)           // Protected
+			devices.POST("/:id/commands", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermDevicesCommand), commandHandler.CreateCommand)     // Protected
+			devices.POST("/:id/heartbeat", middleware.DeviceAuthMiddleware(), deviceHandler.Heartbeat)                                                               // Device
+			devices.POST("/:id/increment-views", middleware.DeviceAuthMiddleware(), deviceHandler.IncrementViews)                                                    // Device
+			devices.GET("/:id/playlist", middleware.DeviceAuthMiddleware(), playlistHandler.GetDevicePlaylist)                                                       // Device
+			devices.GET("/:id/manifest", middleware.DeviceAuthMiddleware(), deviceHandler.GetManifest)                                                               // Device
+			devices.GET("/:id/events", middleware.DeviceAuthMiddleware(), deviceHandler.StreamEvents)                                                                // Device (SSE)
+			devices.POST("/:id/commands/:commandId/result", middleware.DeviceAuthMiddleware(), commandHandler.ReportCommandResult)                                   // Device
+		}
+
+		// User routes (protected)
+		users := v1.Group("/users", middleware.AuthMiddleware(cfg))
+		{
+			users.GET("", middleware.RequirePermission(models.PermUsersRead), userHandler.GetUsers)
+			users.GET("/roles", middleware.RequirePermission(models.PermUsersRead), userHandler.GetRoles)
+			users.GET("/invites", middleware.RequirePermission(models.PermUsersRead), userHandler.GetInvites)
+			users.POST("/invites", middleware.RequirePermission(models.PermUsersWrite), userHandler.CreateInvite)
+			users.DELETE("/invites/:inviteId", middleware.RequirePermission(models.PermUsersWrite), userHandler.RevokeInvite)
+			users.GET("/:id", middleware.RequirePermission(models.PermUsersRead), userHandler.GetUserByID)
+			users.PUT("/:id", middleware.RequirePermission(models.PermUsersWrite), userHandler.UpdateUser)
+			users.DELETE("/:id", middleware.RequirePermission(models.PermUsersWrite), userHandler.DeleteUser)
+			users.GET("/:id/sessions", middleware.RequirePermission(models.PermUsersRead), userHandler.GetUserSessions)
+			users.PUT("/:id/role", middleware.RequirePermission(models.PermUsersWrite), userHandler.UpdateUserRole)
+			users.POST("/:id/disable", middleware.RequirePermission(models.PermUsersWrite), userHandler.DisableUser)
+			users.POST("/:id/enable", middleware.RequirePermission(models.PermUsersWrite), userHandler.EnableUser)
+			users.DELETE("/:id/2fa", middleware.RequirePermission(models.PermUsersWrite), userHandler.ResetTwoFactor)
+			users.POST("/:id/unlock", middleware.RequirePermission(models.PermUsersWrite), userHandler.UnlockUser)
+		}
+
+		// API key routes (protected)
+		apiKeys := v1.Group("/api-keys", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAPIKeysManage))
+		{
+			apiKeys.GET("", apiKeyHandler.GetAPIKeys)
+			apiKeys.POST("", apiKeyHandler.CreateAPIKey)
+			apiKeys.DELETE("/:id", apiKeyHandler.RevokeAPIKey)
+		}
+
+		// Audit log routes (protected)
+		auditLog := v1.Group("/audit-log", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAuditRead))
+		{
+			auditLog.GET("", auditHandler.GetAuditLog)
+			auditLog.GET("/export", auditHandler.ExportAuditLog)
+		}
+
+		// Organization routes (super admin only)
+		organizations := v1.Group("/organizations", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermOrganizationsManage))
+		{
+			organizations.GET("", organizationHandler.GetOrganizations)
+			organizations.POST("", organizationHandler.CreateOrganization)
+			organizations.GET("/:id", organizationHandler.GetOrganizationByID)
+			organizations.PUT("/:id", organizationHandler.UpdateOrganization)
+			organizations.DELETE("/:id", organizationHandler.DeleteOrganization)
+		}
+
+		// Playlists routes (protected)
+		playlists := v1.Group("/playlists", middleware.AuthMiddleware(cfg))
+		{
+			playlists.GET("", middleware.RequirePermission(models.PermPlaylistsRead), playlistHandler.GetPlaylists)
+			playlists.POST("", middleware.RequirePermission(models.PermPlaylistsWrite), playlistHandler.CreatePlaylist)
+			playlists.GET("/:id", middleware.RequirePermission(models.PermPlaylistsRead), playlistHandler.GetPlaylistByID)
+			playlists.PUT("/:id", middleware.RequirePermission(models.PermPlaylistsWrite), playlistHandler.UpdatePlaylist)
+			playlists.DELETE("/:id", middleware.RequirePermission(models.PermPlaylistsWrite), playlistHandler.DeletePlaylist)
+			playlists.PUT("/:id/items", middleware.RequirePermission(models.PermPlaylistsWrite), playlistHandler.SetPlaylistItems)
+			playlists.POST("/:id/assignments", middleware.RequirePermission(models.PermPlaylistsWrite), playlistHandler.AssignPlaylist)
+			playlists.DELETE("/:id/assignments/:assignmentId", middleware.RequirePermission(models.PermPlaylistsWrite), playlistHandler.UnassignPlaylist)
+		}
+
+		// Device group routes (all protected)
+		deviceGroups := v1.Group("/device-groups", middleware.AuthMiddleware(cfg))
+		{
+			deviceGroups.GET("", middleware.RequirePermission(models.PermDevicesRead), deviceGroupHandler.GetGroups)
+			deviceGroups.POST("", middleware.RequirePermission(models.PermDevicesWrite), deviceGroupHandler.CreateGroup)
+			deviceGroups.GET("/:id", middleware.RequirePermission(models.PermDevicesRead), deviceGroupHandler.GetGroupByID)
+			deviceGroups.PUT("/:id", middleware.RequirePermission(models.PermDevicesWrite), deviceGroupHandler.UpdateGroup)
+			deviceGroups.DELETE("/:id", middleware.RequirePermission(models.PermDevicesWrite), deviceGroupHandler.DeleteGroup)
+			deviceGroups.PUT("/:id/devices", middleware.RequirePermission(models.PermDevicesWrite), deviceGroupHandler.SetGroupDevices)
 		}
 
 		// Analytics routes
 		analytics := v1.Group("/analytics")
 		{
-			analytics.POST("/impressions", analyticsHandler.CreateImpression)                          // Public - for tracking
-			analytics.GET("", middleware.AuthMiddleware(cfg), analyticsHandler.GetAnalytics)           // Protected
-			analytics.GET("/dashboard", middleware.AuthMiddleware(cfg), analyticsHandler.GetDashboardStats) // Protected
-			analytics.GET("/ads/:id/performance", middleware.AuthMiddleware(cfg), analyticsHandler.GetAdPerformance) // Protected
+			analytics.POST("/impressions", middleware.DeviceAuthMiddleware(), analyticsHandler.CreateImpression)                                                             // Device - for tracking
+			analytics.GET("", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAnalyticsRead), analyticsHandler.GetAnalytics)                         // Protected
+			analytics.GET("/dashboard", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAnalyticsRead), analyticsHandler.GetDashboardStats)          // Protected
+			analytics.GET("/ads/:id/performance", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAnalyticsRead), analyticsHandler.GetAdPerformance) // Protected
+			analytics.GET("/uptime/devices", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAnalyticsRead), analyticsHandler.GetDeviceUptime)       // Protected
+			analytics.GET("/uptime/locations", middleware.AuthMiddleware(cfg), middleware.RequirePermission(models.PermAnalyticsRead), analyticsHandler.GetLocationUptime)   // Protected
 		}
 	}
 
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Local keeps objects as files below Dir, served by the router under
+// BaseURL.
+type Local struct {
+	Dir     string
+	BaseURL string
+}
+
+func (s *Local) init() error {
+	return os.MkdirAll(s.Dir, 0755)
+}
+
+// Put writes to a temporary file first so a failed upload never leaves a
+// partial file under key.
+func (s *Local) Put(key string, r io.Reader, size int64, contentType string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+func (s *Local) Get(key string) (io.ReadCloser, Object, error) {
+	obj, err := s.Stat(key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	target, _ := s.path(key)
+	f, err := os.Open(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, Object{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Object{}, err
+	}
+	return f, obj, nil
+}
+
+func (s *Local) Stat(key string) (Object, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return Object{}, err
+	}
+	info, err := os.Stat(target)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && info.IsDir()) {
+		return Object{}, ErrNotFound
+	}
+	if err != nil {
+		return Object{}, err
+	}
+	key, _ = CleanKey(key)
+	return Object{
+		Key:         key,
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		ModTime:     info.ModTime(),
+	}, nil
+}
+
+func (s *Local) Delete(key string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *Local) URL(key string) string {
+	return strings.TrimSuffix(s.BaseURL, "/") + "/" + strings.TrimPrefix(key, "/")
+}
+
+func (s *Local) KeyForURL(url string) (string, bool) {
+	prefix := strings.TrimSuffix(s.BaseURL, "/") + "/"
+	if !strings.HasPrefix(url, prefix) {
+		return "", false
+	}
+	key, err := CleanKey(strings.TrimPrefix(url, prefix))
+	if err != nil {
+		return "", false
+	}
+	return key, true
+}
+
+func (s *Local) path(key string) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	s := &Local{Dir: dir, BaseURL: "/uploads/"}
+	key := "ads/2024/banner.png"
+
+	if err := s.Put(key, strings.NewReader("png bytes"), 9, "image/png"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, "ads", "2024"))
+	if len(entries) != 1 || entries[0].Name() != "banner.png" {
+		t.Errorf("files after Put = %v, want only banner.png", entries)
+	}
+
+	obj, err := s.Stat(key)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if obj.Key != key || obj.Size != 9 || obj.ContentType != "image/png" || obj.ModTime.IsZero() {
+		t.Errorf("Stat = %+v", obj)
+	}
+
+	body, _, err := s.Get("/" + key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "png bytes" {
+		t.Errorf("Get = %q, want png bytes", data)
+	}
+
+	if err := s.Put(key, strings.NewReader("replaced"), 8, "image/png"); err != nil {
+		t.Fatalf("Put over an existing key: %v", err)
+	}
+	if obj, _ := s.Stat(key); obj.Size != 8 {
+		t.Errorf("size after overwrite = %d, want 8", obj.Size)
+	}
+
+	url := s.URL(key)
+	if url != "/uploads/ads/2024/banner.png" {
+		t.Errorf("URL = %q", url)
+	}
+	if got, ok := s.KeyForURL(url); !ok || got != key {
+		t.Errorf("KeyForURL(%q) = %q, %v", url, got, ok)
+	}
+
+	if err := s.Delete(key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Stat(key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat after Delete = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(key); err != nil {
+		t.Errorf("second Delete = %v, want nil", err)
+	}
+}
+
+func TestLocalMissingAndInvalidKeys(t *testing.T) {
+	s := &Local{Dir: t.TempDir(), BaseURL: "/uploads"}
+
+	if _, _, err := s.Get("missing.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing file = %v, want ErrNotFound", err)
+	}
+	if err := os.Mkdir(filepath.Join(s.Dir, "ads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Stat("ads"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat of a directory = %v, want ErrNotFound", err)
+	}
+
+	for _, key := range []string{"", "../escape.jpg", "ads/../../escape.jpg", "ads//a.jpg"} {
+		if err := s.Put(key, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+	}
+	for _, url := range []string{"/other/a.jpg", "/uploads/../a.jpg", "/uploads/"} {
+		if key, ok := s.KeyForURL(url); ok {
+			t.Errorf("KeyForURL(%q) = %q, want no key", url, key)
+		}
+	}
+}
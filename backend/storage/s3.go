@@ -0,0 +1,277 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config configures an S3-compatible bucket. PathStyle addresses the
+// bucket as endpoint/bucket rather than bucket.endpoint, which is what
+// MinIO and most other stand-ins expect.
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	PathStyle       bool
+	// PublicURL is the address objects are downloaded from, e.g. a CDN in
+	// front of the bucket. Defaults to the bucket itself, which then has to
+	// allow anonymous reads.
+	PublicURL string
+}
+
+// S3 keeps objects in an S3-compatible bucket. Requests are signed with
+// AWS Signature Version 4.
+type S3 struct {
+	cfg       S3Config
+	bucketURL *url.URL
+	publicURL string
+	client    *http.Client
+}
+
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required for the s3 storage driver")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, fmt.Errorf("S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required for the s3 storage driver")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT %q", cfg.Endpoint)
+	}
+	bucketURL := *endpoint
+	if cfg.PathStyle {
+		bucketURL.Path = endpoint.Path + "/" + cfg.Bucket
+	} else {
+		bucketURL.Host = cfg.Bucket + "." + endpoint.Host
+	}
+
+	publicURL := strings.TrimSuffix(cfg.PublicURL, "/")
+	if publicURL == "" {
+		publicURL = bucketURL.String()
+	}
+
+	return &S3{
+		cfg:       cfg,
+		bucketURL: &bucketURL,
+		publicURL: publicURL,
+		client:    &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// Put streams r to the bucket. The payload is sent unsigned so it doesn't
+// have to be buffered to be hashed; the request itself is still signed. S3
+// needs to know the size up front.
+func (s *S3) Put(key string, r io.Reader, size int64, contentType string) error {
+	if size < 0 {
+		return fmt.Errorf("storage: s3 needs the size of %s", key)
+	}
+	if size == 0 {
+		r = http.NoBody
+	}
+	req, err := s.request(http.MethodPut, key, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) Get(key string) (io.ReadCloser, Object, error) {
+	req, err := s.request(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	return resp.Body, objectFromHeader(key, resp), nil
+}
+
+func (s *S3) Stat(key string) (Object, error) {
+	req, err := s.request(http.MethodHead, key, nil)
+	if err != nil {
+		return Object{}, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return Object{}, err
+	}
+	resp.Body.Close()
+	return objectFromHeader(key, resp), nil
+}
+
+func (s *S3) Delete(key string) error {
+	req, err := s.request(http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) URL(key string) string {
+	return s.publicURL + "/" + escapeKey(strings.TrimPrefix(key, "/"))
+}
+
+func (s *S3) KeyForURL(rawURL string) (string, bool) {
+	prefix := s.publicURL + "/"
+	if !strings.HasPrefix(rawURL, prefix) {
+		return "", false
+	}
+	unescaped, err := url.PathUnescape(strings.TrimPrefix(rawURL, prefix))
+	if err != nil {
+		return "", false
+	}
+	key, err := CleanKey(unescaped)
+	if err != nil {
+		return "", false
+	}
+	return key, true
+}
+
+// request builds an unsigned request for the object stored under key.
+func (s *S3) request(method, key string, body io.Reader) (*http.Request, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	u := *s.bucketURL
+	u.Path = s.bucketURL.Path + "/" + key
+	u.RawPath = escapeKey(u.Path)
+	return http.NewRequest(method, u.String(), body)
+}
+
+// do signs and sends req. Error responses are turned into errors, with 404
+// reported as ErrNotFound.
+func (s *S3) do(req *http.Request) (*http.Response, error) {
+	s.sign(req, time.Now())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, fmt.Errorf("storage: s3 %s %s: %s %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(message)))
+}
+
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// sign adds an AWS Signature Version 4 Authorization header to req.
+func (s *S3) sign(req *http.Request, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + unsignedPayload,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	scope := day + "/" + s.cfg.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hexSHA256(canonicalRequest),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), day)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func objectFromHeader(key string, resp *http.Response) Object {
+	key, _ = CleanKey(key)
+	obj := Object{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	if size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil {
+		obj.Size = size
+	}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		obj.ModTime = modTime
+	}
+	return obj
+}
+
+// escapeKey percent-encodes a path the way Signature Version 4 expects:
+// everything except unreserved characters and the slashes between segments.
+func escapeKey(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		ch := p[i]
+		if ch == '/' || ch == '-' || ch == '_' || ch == '.' || ch == '~' ||
+			('A' <= ch && ch <= 'Z') || ('a' <= ch && ch <= 'z') || ('0' <= ch && ch <= '9') {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func hexSHA256(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
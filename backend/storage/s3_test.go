@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	testAccessKey = "minioadmin"
+	testSecretKey = "minio-secret"
+	testRegion    = "us-east-1"
+)
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+}
+
+// fakeMinIO is a path-style S3 stand-in for one bucket. It checks every
+// request's Signature Version 4 with its own implementation and answers
+// like MinIO: 403 for bad signatures, 404 for missing objects.
+type fakeMinIO struct {
+	t      *testing.T
+	bucket string
+
+	mu       sync.Mutex
+	objects  map[string]fakeObject
+	requests []string
+	// failWith, when set, is the status of every response
+	failWith int
+}
+
+var authPattern = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=([^/]+)/(\d{8})/([^/]+)/s3/aws4_request, SignedHeaders=([^,]+), Signature=([0-9a-f]{64})$`)
+
+func (f *fakeMinIO) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+
+	if f.failWith != 0 {
+		http.Error(w, "<Error><Code>InternalError</Code></Error>", f.failWith)
+		return
+	}
+	if !f.validSignature(r) {
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>", http.StatusForbidden)
+		return
+	}
+
+	prefix := "/" + f.bucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code></Error>", http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+
+	switch r.Method {
+	case http.MethodPut:
+		if r.ContentLength < 0 {
+			http.Error(w, "<Error><Code>MissingContentLength</Code></Error>", http.StatusLengthRequired)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = fakeObject{data: data, contentType: r.Header.Get("Content-Type")}
+	case http.MethodGet, http.MethodHead:
+		obj, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Header().Set("Last-Modified", "Sat, 01 Jun 2024 12:00:00 GMT")
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+			return
+		}
+		w.Write(obj.data)
+	case http.MethodDelete:
+		if _, ok := f.objects[key]; !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeMinIO) validSignature(r *http.Request) bool {
+	m := authPattern.FindStringSubmatch(r.Header.Get("Authorization"))
+	if m == nil {
+		f.t.Errorf("%s %s: malformed Authorization %q", r.Method, r.URL.Path, r.Header.Get("Authorization"))
+		return false
+	}
+	accessKey, day, region, signedHeaders, signature := m[1], m[2], m[3], m[4], m[5]
+	amzDate := r.Header.Get("X-Amz-Date")
+	if accessKey != testAccessKey || region != testRegion || !strings.HasPrefix(amzDate, day) {
+		return false
+	}
+
+	canonicalHeaders := ""
+	for _, name := range strings.Split(signedHeaders, ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders += name + ":" + strings.TrimSpace(value) + "\n"
+	}
+	// The path exactly as sent, before the server unescapes it
+	path, query, _ := strings.Cut(r.RequestURI, "?")
+	canonical := strings.Join([]string{
+		r.Method, path, query, canonicalHeaders, signedHeaders, r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	sum := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + day + "/" + region + "/s3/aws4_request\n" + hex.EncodeToString(sum[:])
+
+	key := []byte("AWS4" + testSecretKey)
+	for _, part := range []string{day, region, "s3", "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	return hmac.Equal([]byte(hex.EncodeToString(key)), []byte(signature))
+}
+
+func newTestS3(t *testing.T, secret string) (*S3, *fakeMinIO) {
+	t.Helper()
+	fake := &fakeMinIO{t: t, bucket: "media", objects: map[string]fakeObject{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	s3, err := NewS3(S3Config{
+		Endpoint:        server.URL,
+		Region:          testRegion,
+		Bucket:          "media",
+		AccessKeyID:     testAccessKey,
+		SecretAccessKey: secret,
+		PathStyle:       true,
+		PublicURL:       "https://cdn.example.com/media",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s3, fake
+}
+
+func TestS3RoundTrip(t *testing.T) {
+	s3, fake := newTestS3(t, testSecretKey)
+	key := "ads/summer sale+1.jpg"
+
+	if err := s3.Put(key, strings.NewReader("jpeg bytes"), 10, "image/jpeg"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if obj := fake.objects[key]; string(obj.data) != "jpeg bytes" || obj.contentType != "image/jpeg" {
+		t.Errorf("stored %q (%s), want the uploaded bytes as image/jpeg", obj.data, obj.contentType)
+	}
+
+	obj, err := s3.Stat(key)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if obj.Key != key || obj.Size != 10 || obj.ContentType != "image/jpeg" || obj.ModTime.IsZero() {
+		t.Errorf("Stat = %+v", obj)
+	}
+
+	body, obj, err := s3.Get(key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "jpeg bytes" || obj.Size != 10 {
+		t.Errorf("Get = %q, %+v", data, obj)
+	}
+
+	if err := s3.Put("empty.txt", strings.NewReader(""), 0, ""); err != nil {
+		t.Fatalf("Put of an empty object: %v", err)
+	}
+
+	if err := s3.Delete(key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok := fake.objects[key]; ok {
+		t.Error("object still stored after Delete")
+	}
+
+	want := []string{
+		"PUT /media/ads/summer sale+1.jpg",
+		"HEAD /media/ads/summer sale+1.jpg",
+		"GET /media/ads/summer sale+1.jpg",
+		"PUT /media/empty.txt",
+		"DELETE /media/ads/summer sale+1.jpg",
+	}
+	if strings.Join(fake.requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests:\n%s\nwant:\n%s", strings.Join(fake.requests, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestS3Errors(t *testing.T) {
+	s3, fake := newTestS3(t, testSecretKey)
+
+	if _, _, err := s3.Get("missing.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing object = %v, want ErrNotFound", err)
+	}
+	if _, err := s3.Stat("missing.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat of a missing object = %v, want ErrNotFound", err)
+	}
+	if err := s3.Delete("missing.jpg"); err != nil {
+		t.Errorf("Delete of a missing object = %v, want nil", err)
+	}
+	if err := s3.Put("x.jpg", strings.NewReader("x"), -1, ""); err == nil {
+		t.Error("Put without a size succeeded")
+	}
+	if err := s3.Put("../x.jpg", strings.NewReader("x"), 1, ""); err == nil {
+		t.Error("Put of a key outside the bucket succeeded")
+	}
+
+	fake.failWith = http.StatusInternalServerError
+	err := s3.Put("x.jpg", strings.NewReader("x"), 1, "")
+	if err == nil || errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "500") || !strings.Contains(err.Error(), "InternalError") {
+		t.Errorf("Put against a failing server = %v, want the status and message", err)
+	}
+}
+
+func TestS3BadCredentials(t *testing.T) {
+	s3, _ := newTestS3(t, "wrong-secret")
+
+	err := s3.Put("x.jpg", strings.NewReader("x"), 1, "")
+	if err == nil || !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("Put with a wrong secret = %v, want a 403 error", err)
+	}
+	if _, _, err := s3.Get("x.jpg"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get with a wrong secret = %v, want a 403 error", err)
+	}
+}
+
+func TestS3URLs(t *testing.T) {
+	s3, _ := newTestS3(t, testSecretKey)
+
+	url := s3.URL("ads/summer sale.jpg")
+	if url != "https://cdn.example.com/media/ads/summer%20sale.jpg" {
+		t.Errorf("URL = %q", url)
+	}
+	if key, ok := s3.KeyForURL(url); !ok || key != "ads/summer sale.jpg" {
+		t.Errorf("KeyForURL(%q) = %q, %v", url, key, ok)
+	}
+	for _, other := range []string{"https://example.com/ads/a.jpg", "https://cdn.example.com/media/../a.jpg"} {
+		if key, ok := s3.KeyForURL(other); ok {
+			t.Errorf("KeyForURL(%q) = %q, want no key", other, key)
+		}
+	}
+}
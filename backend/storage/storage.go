@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"digital-signage-backend/config"
+)
+
+// ErrNotFound is returned when an object doesn't exist.
+var ErrNotFound = errors.New("storage: object not found")
+
+// Object describes a stored file.
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Storage keeps uploaded media. Keys are slash separated paths such as
+// "3f2a....jpg"; URL turns a key into the address players download it from
+// and KeyForURL maps such an address back. Implementations must be safe for
+// concurrent use.
+type Storage interface {
+	// Put stores size bytes read from r under key, replacing any existing
+	// object. size may be -1 when unknown.
+	Put(key string, r io.Reader, size int64, contentType string) error
+	Get(key string) (io.ReadCloser, Object, error)
+	Stat(key string) (Object, error)
+	// Delete removes the object. Deleting a missing object is not an error.
+	Delete(key string) error
+	URL(key string) string
+	// KeyForURL returns the key of a URL returned by URL, and false for
+	// URLs this storage didn't produce, such as external links.
+	KeyForURL(url string) (string, bool)
+}
+
+// Default is the storage shared by the HTTP handlers. It writes to
+// ./uploads until Initialize replaces it with the configured driver.
+var Default Storage = &Local{Dir: "./uploads", BaseURL: "/uploads"}
+
+// Initialize sets Default from STORAGE_DRIVER: "local" or "s3".
+func Initialize(cfg *config.Config) error {
+	switch cfg.StorageDriver {
+	case "local", "":
+		local := &Local{Dir: cfg.UploadPath, BaseURL: "/uploads"}
+		if err := local.init(); err != nil {
+			return err
+		}
+		Default = local
+	case "s3":
+		s3, err := NewS3(S3Config{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			PathStyle:       cfg.S3PathStyle,
+			PublicURL:       cfg.S3PublicURL,
+		})
+		if err != nil {
+			return err
+		}
+		Default = s3
+	default:
+		return fmt.Errorf("unknown STORAGE_DRIVER %q", cfg.StorageDriver)
+	}
+	log.Printf("Storage driver: %s", driverName(cfg.StorageDriver))
+	return nil
+}
+
+func driverName(driver string) string {
+	if driver == "" {
+		return "local"
+	}
+	return driver
+}
+
+// CleanKey normalizes key and rejects keys that are empty or would escape
+// the storage root.
+func CleanKey(key string) (string, error) {
+	cleaned := strings.TrimPrefix(path.Clean("/"+key), "/")
+	if cleaned == "" || cleaned != strings.TrimPrefix(key, "/") {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,101 @@
+package uploadsession
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"digital-signage-backend/config"
+	"digital-signage-backend/database"
+)
+
+const stagingSuffix = ".part"
+
+// StagingPath is the file the chunks of upload session id are appended to.
+func StagingPath(dir, id string) string {
+	return filepath.Join(dir, id+stagingSuffix)
+}
+
+// Cleanup deletes expired upload sessions with their staged chunks, and
+// staged files older than ttl that no session refers to anymore. It returns
+// how many sessions were deleted.
+func Cleanup(dir string, ttl time.Duration, now time.Time) (int, error) {
+	rows, err := database.DB.Query("SELECT id FROM upload_sessions WHERE expires_at < ?", now)
+	if err != nil {
+		return 0, err
+	}
+	expired := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			expired = append(expired, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, id := range expired {
+		if err := os.Remove(StagingPath(dir, id)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove staged upload %s: %v", id, err)
+			continue
+		}
+		if _, err := database.DB.Exec("DELETE FROM upload_sessions WHERE id = ?", id); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	// Left behind when a session row was removed some other way
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return deleted, nil
+		}
+		return deleted, err
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), stagingSuffix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || now.Sub(info.ModTime()) < ttl {
+			continue
+		}
+		var exists bool
+		if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM upload_sessions WHERE id = ?)", id).Scan(&exists); err != nil || exists {
+			continue
+		}
+		os.Remove(filepath.Join(dir, entry.Name()))
+	}
+
+	return deleted, nil
+}
+
+// StartCleaner runs Cleanup every UPLOAD_CLEANUP_INTERVAL seconds in the
+// background.
+func StartCleaner(cfg *config.Config) {
+	ttl := time.Duration(cfg.UploadSessionTTLHours) * time.Hour
+	interval := time.Duration(cfg.UploadCleanupIntervalSeconds) * time.Second
+	if interval <= 0 || ttl <= 0 {
+		log.Println("Upload session cleanup disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := Cleanup(cfg.UploadSessionPath, ttl, time.Now()); err != nil {
+				log.Printf("Upload session cleanup failed: %v", err)
+			} else if n > 0 {
+				log.Printf("Removed %d expired upload session(s)", n)
+			}
+		}
+	}()
+}
@@ -0,0 +1,85 @@
+package uploadsession
+
+import (
+	"database/sql/driver"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"digital-signage-backend/database/dbtest"
+)
+
+func TestCleanup(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	ttl := 24 * time.Hour
+
+	files := map[string]time.Time{
+		"expired.part": now,                   // session past expires_at
+		"orphan.part":  now.Add(-2 * ttl),     // no session, old
+		"active.part":  now.Add(-2 * ttl),     // session still exists
+		"recent.part":  now.Add(-time.Minute), // no session yet, too new
+		"notes.txt":    now.Add(-2 * ttl),     // not a staged upload
+	}
+	for name, modTime := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := dbtest.Use(t, func(query string, args []driver.Value) dbtest.Result {
+		switch {
+		case strings.HasPrefix(query, "SELECT id FROM upload_sessions WHERE expires_at <"):
+			return dbtest.Result{Columns: []string{"id"}, Rows: [][]driver.Value{{"expired"}}}
+		case strings.HasPrefix(query, "DELETE FROM upload_sessions"):
+			return dbtest.Result{RowsAffected: 1}
+		case strings.HasPrefix(query, "SELECT EXISTS"):
+			return dbtest.Result{Columns: []string{"exists"}, Rows: [][]driver.Value{{args[0] == "active"}}}
+		}
+		t.Fatalf("unexpected query %q", query)
+		return dbtest.Result{}
+	})
+
+	deleted, err := Cleanup(dir, ttl, now)
+	if err != nil {
+		t.Fatalf("Cleanup: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("deleted = %d, want 1", deleted)
+	}
+
+	deletes := db.Statements("DELETE FROM upload_sessions")
+	if len(deletes) != 1 || deletes[0].Args[0] != "expired" {
+		t.Errorf("session deletes = %v, want one for expired", deletes)
+	}
+
+	for name, wantKept := range map[string]bool{
+		"expired.part": false,
+		"orphan.part":  false,
+		"active.part":  true,
+		"recent.part":  true,
+		"notes.txt":    true,
+	} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if kept := err == nil; kept != wantKept {
+			t.Errorf("%s kept = %v, want %v", name, kept, wantKept)
+		}
+	}
+}
+
+func TestCleanupMissingDir(t *testing.T) {
+	dbtest.Use(t, func(query string, args []driver.Value) dbtest.Result {
+		return dbtest.Result{Columns: []string{"id"}}
+	})
+
+	deleted, err := Cleanup(filepath.Join(t.TempDir(), "missing"), time.Hour, time.Now())
+	if err != nil || deleted != 0 {
+		t.Errorf("Cleanup = %d, %v; want 0, nil", deleted, err)
+	}
+}
@@ -11,16 +11,47 @@ type Claims struct {
 	UserID string `json:"user_id"`
 	Email  string `json:"email"`
 	Role   string `json:"role"`
+	// OrgID is the organization the user belongs to
+	OrgID string `json:"org_id"`
+	// SessionID ties the token to a user_sessions row so it can be revoked
+	SessionID string `json:"sid"`
+	// Purpose is empty for access tokens. Tokens with a purpose are only
+	// good for that one step and are refused everywhere else
+	Purpose string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID, email, role, secret string) (string, error) {
+// PurposeTwoFactor marks the token handed out after a correct password when
+// the account still has to pass its second factor.
+const PurposeTwoFactor = "2fa"
+
+// GenerateToken issues a short-lived access token for a session.
+func GenerateToken(userID, email, role, orgID, sessionID, secret string, ttl time.Duration) (string, error) {
+	claims := Claims{
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		OrgID:     orgID,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+// GenerateTwoFactorToken issues the pending-2FA token that is traded for a
+// session once the second factor checks out.
+func GenerateTwoFactorToken(userID, email, secret string, ttl time.Duration) (string, error) {
 	claims := Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
+		UserID:  userID,
+		Email:   email,
+		Purpose: PurposeTwoFactor,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour * 7)), // 7 days
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
@@ -32,7 +63,7 @@ func GenerateToken(userID, email, role, secret string) (string, error) {
 func ValidateToken(tokenString, secret string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(secret), nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
 	if err != nil {
 		return nil, err
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+)
+
+// GenerateSecureToken returns prefix followed by n random bytes in hex.
+func GenerateSecureToken(prefix string, n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// HashToken returns the SHA-256 hex digest used to store high-entropy
+// tokens. Unlike passwords these don't need a slow hash.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// codeAlphabet leaves out characters that are easy to misread on a screen
+// (0/O, 1/I/L).
+const codeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// GenerateCode returns a random human-friendly code of the given length.
+func GenerateCode(length int) (string, error) {
+	code := make([]byte, length)
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = codeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors.
+const rfc6238Secret = "12345678901234567890"
+
+func TestTOTPCodeRFC6238Vectors(t *testing.T) {
+	// RFC 6238 appendix B lists 8-digit codes; with 6 digits the code is
+	// the same value modulo 10^6, i.e. its last 6 digits
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	key := []byte(rfc6238Secret)
+	secret := totpEncoding.EncodeToString(key)
+	for _, v := range vectors {
+		want := v.code[len(v.code)-totpDigits:]
+		if got := totpCode(key, v.unix/totpPeriod); got != want {
+			t.Errorf("code at %d = %s, want %s", v.unix, got, want)
+		}
+		if step, ok := ValidateTOTP(secret, want, time.Unix(v.unix, 0)); !ok || step != v.unix/totpPeriod {
+			t.Errorf("ValidateTOTP at %d = %d, %v, want step %d", v.unix, step, ok, v.unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	key := []byte(rfc6238Secret)
+	secret := totpEncoding.EncodeToString(key)
+	// 1111111111 is step 37037037, 1 second into it
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name   string
+		offset int64
+		ok     bool
+	}{
+		{"current step", 0, true},
+		{"one step behind", -1, true},
+		{"one step ahead", 1, true},
+		{"two steps behind", -2, false},
+		{"two steps ahead", 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := totpCode(key, step+tt.offset)
+			got, ok := ValidateTOTP(secret, code, now)
+			if ok != tt.ok {
+				t.Fatalf("ValidateTOTP = %v, want %v", ok, tt.ok)
+			}
+			if ok && got != step+tt.offset {
+				t.Errorf("matched step %d, want %d", got, step+tt.offset)
+			}
+		})
+	}
+
+	// The window moves at step boundaries, not with the second: the code
+	// of step-1 is accepted until the last second of step+1
+	previous := totpCode(key, step-1)
+	lastSecond := time.Unix((step+2)*totpPeriod-1, 0)
+	if _, ok := ValidateTOTP(secret, previous, lastSecond); ok {
+		t.Error("code two steps old accepted in the last second of its window")
+	}
+	if _, ok := ValidateTOTP(secret, previous, time.Unix((step+1)*totpPeriod-1, 0)); !ok {
+		t.Error("code one step old rejected in the last second of the current step")
+	}
+}
+
+func TestValidateTOTPInput(t *testing.T) {
+	key := []byte(rfc6238Secret)
+	secret := totpEncoding.EncodeToString(key)
+	now := time.Unix(1234567890, 0)
+	code := totpCode(key, now.Unix()/totpPeriod)
+
+	if _, ok := ValidateTOTP(strings.ToLower(secret), " "+code+"\n", now); !ok {
+		t.Error("code with surrounding whitespace and a lower-case secret rejected")
+	}
+	for _, bad := range []string{"", code[:totpDigits-1], code + "0", "abcdef"} {
+		if _, ok := ValidateTOTP(secret, bad, now); ok {
+			t.Errorf("code %q accepted", bad)
+		}
+	}
+	if _, ok := ValidateTOTP("not base32!", code, now); ok {
+		t.Error("code accepted for an invalid secret")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("secret %q decodes to %d bytes (%v), want 20", secret, len(key), err)
+	}
+	if other, _ := GenerateTOTPSecret(); other == secret {
+		t.Error("two secrets are equal")
+	}
+
+	uri := TOTPProvisioningURI("Digital Signage", "ana@example.com", secret)
+	want := "otpauth://totp/Digital%20Signage:ana@example.com?algorithm=SHA1&digits=6&issuer=Digital%20Signage&period=30&secret=" + secret
+	if uri != want {
+		t.Errorf("provisioning URI = %q, want %q", uri, want)
+	}
+}